@@ -0,0 +1,159 @@
+// Package app is an example application using package page: layouts and
+// partials, a localized page, an htmx fragment, error pages and an email with
+// an HTML and a text body. Run it with go run ./examples.
+package app
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/examples/page-use/page"
+)
+
+// templates holds the templates of the application.
+//
+//go:embed templates
+var templates embed.FS
+
+// App is the example application.
+type App struct {
+	ren     *page.Render            // The default, English, site.
+	locales map[string]*page.Render // The site per language tag, clones of ren.
+}
+
+// greetings are the greetings of the greeting page, by language tag.
+var greetings = map[string]string{
+	"en": "Hello",
+	"ar": "مرحبا",
+}
+
+// New returns the application, with the layouts and partials loaded.
+func New() (*App, error) {
+	ren := page.New()
+	ren.TemplateDir = "templates"
+	ren.TemplateFS = templates
+	ren.Functions = template.FuncMap{}
+	ren.UseCache = true
+	ren.Locale = "en"
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		return nil, err
+	}
+
+	// A Clone per language: each renders its pages with its own Locale,
+	// which sets lang and dir on <html> through {{langAttr}} and {{dirAttr}}.
+	a := &App{ren: ren, locales: make(map[string]*page.Render)}
+	for tag := range greetings {
+		clone := ren.Clone()
+		clone.Locale = tag
+		a.locales[tag] = clone
+	}
+	return a, nil
+}
+
+// Handler returns the routes of the application.
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", a.home)
+	mux.HandleFunc("GET /{lang}/greeting", a.greeting)
+	mux.HandleFunc("GET /clock", a.clock)
+	mux.HandleFunc("GET /email/welcome", a.welcomeEmail)
+	mux.HandleFunc("GET /fail", a.fail)
+	mux.HandleFunc("/", a.notFound)
+	return mux
+}
+
+// home serves the home page.
+func (a *App) home(w http.ResponseWriter, r *http.Request) {
+	a.show(w, r, a.ren, "home", map[string]any{"Message": "This page is built from a layout and two partials."})
+}
+
+// greeting serves the greeting page in the language of the path.
+func (a *App) greeting(w http.ResponseWriter, r *http.Request) {
+	lang := r.PathValue("lang")
+	ren, ok := a.locales[lang]
+	if !ok {
+		a.notFound(w, r)
+		return
+	}
+	a.show(w, r, ren, "greeting", map[string]any{"Greeting": greetings[lang]})
+}
+
+// clock serves the clock page, or only its "clock" block for the requests
+// htmx sends, which swaps it into the page.
+func (a *App) clock(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{"Time": time.Now().Format(time.TimeOnly)}
+	if r.Header.Get("HX-Request") != "true" {
+		a.show(w, r, a.ren, "clock", data)
+		return
+	}
+	out, err := a.ren.RenderGroup([]string{"clock.page.tmpl#clock"}, data)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(out["clock.page.tmpl#clock"]))
+}
+
+// welcomeEmail shows the HTML body of the welcome email, with the subject and
+// the text body in headers, as a preview.
+func (a *App) welcomeEmail(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "there"
+	}
+	subject, html, text, err := a.WelcomeEmail(name)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Email-Subject", subject)
+	w.Header().Set("X-Email-Text-Length", strconv.Itoa(len(text)))
+	w.Write([]byte(html))
+}
+
+// WelcomeEmail renders the subject and the HTML and text bodies of the
+// welcome email to name.
+func (a *App) WelcomeEmail(name string) (subject, html, text string, err error) {
+	out, err := a.ren.RenderGroup([]string{
+		"welcome.email.tmpl#subject",
+		"welcome.email.tmpl#html",
+		"welcome.email.tmpl#text",
+	}, map[string]any{"Name": name})
+	if err != nil {
+		return "", "", "", err
+	}
+	return out["welcome.email.tmpl#subject"], out["welcome.email.tmpl#html"], out["welcome.email.tmpl#text"], nil
+}
+
+// fail shows the error page, as a handler running into an error does.
+func (a *App) fail(w http.ResponseWriter, r *http.Request) {
+	a.serverError(w, r, errors.New("the example failed on purpose"))
+}
+
+// notFound serves the 404 page; the template sets the status with {{status}}.
+func (a *App) notFound(w http.ResponseWriter, r *http.Request) {
+	a.show(w, r, a.ren, "notfound", map[string]any{"Path": r.URL.Path})
+}
+
+// serverError logs err and serves the 500 page.
+func (a *App) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Println(err)
+	a.show(w, r, a.ren, "error", map[string]any{"Message": "Please try again later."})
+}
+
+// show renders the page t with ren. ShowRequest writes nothing when the
+// page fails, so the error is logged and answered here.
+func (a *App) show(w http.ResponseWriter, r *http.Request, ren *page.Render, t string, td any) {
+	if err := ren.ShowRequest(w, r, t, td); err != nil {
+		log.Println(err)
+		status := page.StatusFor(err)
+		http.Error(w, http.StatusText(status), status)
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestServer starts the application on a test server, closed with t.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get requests path from srv with the headers header (name, value pairs),
+// and returns the response with its body.
+func get(t *testing.T, srv *httptest.Server, path string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		name    string
+		path    string
+		header  []string
+		status  int
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "home",
+			path:   "/",
+			status: http.StatusOK,
+			want: []string{
+				`<html lang="en" dir="ltr">`,
+				"<title>Home</title>",
+				"<nav>",
+				"<p>This page is built from a layout and two partials.</p>",
+				"<footer>Rendered by the page package example.</footer>",
+			},
+		},
+		{
+			name:   "English greeting",
+			path:   "/en/greeting",
+			status: http.StatusOK,
+			want:   []string{`<html lang="en" dir="ltr">`, "<h1>Hello</h1>"},
+		},
+		{
+			name:   "Arabic greeting",
+			path:   "/ar/greeting",
+			status: http.StatusOK,
+			want:   []string{`<html lang="ar" dir="rtl">`, "<h1>مرحبا</h1>"},
+		},
+		{
+			name:   "greeting in an unknown language",
+			path:   "/xx/greeting",
+			status: http.StatusNotFound,
+			want:   []string{"<title>Not found</title>", "There is no page at /xx/greeting."},
+		},
+		{
+			name:   "clock page",
+			path:   "/clock",
+			status: http.StatusOK,
+			want:   []string{"<title>Clock</title>", `hx-get="/clock"`, `<p id="clock">`},
+		},
+		{
+			name:    "clock fragment",
+			path:    "/clock",
+			header:  []string{"HX-Request", "true"},
+			status:  http.StatusOK,
+			want:    []string{`<p id="clock">`},
+			notWant: []string{"<html", "<nav>", "<footer>"},
+		},
+		{
+			name:   "failing handler",
+			path:   "/fail",
+			status: http.StatusInternalServerError,
+			want:   []string{"<h1>Something went wrong</h1>", "Please try again later."},
+		},
+		{
+			name:   "unknown path",
+			path:   "/nope",
+			status: http.StatusNotFound,
+			want:   []string{"There is no page at /nope."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(t, srv, tt.path, tt.header...)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type %q", ct)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("body doesn't contain %q:\n%s", s, body)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("body contains %q:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestClockFragment(t *testing.T) {
+	srv := newTestServer(t)
+	_, body := get(t, srv, "/clock", "HX-Request", "true")
+	if !strings.HasPrefix(body, `<p id="clock">`) || !strings.HasSuffix(body, "</p>") {
+		t.Errorf("fragment %q, want only the clock paragraph", body)
+	}
+}
+
+func TestWelcomeEmail(t *testing.T) {
+	srv := newTestServer(t)
+	resp, body := get(t, srv, "/email/welcome?name=Ada")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if subject := resp.Header.Get("X-Email-Subject"); subject != "Welcome, Ada" {
+		t.Errorf("subject %q", subject)
+	}
+	if !strings.Contains(body, "<p>Hello Ada,</p>") {
+		t.Errorf("HTML body:\n%s", body)
+	}
+
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, html, text, err := a.WelcomeEmail("<Ada>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "Hello &lt;Ada&gt;,") {
+		t.Errorf("HTML body doesn't escape the name:\n%s", html)
+	}
+	if !strings.HasPrefix(text, "Hello ") || strings.Contains(text, "<p>") {
+		t.Errorf("text body:\n%s", text)
+	}
+}
+
+func TestLocalesDontLeak(t *testing.T) {
+	srv := newTestServer(t)
+	// The Arabic site is a Clone: rendering it first must leave the
+	// English site, and its cache, as they are.
+	if _, body := get(t, srv, "/ar/greeting"); !strings.Contains(body, `dir="rtl"`) {
+		t.Fatalf("Arabic greeting:\n%s", body)
+	}
+	for _, path := range []string{"/", "/en/greeting"} {
+		if _, body := get(t, srv, path); !strings.Contains(body, `<html lang="en" dir="ltr">`) {
+			t.Errorf("%s after the Arabic greeting:\n%s", path, body)
+		}
+	}
+}
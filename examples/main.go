@@ -0,0 +1,18 @@
+// Command examples runs the example application of package app on :8080.
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/examples/page-use/examples/app"
+)
+
+func main() {
+	a, err := app.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Starting on port :8080")
+	log.Fatal(http.ListenAndServe(":8080", a.Handler()))
+}
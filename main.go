@@ -1,6 +1,8 @@
 package main
 
 import (
+	"embed"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
@@ -12,6 +14,11 @@ import (
 
 const PORT = ":8080"
 
+// templates holds the templates compiled into the binary, see -embed.
+//
+//go:embed templates
+var templates embed.FS
+
 type Data struct {
 	Data map[string]any
 }
@@ -20,12 +27,19 @@ func main() {
 
 	render := page.Render{
 		TemplateDir: "./templates",
-		TemplateMap: make(map[string]*template.Template),
 		Functions:   template.FuncMap{},
 		Debug:       true,
 		UseCache:    true,
 	}
 
+	// Run with -embed to serve the templates compiled into the binary instead
+	// of those in ./templates. The page names stay the same either way.
+	embedded := flag.Bool("embed", false, "use the templates embedded in the binary")
+	flag.Parse()
+	if *embedded {
+		render.TemplateFS = templates
+	}
+
 	// Call LoadLayoutsAndPartials to automatically load all such files found in TemplateDir.
 	err := render.LoadLayoutsAndPartials([]string{".layout", ".partial"})
 	if err != nil {
@@ -38,7 +52,7 @@ func main() {
 		data["payload"] = "This is MY passed data."
 		err := render.Show(w, "home.page.tmpl", &Data{Data: data})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			log.Println(err)
 			return
 		}
@@ -49,7 +63,7 @@ func main() {
 		data["payload"] = "This is MY passed data for about page."
 		err := render.Show(w, "about.page.tmpl", &Data{Data: data})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			log.Println(err)
 			return
 		}
@@ -60,7 +74,7 @@ func main() {
 		data["payload"] = "This is passed data."
 		out, err := render.String("home.page.tmpl", &Data{Data: data})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			log.Println(err)
 			return
 		}
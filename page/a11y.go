@@ -0,0 +1,155 @@
+package page
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// sourcePass inspects the source of one template file and returns its findings.
+type sourcePass func(file string, src []byte) []Finding
+
+// sourcePasses are run by Validate over every page and partial file in use.
+// Their findings can be suppressed with an ignore comment; see suppressIgnored.
+var sourcePasses = []sourcePass{
+	lintAccessibility,
+}
+
+var (
+	// htmlTag matches an opening or closing tag: its slash, name and attributes.
+	htmlTag = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+	// ignoreComment matches {{/* lint:ignore rule-a rule-b */}}.
+	ignoreComment = regexp.MustCompile(`\{\{-?\s*/\*\s*lint:ignore\s+([\w\-, ]+?)\s*\*/\s*-?\}\}`)
+	// labelFor matches the for attribute of a <label>.
+	labelFor = regexp.MustCompile(`(?i)\bfor\s*=\s*["']?([^"'\s>]+)`)
+	// inputType and inputID match the type and id attributes of a form field.
+	inputType = regexp.MustCompile(`(?i)\btype\s*=\s*["']?([a-z]+)`)
+	inputID   = regexp.MustCompile(`(?i)\bid\s*=\s*["']?([^"'\s>]+)`)
+	// emptyAlt matches an empty alt attribute.
+	emptyAlt = regexp.MustCompile(`(?i)\balt\s*=\s*(""|'')`)
+)
+
+// lintAccessibility reports accessibility basics in the static markup of src:
+//   - "img-alt": an <img> without an alt attribute
+//   - "input-label": a form field without a <label> around it or pointing at
+//     its id, and without aria-label, aria-labelledby or title
+//   - "link-text": an <a> without text, image alt text or aria-label
+//
+// It looks at the source, so markup produced by template actions is not
+// checked and an action inside an element counts as content.
+func lintAccessibility(file string, src []byte) []Finding {
+	text := string(src)
+	labelled := make(map[string]bool)
+	for _, m := range htmlTag.FindAllStringSubmatch(text, -1) {
+		if m[1] == "" && strings.EqualFold(m[2], "label") {
+			if f := labelFor.FindStringSubmatch(m[3]); f != nil {
+				labelled[f[1]] = true
+			}
+		}
+	}
+
+	var findings []Finding
+	add := func(pos int, rule, message string) {
+		findings = append(findings, Finding{File: file, Rule: rule, Line: 1 + strings.Count(text[:pos], "\n"), Message: message})
+	}
+
+	labelDepth := 0
+	anchor := -1 // start of the content of the open <a>, or -1
+	anchorTag := 0
+	for _, loc := range htmlTag.FindAllStringSubmatchIndex(text, -1) {
+		closing := loc[3] > loc[2]
+		name := strings.ToLower(text[loc[4]:loc[5]])
+		attrs := text[loc[6]:loc[7]]
+		tag := text[loc[0]:loc[1]]
+
+		switch name {
+		case "label":
+			if closing {
+				labelDepth = max(0, labelDepth-1)
+			} else {
+				labelDepth++
+			}
+		case "img":
+			if !closing && !hasAttr(attrs, "alt") {
+				add(loc[0], "img-alt", "image without alt attribute: "+tag)
+			}
+		case "input", "select", "textarea":
+			if closing || labelDepth > 0 || hasAttr(attrs, "aria-label") || hasAttr(attrs, "aria-labelledby") || hasAttr(attrs, "title") {
+				continue
+			}
+			if t := inputType.FindStringSubmatch(attrs); t != nil && name == "input" {
+				switch strings.ToLower(t[1]) {
+				case "hidden", "submit", "button", "reset", "image":
+					continue
+				}
+			}
+			if id := inputID.FindStringSubmatch(attrs); id != nil && (labelled[id[1]] || strings.Contains(id[1], "{{")) {
+				continue
+			}
+			add(loc[0], "input-label", "form field without label: "+tag)
+		case "a":
+			if !closing {
+				anchor, anchorTag = loc[1], loc[0]
+				if hasAttr(attrs, "aria-label") || hasAttr(attrs, "aria-labelledby") || hasAttr(attrs, "title") {
+					anchor = -1
+				}
+				continue
+			}
+			if anchor >= 0 && !hasLinkText(text[anchor:loc[0]]) {
+				add(anchorTag, "link-text", "link without text: "+text[anchorTag:anchor])
+			}
+			anchor = -1
+		}
+	}
+	return suppressIgnored(src, findings)
+}
+
+// hasAttr reports whether the attribute list attrs of a tag contains name.
+func hasAttr(attrs, name string) bool {
+	for _, field := range strings.Fields(strings.ToLower(attrs)) {
+		if field == name || strings.HasPrefix(field, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLinkText reports whether the content of an <a> gives it a name: text,
+// an action that may produce text, or an image with non-empty alt text.
+func hasLinkText(content string) bool {
+	if strings.Contains(content, "{{") {
+		return true
+	}
+	for _, m := range htmlTag.FindAllStringSubmatch(content, -1) {
+		if strings.EqualFold(m[2], "img") && !emptyAlt.MatchString(m[3]) && hasAttr(m[3], "alt") {
+			return true
+		}
+	}
+	return strings.TrimSpace(htmlTag.ReplaceAllString(content, "")) != ""
+}
+
+// suppressIgnored drops the findings suppressed by an ignore comment in src:
+// {{/* lint:ignore rule */}} suppresses the findings of rule (several rules
+// may be listed) on the line of the comment and on the line after it.
+func suppressIgnored(src []byte, findings []Finding) []Finding {
+	ignored := make(map[int]map[string]bool)
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		for _, m := range ignoreComment.FindAllSubmatch(line, -1) {
+			for _, rule := range strings.FieldsFunc(string(m[1]), func(r rune) bool { return r == ',' || r == ' ' }) {
+				for _, n := range []int{i + 1, i + 2} {
+					if ignored[n] == nil {
+						ignored[n] = make(map[string]bool)
+					}
+					ignored[n][rule] = true
+				}
+			}
+		}
+	}
+	kept := findings[:0]
+	for _, f := range findings {
+		if !ignored[f.Line][f.Rule] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,63 @@
+package page
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Alias makes alias another name of the page target, e.g. "home" and "/" for
+// "index.page.tmpl", without a second file. The alias is resolved before the
+// cache is looked at, so rendering it uses the set of target, parsed once and
+// cached under the name of target. target may be a short name (see pageName)
+// and must be a page that exists now; an alias of an alias stands for the
+// page behind it. Aliases are kept when the cache or the partials are
+// replaced. Adding alias again points it to the new target.
+func (ren *Render) Alias(alias, target string) error {
+	name, err := ren.pageName(target)
+	if err != nil {
+		return fmt.Errorf("alias %q: %w", alias, err)
+	}
+	if !ren.pageExists(name) {
+		return fmt.Errorf("alias %q: no page %q in %s", alias, name, strings.Join(ren.templateDirs(), ", "))
+	}
+	if alias == name {
+		return fmt.Errorf("alias %q: a page can't be an alias of itself", alias)
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.aliases == nil {
+		ren.aliases = make(map[string]string)
+	}
+	ren.aliases[alias] = name
+	ren.countRegistriesLocked()
+	if ren.Debug {
+		log.Println("Added alias", alias, "for", name)
+	}
+	return nil
+}
+
+// aliasOf returns the page the alias t stands for, if t is one.
+func (ren *Render) aliasOf(t string) (string, bool) {
+	if ren.sizes.aliases.Load() == 0 {
+		return "", false
+	}
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	name, ok := ren.aliases[t]
+	return name, ok
+}
+
+// pageExists reports whether the page t can be built: a page of
+// AddTemplateString, of a registered source, or a file in the template
+// directories.
+func (ren *Render) pageExists(t string) bool {
+	if _, ok := ren.stringPage(t); ok {
+		return true
+	}
+	if _, ok := ren.sourcePage(t); ok {
+		return true
+	}
+	return ren.templateExists(ren.resolvePage(t, ren.currentTheme()))
+}
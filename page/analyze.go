@@ -0,0 +1,43 @@
+package page
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Analysis describes the templates in TemplateDir; see Analyze.
+type Analysis struct {
+	Pages    []string            // Names of the pages, e.g. "home.page.tmpl".
+	Partials []string            // Layout and partial files parsed into every page.
+	Variants map[string][]string // Files with environment variants: file -> its variant files.
+	// Templates registered with Deprecate that pages still use: template -> pages.
+	Deprecated map[string][]string
+}
+
+// Analyze reports on the templates in TemplateDir without rendering anything.
+// Variants lists every file with environment variants (home.page.prod.tmpl
+// next to home.page.tmpl), so variants that drift apart can be spotted.
+// Deprecated lists the pages still using templates registered with
+// Deprecate; it parses every page to find them.
+func (ren *Render) Analyze() (Analysis, error) {
+	pages, err := ren.pageNames()
+	if err != nil {
+		return Analysis{}, err
+	}
+	variants, err := ren.environmentVariants()
+	if err != nil {
+		return Analysis{}, err
+	}
+	for _, files := range variants {
+		sort.Strings(files)
+	}
+	partials := ren.partials()
+	for i, p := range partials {
+		partials[i] = filepath.ToSlash(p)
+	}
+	deprecated, err := ren.deprecatedReferences(pages)
+	if err != nil {
+		return Analysis{}, err
+	}
+	return Analysis{Pages: pages, Partials: partials, Variants: variants, Deprecated: deprecated}, nil
+}
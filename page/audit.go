@@ -0,0 +1,199 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// defaultAuditQueue is the queue length of an async AuditPolicy when
+// QueueSize is 0.
+const defaultAuditQueue = 256
+
+// AuditEntry records one render of an audited page; see Render.Audit.
+type AuditEntry struct {
+	Template      string
+	Time          time.Time
+	CorrelationID string   // See WithCorrelationID; the X-Request-ID header otherwise.
+	Subject       string   // The id of the record rendered, see WithAuditSubject.
+	DataKeys      []string // Names of the data present, sorted; values are never recorded.
+}
+
+// AuditPolicy configures the auditing of the pages it is set for in
+// Render.Audit.
+type AuditPolicy struct {
+	// Hook receives the entries. A hook returning an error has failed to
+	// record the entry.
+	Hook func(entry AuditEntry) error
+	// Async hands entries to Hook from a queue of QueueSize entries (0 means
+	// 256), so a slow hook doesn't slow down the page. Entries not fitting
+	// in the queue are dropped and logged.
+	Async     bool
+	QueueSize int
+	// FailClosed fails the request with status 500 when the entry can't be
+	// recorded: Hook returned an error or, with Async, the queue is full.
+	// Nothing of the page is written then.
+	FailClosed bool
+}
+
+type auditContextKey int
+
+const (
+	subjectKey auditContextKey = iota
+	correlationKey
+)
+
+// WithAuditSubject returns a copy of ctx carrying the id of the record a
+// request renders, e.g. an account number, for AuditEntry.Subject.
+func WithAuditSubject(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, subjectKey, id)
+}
+
+// WithCorrelationID returns a copy of ctx carrying the id correlating a
+// request across services, for AuditEntry.CorrelationID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey, id)
+}
+
+// auditPolicy returns the policy for t: Audit[t], or the policy of the first
+// (sorted) path.Match pattern matching t.
+func (ren *Render) auditPolicy(t string) (string, AuditPolicy, bool) {
+	if len(ren.Audit) == 0 {
+		return "", AuditPolicy{}, false
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if policy, ok := ren.Audit[t]; ok {
+		return t, policy, true
+	}
+	patterns := make([]string, 0, len(ren.Audit))
+	for pattern := range ren.Audit {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, t); ok {
+			return pattern, ren.Audit[pattern], true
+		}
+	}
+	return "", AuditPolicy{}, false
+}
+
+// audit records the render of t for r with td when t is audited. The error
+// is only returned for a FailClosed policy; other failures are logged.
+func (ren *Render) audit(r *http.Request, t string, td any) error {
+	pattern, policy, ok := ren.auditPolicy(t)
+	if !ok || policy.Hook == nil {
+		return nil
+	}
+	entry := AuditEntry{
+		Template: t,
+		Time:     time.Now(),
+		DataKeys: dataKeys(td),
+	}
+	entry.Subject, _ = r.Context().Value(subjectKey).(string)
+	entry.CorrelationID, _ = r.Context().Value(correlationKey).(string)
+	if entry.CorrelationID == "" {
+		entry.CorrelationID = r.Header.Get("X-Request-ID")
+	}
+
+	var err error
+	if policy.Async {
+		err = ren.auditQueue(pattern, policy).enqueue(entry)
+	} else {
+		err = policy.Hook(entry)
+	}
+	if err == nil {
+		return nil
+	}
+	log.Println("audit", t, err)
+	if policy.FailClosed {
+		return fmt.Errorf("audit %s: %w", t, err)
+	}
+	return nil
+}
+
+// errAuditQueueFull is the error of an entry that didn't fit in the queue.
+var errAuditQueueFull = errors.New("audit queue full")
+
+// auditQueue is the queue of an async AuditPolicy, drained by one goroutine.
+type auditQueue chan AuditEntry
+
+func (q auditQueue) enqueue(entry AuditEntry) error {
+	select {
+	case q <- entry:
+		return nil
+	default:
+		return errAuditQueueFull
+	}
+}
+
+// auditQueue returns the queue of the policy set for pattern, starting it on
+// first use. Queues live as long as ren.
+func (ren *Render) auditQueue(pattern string, policy AuditPolicy) auditQueue {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if q, ok := ren.auditQueues[pattern]; ok {
+		return q
+	}
+	size := policy.QueueSize
+	if size <= 0 {
+		size = defaultAuditQueue
+	}
+	q := make(auditQueue, size)
+	if ren.auditQueues == nil {
+		ren.auditQueues = make(map[string]auditQueue)
+	}
+	ren.auditQueues[pattern] = q
+	go func() {
+		for entry := range q {
+			if err := policy.Hook(entry); err != nil {
+				log.Println("audit", entry.Template, err)
+			}
+		}
+	}()
+	return q
+}
+
+// dataKeys returns the names of the data in td: the keys of a map or the
+// exported non-zero fields of a struct, and those of its Data payload as
+// "Data.name".
+func dataKeys(td any) []string {
+	keys := namesIn(td, "")
+	for _, key := range keys {
+		if key == "Data" {
+			keys = append(keys, namesIn(unwrapData(td), "Data.")...)
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// namesIn returns the map keys or present struct fields of v, with prefix.
+func namesIn(v any, prefix string) []string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	var names []string
+	switch rv.Kind() {
+	case reflect.Map:
+		for _, k := range rv.MapKeys() {
+			names = append(names, prefix+fmt.Sprint(k.Interface()))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if f := rv.Type().Field(i); f.IsExported() && !rv.Field(i).IsZero() {
+				names = append(names, prefix+f.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,147 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// partialBase is the built-in partials, the partial files and the partials of
+// AddPartialString parsed once, for the sets of every page: a page clones it
+// and parses only its own file, instead of reading and parsing every partial
+// again. See partialSet.
+type partialBase struct {
+	key            string             // See baseKey.
+	tmpl           *template.Template // The partials, under a root without a tree.
+	sources        sourceMap          // Source files of the partials.
+	stringPartials []stringPartial    // The partials of AddPartialString in tmpl.
+	fingerprint    string             // fingerprintFiles of the partial files.
+	hashState      []byte             // State of the hash of fingerprint, to go on with a page.
+}
+
+// baseKey returns the key of the base of partialFiles. It holds cacheGen, so
+// everything that drops the cached sets (ClearCache, Invalidate, SetPartials,
+// AddFunc, Reload, ...) drops the base with them.
+func (ren *Render) baseKey(partialFiles []string) string {
+	ren.mu.RLock()
+	gen := ren.cacheGen
+	ren.mu.RUnlock()
+	return fmt.Sprintf("%d\x00%t\x00%s", gen, ren.DisableBuiltins, strings.Join(partialFiles, "\x00"))
+}
+
+// basePartials returns the base of partialFiles, parsing it when there is
+// none for them yet. Sets built at the same time wait for one parse.
+func (ren *Render) basePartials(partialFiles []string) (*partialBase, error) {
+	key := ren.baseKey(partialFiles)
+	ren.baseMu.Lock()
+	defer ren.baseMu.Unlock()
+	if ren.base != nil && ren.base.key == key {
+		return ren.base, nil
+	}
+	b, err := ren.parseBase(key, partialFiles)
+	if err != nil {
+		return nil, err
+	}
+	ren.base = b
+	return b, nil
+}
+
+// dropBase drops the base, so the next set parses the partials again.
+func (ren *Render) dropBase() {
+	ren.baseMu.Lock()
+	ren.base = nil
+	ren.baseMu.Unlock()
+}
+
+// parseBase parses the base of partialFiles with the key key.
+func (ren *Render) parseBase(key string, partialFiles []string) (*partialBase, error) {
+	b := &partialBase{key: key, sources: make(sourceMap, len(partialFiles))}
+	for _, p := range partialFiles {
+		b.sources[ren.templateName(p)] = sourceFile{Path: p}
+	}
+	// Parsing only checks that functions exist; every page binds its own, see
+	// partialSet.
+	b.tmpl = template.New("").Funcs(ren.templateFuncs())
+	if err := ren.addBuiltins(b.tmpl, b.sources, partialFiles); err != nil {
+		return nil, err
+	}
+	if err := ren.parseFiles(b.tmpl, b.sources, partialFiles...); err != nil {
+		return nil, err
+	}
+	var err error
+	if b.stringPartials, err = ren.addStringPartials(b.tmpl, b.sources); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if err := ren.hashFiles(h, partialFiles); err != nil {
+		return nil, err
+	}
+	b.fingerprint = hex.EncodeToString(h.Sum(nil))
+	if b.hashState, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// partialSet returns a new set for the page t with the built-in partials,
+// partialFiles and the partials of AddPartialString parsed into it, and
+// added to sources, ready for the page itself; it also returns the partials
+// of AddPartialString. With UseCache, the partials are parsed once into a
+// base that the sets of every page clone, which is also returned; without,
+// they are read again for every set, so edits show up on the next render.
+// With fresh, they are read again even with UseCache, and the base is left
+// as it is.
+func (ren *Render) partialSet(t string, partialFiles []string, sources sourceMap, fresh bool) (*template.Template, []stringPartial, *partialBase, error) {
+	if ren.UseCache && !fresh {
+		// A base that fails to parse is parsed again below, for the error
+		// of the page.
+		if b, err := ren.basePartials(partialFiles); err == nil {
+			if clone, err := b.tmpl.Clone(); err == nil {
+				for name, src := range b.sources {
+					sources[name] = src
+				}
+				return clone.New(t).Funcs(ren.setFuncs(t)), b.stringPartials, b, nil
+			}
+		}
+	}
+
+	tmpl := template.New(t).Funcs(ren.setFuncs(t))
+	// The built-in partials come first, so partial files can replace them.
+	if err := ren.addBuiltins(tmpl, sources, partialFiles); err != nil {
+		return nil, nil, nil, renderError(t, sources, err)
+	}
+	// parseFiles runs every file through SourceTransforms first.
+	if err := ren.parseFiles(tmpl, sources, partialFiles...); err != nil {
+		return nil, nil, nil, renderError(t, sources, err)
+	}
+	// The partials of AddPartialString follow those files.
+	stringPartials, err := ren.addStringPartials(tmpl, sources)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tmpl, stringPartials, nil, nil
+}
+
+// fingerprintAfter is fingerprintFiles of partialFiles followed by files. With
+// base, the base of partialFiles, the hash goes on from its state instead of
+// reading partialFiles again.
+func (ren *Render) fingerprintAfter(base *partialBase, partialFiles []string, files ...string) (string, error) {
+	if base == nil {
+		return ren.fingerprintFiles(append(append([]string(nil), partialFiles...), files...))
+	}
+	if len(files) == 0 {
+		return base.fingerprint, nil
+	}
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(base.hashState); err != nil {
+		return "", err
+	}
+	if err := ren.hashFiles(h, files); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
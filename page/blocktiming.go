@@ -0,0 +1,155 @@
+package page
+
+import (
+	"html/template"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"text/template/parse"
+	"time"
+)
+
+// blockSamples is the number of recent timings kept per block for the
+// percentiles in Stats.
+const blockSamples = 512
+
+// BlockTiming is the execution time of one template across traced renders;
+// see Render.TraceBlocks.
+type BlockTiming struct {
+	File  string        // File the template is defined in.
+	Count int64         // Number of traced executions.
+	P50   time.Duration // Median of the recent executions.
+	P95   time.Duration // 95th percentile of the recent executions.
+}
+
+// blockTimings aggregates the timings of traced renders per template name.
+type blockTimings struct {
+	renders atomic.Int64 // Renders seen, for sampling.
+
+	mu     sync.Mutex
+	blocks map[string]*blockRing
+}
+
+// blockRing holds the recent timings of one template.
+type blockRing struct {
+	file    string
+	count   int64
+	samples [blockSamples]time.Duration
+}
+
+func (b *blockTimings) record(name, file string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.blocks == nil {
+		b.blocks = make(map[string]*blockRing)
+	}
+	ring := b.blocks[name]
+	if ring == nil {
+		ring = &blockRing{file: file}
+		b.blocks[name] = ring
+	}
+	ring.samples[ring.count%blockSamples] = d
+	ring.count++
+}
+
+// snapshot returns the timings per template name, or nil when nothing was traced.
+func (b *blockTimings) snapshot() map[string]BlockTiming {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.blocks) == 0 {
+		return nil
+	}
+	timings := make(map[string]BlockTiming, len(b.blocks))
+	for name, ring := range b.blocks {
+		samples := slices.Clone(ring.samples[:min(ring.count, blockSamples)])
+		slices.Sort(samples)
+		timings[name] = BlockTiming{
+			File:  ring.file,
+			Count: ring.count,
+			P50:   samples[len(samples)*50/100],
+			P95:   samples[len(samples)*95/100],
+		}
+	}
+	return timings
+}
+
+// blockTracer times the templates of one traced render. Templates nest, so
+// the start times are kept on a stack.
+type blockTracer struct {
+	timings *blockTimings
+	stack   []time.Time
+}
+
+func (tr *blockTracer) start(name, file string) bool {
+	tr.stack = append(tr.stack, time.Now())
+	return false
+}
+
+func (tr *blockTracer) end(name, file string) bool {
+	if n := len(tr.stack); n > 0 {
+		tr.timings.record(name, file, time.Since(tr.stack[n-1]))
+		tr.stack = tr.stack[:n-1]
+	}
+	return false
+}
+
+// noBlockMarker is the pageBlockStart and pageBlockEnd function of renders
+// that are not traced.
+func noBlockMarker(name, file string) bool {
+	return false
+}
+
+// instrumentBlocks wraps the content of every template in the set tmpl in
+// {{if pageBlockStart "name" "file"}}{{end}} ... {{if pageBlockEnd "name" "file"}}{{end}},
+// which produce no output. Templates that are only whitespace are skipped.
+func instrumentBlocks(tmpl *template.Template) error {
+	funcs := map[string]any{"pageBlockStart": noBlockMarker, "pageBlockEnd": noBlockMarker}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil || onlyWhitespace(t.Tree.Root) {
+			continue
+		}
+		args := strconv.Quote(t.Name()) + " " + strconv.Quote(t.Tree.ParseName)
+		src := "{{if pageBlockStart " + args + "}}{{end}}{{if pageBlockEnd " + args + "}}{{end}}"
+		trees, err := parse.Parse("blocks", src, "", "", funcs)
+		if err != nil {
+			return err
+		}
+		markers := trees["blocks"].Root.Nodes
+		nodes := append([]parse.Node{markers[0]}, t.Tree.Root.Nodes...)
+		t.Tree.Root.Nodes = append(nodes, markers[1])
+	}
+	return nil
+}
+
+// traceTemplate returns the set to execute for a traced render of t, with
+// the functions of a new tracer bound, or nil when this render isn't traced:
+// one render in TraceBlocks is. tmpl is the set the render would execute;
+// when it is not the cached set it is an unexecuted clone and is used as is.
+func (ren *Render) traceTemplate(tmpl *template.Template, t string) *template.Template {
+	if ren.TraceBlocks <= 0 || ren.blockTimings.renders.Add(1)%int64(ren.TraceBlocks) != 0 {
+		return nil
+	}
+	p, ok := ren.cachedPage(t)
+	if !ok {
+		ren.mu.RLock()
+		p = snapshotPage{set: ren.cache[t], proto: ren.protos[t]}
+		ren.mu.RUnlock()
+	}
+	cached, proto := p.set, p.proto
+	if tmpl == cached {
+		if proto == nil {
+			return nil
+		}
+		clone, err := proto.Clone()
+		if err != nil {
+			return nil
+		}
+		tmpl = clone
+	}
+	if tmpl.Lookup(t) == nil || !usesFunc(tmpl, "pageBlockStart") {
+		return nil
+	}
+	tr := &blockTracer{timings: &ren.blockTimings}
+	return tmpl.Funcs(template.FuncMap{"pageBlockStart": tr.start, "pageBlockEnd": tr.end})
+}
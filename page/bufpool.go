@@ -0,0 +1,74 @@
+package page
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// minBufferClass is the smallest buffer size class, 4KB; every class is
+	// twice the one before it.
+	minBufferClass = 4 << 10
+	// bufferClasses is the number of size classes: 4KB up to 8MB.
+	bufferClasses = 12
+	// defaultMaxBufferSize is the MaxBufferSize used when it is 0.
+	defaultMaxBufferSize = 1 << 20
+)
+
+// bufferPools holds reusable output buffers, one pool per size class, so a
+// 900KB page gets a buffer that fits without growing and a small page doesn't
+// hold on to a big one.
+var bufferPools [bufferClasses]sync.Pool
+
+// bufferClass returns the class of the smallest buffer holding size bytes.
+func bufferClass(size int) int {
+	class := 0
+	for c := minBufferClass; c < size && class < bufferClasses-1; c <<= 1 {
+		class++
+	}
+	return class
+}
+
+// maxBufferSize returns MaxBufferSize or its default.
+func (ren *Render) maxBufferSize() int {
+	if ren.MaxBufferSize > 0 {
+		return ren.MaxBufferSize
+	}
+	return defaultMaxBufferSize
+}
+
+// getBuffer returns an empty buffer for rendering the template name, sized
+// after its last render (up to MaxBufferSize).
+func (ren *Render) getBuffer(name string) *bytes.Buffer {
+	size := minBufferClass
+	if last, ok := ren.sizeHints.Load(name); ok {
+		size = min(last.(int), ren.maxBufferSize())
+	}
+	class := bufferClass(size)
+	if buf, ok := bufferPools[class].Get().(*bytes.Buffer); ok {
+		return buf
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(minBufferClass << class)
+	return buf
+}
+
+// putBuffer remembers the size of the output of name and returns buf to the
+// pool of its class. Buffers that grew beyond MaxBufferSize are dropped.
+func (ren *Render) putBuffer(name string, buf *bytes.Buffer) {
+	ren.sizeHints.Store(name, buf.Len())
+	if buf.Cap() > ren.maxBufferSize() {
+		return
+	}
+	// A buffer goes to the largest class it fully holds, so buffers taken
+	// from a class are always at least that class's size.
+	class := bufferClass(buf.Cap())
+	if minBufferClass<<class > buf.Cap() {
+		if class == 0 {
+			return
+		}
+		class--
+	}
+	buf.Reset()
+	bufferPools[class].Put(buf)
+}
@@ -0,0 +1,167 @@
+package page
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBufferClass(t *testing.T) {
+	tests := []struct {
+		size, class int
+	}{
+		{0, 0},
+		{1, 0},
+		{4 << 10, 0},
+		{4<<10 + 1, 1},
+		{1 << 20, 8},
+		{8 << 20, 11},
+		{64 << 20, 11},
+	}
+	for _, tt := range tests {
+		if got := bufferClass(tt.size); got != tt.class {
+			t.Errorf("bufferClass(%d) = %d, want %d", tt.size, got, tt.class)
+		}
+	}
+}
+
+// largeTemplates have a page rendering about 380KB for 10000 items, and a
+// small one.
+var largeTemplates = map[string]string{
+	"large.page.tmpl": `{{range .}}<li class="item">item number {{.}}</li>{{end}}`,
+	"small.page.tmpl": `small {{len .}}`,
+	"fail.page.tmpl":  `{{range .}}<li>{{.}}</li>{{end}}{{index . 1000000}}`,
+}
+
+// largeData is the data of largeTemplates.
+func largeData() []int {
+	items := make([]int, 10000)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+// Pooled buffers are reset: a render never gets the output of one before it,
+// with or without ExecuteString, after a large page or a failed one.
+func TestPooledBuffersReset(t *testing.T) {
+	items := largeData()
+	var want strings.Builder
+	for _, i := range items {
+		want.WriteString(`<li class="item">item number `)
+		want.WriteString(strconv.Itoa(i))
+		want.WriteString(`</li>`)
+	}
+
+	for _, behavior := range []Behavior{0, ExecuteString} {
+		ren := newTestRender(t, writeTemplates(t, largeTemplates))
+		ren.Behavior = behavior
+		for i := 0; i < 3; i++ {
+			got, err := ren.String("large.page.tmpl", items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want.String() {
+				t.Fatalf("behavior %v: large page differs from the expected output (%d bytes, want %d)", behavior, len(got), want.Len())
+			}
+			if _, err := ren.String("fail.page.tmpl", items); err == nil {
+				t.Fatalf("behavior %v: the failing page rendered", behavior)
+			}
+			if got, err := ren.String("small.page.tmpl", items); err != nil || got != "small 10000" {
+				t.Fatalf("behavior %v: small page: got %q, %v", behavior, got, err)
+			}
+		}
+	}
+}
+
+func benchmarkString(b *testing.B, behavior Behavior) {
+	ren := newTestRender(b, writeTemplates(b, largeTemplates))
+	ren.UseCache = true
+	ren.Behavior = behavior
+	items := largeData()
+	if _, err := ren.String("large.page.tmpl", items); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ren.String("large.page.tmpl", items); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkString(b *testing.B) { benchmarkString(b, 0) }
+
+func BenchmarkStringExecuteString(b *testing.B) { benchmarkString(b, ExecuteString) }
+
+// The buffer of a page is sized after its last render, so a page of about
+// 900KB allocates its output and little else; its allocations per render are
+// compared with buffers capped at the smallest class (MaxBufferSize 1), which
+// grow from 4KB on every render as without the size hints. A small page
+// rendered after it gets a small buffer.
+func BenchmarkBufferSizeHints(b *testing.B) {
+	items := make([]int, 25000)
+	for i := range items {
+		items[i] = i
+	}
+	for _, bb := range []struct {
+		name          string
+		page          string
+		maxBufferSize int
+	}{
+		{"large", "large.page.tmpl", 0},
+		{"large-unsized", "large.page.tmpl", 1},
+		{"small-after-large", "small.page.tmpl", 0},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			ren := newTestRender(b, writeTemplates(b, largeTemplates))
+			ren.UseCache = true
+			ren.MaxBufferSize = bb.maxBufferSize
+			for _, page := range []string{"large.page.tmpl", bb.page} {
+				if _, err := ren.String(page, items); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ren.String(bb.page, items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// A page gets a buffer that holds its last output, and a small page rendered
+// after a large one still gets one of the smallest class.
+func TestBufferSizeHints(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, largeTemplates))
+	items := largeData()
+	large, err := ren.String("large.page.tmpl", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ren.String("small.page.tmpl", items); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := ren.getBuffer("large.page.tmpl")
+	if buf.Cap() < len(large) {
+		t.Errorf("buffer of the large page holds %d bytes, want at least %d", buf.Cap(), len(large))
+	}
+	ren.putBuffer("large.page.tmpl", buf)
+	buf = ren.getBuffer("small.page.tmpl")
+	if buf.Cap() >= 2*minBufferClass {
+		t.Errorf("buffer of the small page holds %d bytes, want less than %d", buf.Cap(), 2*minBufferClass)
+	}
+	ren.putBuffer("small.page.tmpl", buf)
+
+	// Past MaxBufferSize, the hint is capped and the buffer not pooled.
+	ren.MaxBufferSize = 64 << 10
+	buf = ren.getBuffer("large.page.tmpl")
+	if buf.Cap() > 2*ren.MaxBufferSize {
+		t.Errorf("buffer of the large page with MaxBufferSize %d holds %d bytes", ren.MaxBufferSize, buf.Cap())
+	}
+}
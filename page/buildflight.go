@@ -0,0 +1,73 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"sync"
+)
+
+// buildFlight is one build of a page from disk, shared by the renders that
+// find the page missing from the cache while it runs.
+type buildFlight struct {
+	done chan struct{}
+	tmpl *template.Template
+	err  error
+}
+
+// buildKey identifies a build: the page and the cacheGen it started in, so
+// a render after ClearCache doesn't join a build of the files before.
+type buildKey struct {
+	t   string
+	gen uint64
+}
+
+// buildFlights holds the builds in flight.
+type buildFlights struct {
+	mu      sync.Mutex
+	flights map[buildKey]*buildFlight
+}
+
+// sharedBuild is buildTemplateFromDisk for t, run once for all callers at a
+// time: the first caller builds the set, and callers arriving while it runs
+// wait for it and get its set or its error. A caller arriving just after a
+// build finished finds the set in the cache instead of building it again.
+func (ren *Render) sharedBuild(t string) (*template.Template, error) {
+	ren.mu.RLock()
+	key := buildKey{t: t, gen: ren.cacheGen}
+	ren.mu.RUnlock()
+
+	b := &ren.builds
+	b.mu.Lock()
+	if f, ok := b.flights[key]; ok {
+		b.mu.Unlock()
+		ren.stats.buildsShared.Add(1)
+		if ren.Debug {
+			log.Println("Waiting for the build of", t, "in flight")
+		}
+		<-f.done
+		return f.tmpl, f.err
+	}
+	if ren.UseCache {
+		ren.mu.RLock()
+		tmpl, ok := ren.cache[t]
+		ren.mu.RUnlock()
+		if ok {
+			b.mu.Unlock()
+			ren.usedSet(t)
+			return tmpl, nil
+		}
+	}
+	f := &buildFlight{done: make(chan struct{})}
+	if b.flights == nil {
+		b.flights = make(map[buildKey]*buildFlight)
+	}
+	b.flights[key] = f
+	b.mu.Unlock()
+
+	f.tmpl, f.err = ren.buildTemplateFromDisk(t)
+	b.mu.Lock()
+	delete(b.flights, key)
+	b.mu.Unlock()
+	close(f.done)
+	return f.tmpl, f.err
+}
@@ -0,0 +1,98 @@
+package page
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// blockingParse makes the parses of ren of the page file page wait for
+// release, counting them in parses.
+func blockingParse(ren *Render, page string, parses *atomic.Int64, release <-chan struct{}) {
+	ren.SourceTransforms = []SourceTransform{func(name string, src []byte) ([]byte, error) {
+		if strings.HasSuffix(name, page) {
+			parses.Add(1)
+			<-release
+		}
+		return src, nil
+	}}
+}
+
+func TestSharedBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		useCache bool
+		wantErr  bool
+	}{
+		{"cached", `{{template "base" .}}`, true, false},
+		{"uncached", `{{template "base" .}}`, false, false},
+		{"parse error", `{{template "base" .}`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTemplates(t, map[string]string{
+				"base.layout.tmpl": `{{define "base"}}home{{end}}`,
+				"home.page.tmpl":   tt.page,
+			})
+			ren := newTestRender(t, dir)
+			ren.UseCache = tt.useCache
+			var parses atomic.Int64
+			release := make(chan struct{})
+			var once sync.Once
+			free := func() { once.Do(func() { close(release) }) }
+			t.Cleanup(free) // Renders left waiting after a failure.
+			blockingParse(ren, "home.page.tmpl", &parses, release)
+
+			// The first render parses the page and waits in the transform;
+			// the build is released once all others joined it.
+			const n = 20
+			outs := make([]string, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					outs[i], errs[i] = ren.String("home.page.tmpl", nil)
+				}(i)
+			}
+			waitFor(t, "the renders to join the build", func() bool {
+				return ren.Stats().BuildsShared == n-1
+			})
+			free()
+			wg.Wait()
+
+			if got := parses.Load(); got != 1 {
+				t.Errorf("page parsed %d times, want once", got)
+			}
+			if got := ren.Stats().SetsBuilt; got != 1 {
+				t.Errorf("SetsBuilt = %d, want 1", got)
+			}
+			for i := range outs {
+				if (errs[i] != nil) != tt.wantErr {
+					t.Fatalf("render %d: error %v", i, errs[i])
+				}
+				if errs[i] == nil && outs[i] != "home" {
+					t.Errorf("render %d: got %q", i, outs[i])
+				}
+				if tt.wantErr && errs[i].Error() != errs[0].Error() {
+					t.Errorf("render %d got error %v, render 0 %v", i, errs[i], errs[0])
+				}
+			}
+
+			// Later renders hit the cache, or build again without it.
+			if _, err := ren.String("home.page.tmpl", nil); (err != nil) != tt.wantErr {
+				t.Fatal(err)
+			}
+			want := int64(1)
+			if !tt.useCache || tt.wantErr {
+				want = 2
+			}
+			if got := parses.Load(); got != want {
+				t.Errorf("after one more render, page parsed %d times, want %d", got, want)
+			}
+		})
+	}
+}
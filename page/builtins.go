@@ -0,0 +1,81 @@
+package page
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"path"
+)
+
+// builtinPartials are the partials every page gets unless DisableBuiltins is
+// set. They are called by file name and read their data by key, so a map
+// works as well as a struct with those fields:
+//   - head.partial.tmpl: charset, viewport and <title> from .Title, then
+//     meta.partial.tmpl
+//   - meta.partial.tmpl: description from .Description and the canonical
+//     link from .Canonical
+//   - flash.partial.tmpl: the messages in .Flash and .Error
+//   - pagination.partial.tmpl: links for .Pagination, which has Page,
+//     Pages, PrevURL and NextURL
+//
+//go:embed builtin/partials/*.tmpl
+var builtinPartials embed.FS
+
+// builtinDir is the directory of builtinPartials.
+const builtinDir = "builtin/partials"
+
+// builtinsFor returns the names of the built-in partials used next to
+// partialFiles: those no partial file and no partial of AddPartialString
+// replaces, sorted. It is nil with DisableBuiltins.
+func (ren *Render) builtinsFor(partialFiles []string) ([]string, error) {
+	if ren.DisableBuiltins {
+		return nil, nil
+	}
+	taken := make(map[string]bool, len(partialFiles))
+	for _, p := range partialFiles {
+		taken[ren.templateName(p)] = true
+	}
+	for _, p := range ren.stringPartialList() {
+		taken[p.name] = true
+	}
+	entries, err := fs.ReadDir(builtinPartials, builtinDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if taken[e.Name()] {
+			if ren.Debug {
+				log.Println("Built-in partial", e.Name(), "is shadowed")
+			}
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+// addBuiltins parses the built-in partials into the set tmpl, before the
+// partial files: a partial with the same name as a built-in one replaces it,
+// and the built-in one is left out so its templates can't clash with those
+// of the partial.
+func (ren *Render) addBuiltins(tmpl *template.Template, sources sourceMap, partialFiles []string) error {
+	names, err := ren.builtinsFor(partialFiles)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		src, err := fs.ReadFile(builtinPartials, path.Join(builtinDir, name))
+		if err != nil {
+			return err
+		}
+		if sources != nil {
+			sources[name] = sourceFile{Path: "builtin:" + name}
+		}
+		if _, err := tmpl.New(name).Parse(string(src)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
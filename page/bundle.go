@@ -0,0 +1,295 @@
+package page
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// bundleVersion is the version of the bundle format ExportBundle writes.
+	bundleVersion = 1
+	// bundleManifest and bundleDir are where a bundle keeps its manifest and
+	// the template files.
+	bundleManifest = "manifest.json"
+	bundleDir      = "templates"
+)
+
+// BundleManifest describes the templates in a bundle; see ExportBundle.
+// Paths are relative to TemplateDir, with forward slashes.
+type BundleManifest struct {
+	Version     int
+	Files       []BundleFile                 // Every template file, sorted by path.
+	Fingerprint string                       // Hash of the paths and hashes of all files.
+	Meta        map[string]map[string]string // Front matter of the pages that have it.
+	Analysis    Analysis                     // See Analyze.
+}
+
+// BundleFile is one file in a bundle.
+type BundleFile struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// ExportBundle writes every template file in TemplateDir, with a manifest,
+// to w as a zip archive, for review where the source tree isn't available.
+// The archive is deterministic: files are sorted and carry no timestamps or
+// owners, so exports of identical trees are byte-identical and two exports
+// can be diffed. The manifest is the first entry, manifest.json; the files
+// follow under templates/.
+func (ren *Render) ExportBundle(w io.Writer) error {
+	files, err := ren.findTemplates(context.Background())
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	analysis, err := ren.Analyze()
+	if err != nil {
+		return err
+	}
+	manifest := BundleManifest{
+		Version:  bundleVersion,
+		Analysis: ren.relativeAnalysis(analysis),
+	}
+	contents := make(map[string][]byte, len(files))
+	for _, file := range files {
+		src, err := ren.readTemplate(file)
+		if err != nil {
+			return err
+		}
+		rel := ren.relativePath(file)
+		sum := sha256.Sum256(src)
+		manifest.Files = append(manifest.Files, BundleFile{Path: rel, Size: int64(len(src)), SHA256: hex.EncodeToString(sum[:])})
+		contents[rel] = src
+	}
+	manifest.Fingerprint = bundleFingerprint(manifest.Files)
+	for _, page := range analysis.Pages {
+		meta, err := ren.PageMeta(page)
+		if err != nil {
+			return err
+		}
+		if meta != nil {
+			if manifest.Meta == nil {
+				manifest.Meta = make(map[string]map[string]string)
+			}
+			manifest.Meta[page] = meta
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := writeBundleEntry(zw, bundleManifest, manifestJSON); err != nil {
+		return err
+	}
+	for _, f := range manifest.Files {
+		if err := writeBundleEntry(zw, path.Join(bundleDir, f.Path), contents[f.Path]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeBundleEntry adds a file to zw without a modification time.
+func writeBundleEntry(zw *zip.Writer, name string, content []byte) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(content)
+	return err
+}
+
+// ImportBundle reads a bundle written by ExportBundle and returns its
+// template files as a read-only fs.FS, after checking them against the
+// manifest. Register it with RegisterSource to render from it.
+func ImportBundle(r io.Reader) (fs.FS, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	manifestJSON, err := fs.ReadFile(zr, bundleManifest)
+	if err != nil {
+		return nil, fmt.Errorf("bundle: %w", err)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("bundle: manifest: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > bundleVersion {
+		return nil, fmt.Errorf("bundle: unsupported version %d", manifest.Version)
+	}
+
+	// Every file must be in the manifest with its hash, and nothing else
+	// may be in the archive.
+	listed := make(map[string]bool, len(manifest.Files))
+	var errs []error
+	for _, f := range manifest.Files {
+		listed[path.Join(bundleDir, f.Path)] = true
+		src, err := fs.ReadFile(zr, path.Join(bundleDir, f.Path))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bundle: %w", err))
+			continue
+		}
+		if sum := sha256.Sum256(src); hex.EncodeToString(sum[:]) != f.SHA256 {
+			errs = append(errs, fmt.Errorf("bundle: %s does not match the manifest", f.Path))
+		}
+	}
+	for _, f := range zr.File {
+		if f.Name != bundleManifest && !listed[f.Name] {
+			errs = append(errs, fmt.Errorf("bundle: %s is not in the manifest", f.Name))
+		}
+	}
+	if bundleFingerprint(manifest.Files) != manifest.Fingerprint {
+		errs = append(errs, errors.New("bundle: fingerprint does not match the manifest"))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return fs.Sub(zr, bundleDir)
+}
+
+// bundleFingerprint hashes the paths and hashes of files, so it is the same
+// for identical trees wherever they are.
+func bundleFingerprint(files []BundleFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		io.WriteString(h, f.Path+"\x00"+f.SHA256+"\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// relativePath returns file relative to TemplateDir, with forward slashes;
+// with several TemplateDirs, relative to the one it is in.
+func (ren *Render) relativePath(file string) string {
+	if rel, ok := ren.relativeTo(file); ok {
+		return filepath.ToSlash(rel)
+	}
+	if rel, err := filepath.Rel(ren.currentTemplateDir(), file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(file)
+}
+
+// relativeAnalysis returns a with the file paths relative to TemplateDir,
+// so the manifest doesn't depend on where the tree was exported from.
+func (ren *Render) relativeAnalysis(a Analysis) Analysis {
+	for i, p := range a.Partials {
+		a.Partials[i] = ren.relativePath(filepath.FromSlash(p))
+	}
+	if a.Variants != nil {
+		variants := make(map[string][]string, len(a.Variants))
+		for base, files := range a.Variants {
+			rel := make([]string, len(files))
+			for i, f := range files {
+				rel[i] = ren.relativePath(f)
+			}
+			variants[ren.relativePath(base)] = rel
+		}
+		a.Variants = variants
+	}
+	return a
+}
+
+// LoadBundle makes ren read its templates from the zip archive at file
+// instead of from TemplateDir: the archive holds the contents of TemplateDir,
+// with the paths of the files relative to it, so pages and partials keep
+// their names. Archives written by ExportBundle are checked against their
+// manifest (see ImportBundle); other archives are used as they are. Call it
+// before LoadLayoutsAndPartials, or use ReloadBundle later on.
+//
+// A corrupt archive, entries with the same name or with paths leaving the
+// archive (absolute, or with "..") are errors, and the bundle is not loaded.
+// A page that is not in the bundle fails to build with an error saying so.
+func (ren *Render) LoadBundle(file string) error {
+	fsys, err := openBundle(file)
+	if err != nil {
+		return err
+	}
+	ren.mu.Lock()
+	ren.bundle, ren.bundleFile = fsys, file
+	ren.mu.Unlock()
+	return nil
+}
+
+// ReloadBundle opens the archive loaded with LoadBundle again, e.g. after it
+// was replaced on disk, and rebuilds the cache from it with WarmReload. When
+// the archive can't be opened or a page fails to build, the current bundle
+// and cache are kept and the error is returned.
+func (ren *Render) ReloadBundle(opts WarmReloadOptions) error {
+	ren.mu.RLock()
+	old, file := ren.bundle, ren.bundleFile
+	ren.mu.RUnlock()
+	if old == nil {
+		return errors.New("no bundle loaded")
+	}
+	fsys, err := openBundle(file)
+	if err != nil {
+		return err
+	}
+	ren.mu.Lock()
+	ren.bundle = fsys
+	ren.mu.Unlock()
+	if err := ren.WarmReload(opts); err != nil {
+		ren.mu.Lock()
+		ren.bundle = old
+		ren.mu.Unlock()
+		ren.dropBase()
+		return err
+	}
+	return nil
+}
+
+// openBundle reads the zip archive file and returns its files.
+func openBundle(file string) (fs.FS, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", file, err)
+	}
+	seen := make(map[string]bool, len(zr.File))
+	var errs []error
+	for _, f := range zr.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		switch {
+		case !fs.ValidPath(name):
+			errs = append(errs, fmt.Errorf("bundle %s: invalid entry name %q", file, f.Name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("bundle %s: duplicate entry %s", file, name))
+		}
+		seen[name] = true
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if seen[bundleManifest] {
+		fsys, err := ImportBundle(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("bundle %s: %w", file, err)
+		}
+		return fsys, nil
+	}
+	return zr, nil
+}
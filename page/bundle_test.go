@@ -0,0 +1,264 @@
+package page
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bundleTemplates are a layout, a partial and two pages, one of them in a
+// subdirectory.
+var bundleTemplates = map[string]string{
+	"base.layout.tmpl":      `{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{template "footer"}}{{end}}`,
+	"footer.partial.tmpl":   `{{define "footer"}}<footer>f</footer>{{end}}`,
+	"home.page.tmpl":        `{{template "base" .}}{{define "content"}}home {{.}}{{end}}`,
+	"admin/users.page.tmpl": `{{template "base" .}}{{define "content"}}users {{.}}{{end}}`,
+}
+
+func exportBundle(t *testing.T, ren *Render) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ren.ExportBundle(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Exports of identical trees are byte-identical, wherever the trees are.
+func TestExportBundleDeterministic(t *testing.T) {
+	first := exportBundle(t, newTestRender(t, writeTemplates(t, bundleTemplates)))
+	second := exportBundle(t, newTestRender(t, writeTemplates(t, bundleTemplates)))
+	if !bytes.Equal(first, second) {
+		t.Error("two exports of the same tree differ")
+	}
+
+	changed := map[string]string{}
+	for name, src := range bundleTemplates {
+		changed[name] = src
+	}
+	changed["home.page.tmpl"] += " "
+	if bytes.Equal(first, exportBundle(t, newTestRender(t, writeTemplates(t, changed)))) {
+		t.Error("exports of different trees are identical")
+	}
+}
+
+// A bundle imported again holds every file of the tree, and a Render
+// loading it renders the pages as from the tree.
+func TestBundleRoundTrip(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, bundleTemplates))
+	data := exportBundle(t, ren)
+
+	fsys, err := ImportBundle(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range bundleTemplates {
+		if got, err := fs.ReadFile(fsys, name); err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "templates.zip")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bundled := New()
+	bundled.TemplateDir = t.TempDir() // Empty: every file comes from the bundle.
+	if err := bundled.LoadBundle(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundled.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []string{"home.page.tmpl", "admin/users.page.tmpl"} {
+		want, err := ren.String(page, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := bundled.String(page, "x"); err != nil || got != want {
+			t.Errorf("%s from the bundle: got %q, %v; want %q", page, got, err, want)
+		}
+	}
+}
+
+// ImportBundle rejects an archive whose files don't match its manifest.
+func TestImportBundleTampered(t *testing.T) {
+	data := exportBundle(t, newTestRender(t, writeTemplates(t, bundleTemplates)))
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrite := func(change func(name string, content []byte) []byte, extra string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeBundleEntry(zw, f.Name, change(f.Name, content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if extra != "" {
+			if err := writeBundleEntry(zw, extra, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	same := func(name string, content []byte) []byte { return content }
+
+	if _, err := ImportBundle(bytes.NewReader(rewrite(same, ""))); err != nil {
+		t.Fatalf("unchanged bundle: %v", err)
+	}
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"changed file", rewrite(func(name string, content []byte) []byte {
+			if name == "templates/home.page.tmpl" {
+				return append(content, '!')
+			}
+			return content
+		}, ""), "home.page.tmpl does not match the manifest"},
+		{"extra file", rewrite(same, "templates/evil.page.tmpl"), "evil.page.tmpl is not in the manifest"},
+		{"not a zip", []byte("not a zip"), "zip"},
+	}
+	for _, tt := range tests {
+		if _, err := ImportBundle(bytes.NewReader(tt.archive)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// writeZip writes a zip archive of entries, name and content pairs in
+// order, and returns its path.
+func writeZip(t *testing.T, entries ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < len(entries); i += 2 {
+		if err := writeBundleEntry(zw, entries[i], []byte(entries[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "templates.zip")
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadBundleErrors(t *testing.T) {
+	corrupt := filepath.Join(t.TempDir(), "corrupt.zip")
+	if err := os.WriteFile(corrupt, []byte("PK\x03\x04 not really a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file, want string
+	}{
+		{"corrupt", corrupt, "zip"},
+		{"missing", filepath.Join(t.TempDir(), "missing.zip"), "no such file"},
+		{"duplicate", writeZip(t, "home.page.tmpl", "a", "home.page.tmpl", "b"), "duplicate entry home.page.tmpl"},
+		{"parent", writeZip(t, "../home.page.tmpl", "a"), "invalid entry name"},
+		{"absolute", writeZip(t, "/etc/home.page.tmpl", "a"), "invalid entry name"},
+	}
+	for _, tt := range tests {
+		ren := New()
+		ren.TemplateDir = t.TempDir()
+		err := ren.LoadBundle(tt.file)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.want)
+		}
+		if ren.bundle != nil {
+			t.Errorf("%s: the bundle was loaded", tt.name)
+		}
+	}
+}
+
+// A page that is not in the bundle fails with an error saying so, even when
+// TemplateDir has it.
+func TestBundleMissingPage(t *testing.T) {
+	ren := New()
+	ren.TemplateDir = writeTemplates(t, map[string]string{"about.page.tmpl": `about on disk`})
+	if err := ren.LoadBundle(writeZip(t, "home.page.tmpl", `home`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "home" {
+		t.Fatalf("home: got %q, %v", got, err)
+	}
+	_, err := ren.String("about.page.tmpl", nil)
+	if err == nil || !strings.Contains(err.Error(), "about.page.tmpl is not in the bundle") {
+		t.Errorf("about: error %v", err)
+	}
+}
+
+// ReloadBundle serves the archive swapped in on disk, and keeps the old one
+// when the new one is broken.
+func TestReloadBundle(t *testing.T) {
+	file := writeZip(t, "base.layout.tmpl", `{{define "base"}}v1 {{template "content"}}{{end}}`, "home.page.tmpl", `{{template "base"}}{{define "content"}}home{{end}}`)
+	ren := New()
+	ren.TemplateDir = t.TempDir()
+	ren.UseCache = true
+	if err := ren.LoadBundle(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ren.LoadLayoutsAndPartials([]string{".layout"}); err != nil {
+		t.Fatal(err)
+	}
+	render := func() string {
+		t.Helper()
+		got, err := ren.String("home.page.tmpl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := render(); got != "v1 home" {
+		t.Fatalf("got %q", got)
+	}
+
+	swap := func(src string) {
+		t.Helper()
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	swap(writeZip(t, "base.layout.tmpl", `{{define "base"}}v2 {{template "content"}}{{end}}`, "home.page.tmpl", `{{template "base"}}{{define "content"}}home{{end}}`))
+	if err := ren.ReloadBundle(WarmReloadOptions{FileTypes: []string{".layout"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "v2 home" {
+		t.Errorf("after ReloadBundle: got %q", got)
+	}
+
+	swap(writeZip(t, "base.layout.tmpl", `{{define "base"}}v3 {{template "content"}}{{end}}`, "home.page.tmpl", `{{template "base"}`))
+	if err := ren.ReloadBundle(WarmReloadOptions{FileTypes: []string{".layout"}}); err == nil {
+		t.Error("ReloadBundle of a broken page succeeded")
+	}
+	if got := render(); got != "v2 home" {
+		t.Errorf("after a failed ReloadBundle: got %q", got)
+	}
+}
@@ -0,0 +1,40 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// CacheBypassHeader is the request header that makes ShowRequest build the
+// page from disk for that request alone, when AllowCacheBypass is set. Any
+// value will do, e.g. "X-Template-Nocache: 1".
+const CacheBypassHeader = "X-Template-Nocache"
+
+// bypassCache reports whether the request r asks for its page to be built
+// from disk, and AllowCacheBypass lets it.
+func (ren *Render) bypassCache(r *http.Request) bool {
+	return ren.AllowCacheBypass && r.Header.Get(CacheBypassHeader) != ""
+}
+
+// bypassSet builds the set of the page t from disk for one request of
+// ShowRequest, with the functions of hints bound. The set is not cached and
+// the cached set of t, if any, is left as it is. The partials are read
+// again too: the parsed base of partialSet is dropped, so sets built for the
+// cache later read them again as well.
+func (ren *Render) bypassSet(t string, hints *responseHints) (*template.Template, error) {
+	ren.dropBase()
+	set, err := ren.parseSet(t, ren.partials())
+	if err != nil {
+		return nil, err
+	}
+	if ren.Debug {
+		log.Println("Built", t, "from disk for one request, bypassing the cache")
+	}
+	// The set is the request's own, so the hint functions are bound to it
+	// rather than to a copy.
+	if set.proto != nil {
+		return set.tmpl.Funcs(hints.funcs()), nil
+	}
+	return set.tmpl, nil
+}
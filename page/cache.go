@@ -0,0 +1,180 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"slices"
+	"sync/atomic"
+)
+
+// ClearCache empties the template cache in one step, e.g. from an admin
+// endpoint after new template files were copied in place: every page is built
+// again from its files on its next render. It is safe to call while pages
+// are rendered. Renders running at the time finish with the sets they
+// started with, and sets built from files read before the call are not
+// cached, so no render after it is served from a set of the old files.
+// Partials are kept; call LoadLayoutsAndPartials for new or removed ones.
+func (ren *Render) ClearCache() {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	pages := ren.cachedPagesLocked()
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	ren.pageAliases = nil
+	if ren.Debug {
+		log.Println("Template cache cleared")
+	}
+	if len(pages) > 0 {
+		ren.publish(TemplateEvent{Type: TemplateInvalidated, Pages: pages})
+	}
+}
+
+// CachedTemplates returns the names of the pages with a cached template set,
+// sorted, e.g. ["about.page.tmpl" "home.page.tmpl"]. Sets dropped for
+// MaxCachedTemplates, or because their files changed, are not listed.
+func (ren *Render) CachedTemplates() []string {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return ren.cachedPagesLocked()
+}
+
+// Invalidate drops the cached set of the page name (a short name or an alias
+// is resolved as for Show), so it is built again from its files on its next
+// render, and reports whether it was cached. Like ClearCache, it is safe to
+// call while pages are rendered; builds running at the time are not cached.
+func (ren *Render) Invalidate(name string) bool {
+	t, err := ren.pageName(name)
+	if err != nil {
+		t = name
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	_, cached := ren.cache[t]
+	delete(ren.cache, t)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	if ren.Debug {
+		log.Println("Template", t, "invalidated")
+	}
+	if cached {
+		ren.publish(TemplateEvent{Type: TemplateInvalidated, Path: t, Pages: []string{t}})
+	}
+	return cached
+}
+
+// cacheSnapshot is a copy of the cache that renders look up cached sets in
+// without taking ren.mu. It is never changed once taken: every change to
+// the cache, Partials or Theme under the lock drops it (ren.snapshot is set
+// to nil), and the next render takes a new one. Writes are rare next to
+// renders, so copying the map then costs less than a lock on every render.
+type cacheSnapshot struct {
+	pages       map[string]snapshotPage
+	partialsKey uint64   // partialsKey of partials and theme.
+	partials    []string // Copy of Partials when taken.
+	theme       string   // Theme when taken.
+}
+
+// snapshotPage is what a snapshot holds of a cached page: its set, and what
+// renders look up next to it.
+type snapshotPage struct {
+	set         *template.Template
+	partialsKey uint64             // partialsKey the set was built with.
+	fingerprint string             // See fingerprint.
+	proto       *template.Template // See Render.protos.
+	keyed       bool               // See Render.keyed.
+}
+
+// current reports whether Partials and Theme are still those snap was taken
+// with. They differ only after a direct assignment, which doesn't drop the
+// snapshot.
+func (snap *cacheSnapshot) current(ren *Render) bool {
+	ren.partialsMu.RLock()
+	defer ren.partialsMu.RUnlock()
+	return ren.Theme == snap.theme && slices.Equal(ren.Partials, snap.partials)
+}
+
+// cachedSet returns the cached set of the page t, without taking ren.mu
+// when the snapshot of the cache is current. A set built with other partials
+// or another theme than the current ones is dropped instead; see
+// partialsChanged.
+func (ren *Render) cachedSet(t string) (*template.Template, bool) {
+	snap := ren.snapshot.Load()
+	if snap != nil && !snap.current(ren) {
+		ren.snapshot.CompareAndSwap(snap, nil)
+		snap = nil
+	}
+	if snap == nil {
+		snap = ren.takeSnapshot()
+	}
+	p, ok := snap.pages[t]
+	if !ok {
+		return nil, false
+	}
+	if p.partialsKey != snap.partialsKey {
+		ren.partialsChanged(t, p.set)
+		return nil, false
+	}
+	return p.set, true
+}
+
+// cachedPage returns what the snapshot of the cache holds of the page t, or
+// false when no snapshot was taken since the cache last changed or t is not
+// cached. Lookups of what is kept next to a set try it before ren.mu.
+func (ren *Render) cachedPage(t string) (snapshotPage, bool) {
+	snap := ren.snapshot.Load()
+	if snap == nil {
+		return snapshotPage{}, false
+	}
+	p, ok := snap.pages[t]
+	return p, ok
+}
+
+// registrySizes are the sizes of the maps a render looks its page up in
+// besides the cache. They are stored under ren.mu whenever one of the maps
+// changes, and read without it: renders skip the lock for the maps that are
+// empty, so a site that uses no aliases, AddTemplateString, Disable or
+// Deprecate renders a cached page without taking ren.mu at all.
+type registrySizes struct {
+	aliases, stringPages, disabled, deprecations atomic.Int32
+}
+
+// countRegistriesLocked stores the sizes of the maps of ren in ren.sizes.
+// The caller must hold ren.mu.
+func (ren *Render) countRegistriesLocked() {
+	ren.sizes.aliases.Store(int32(len(ren.aliases)))
+	ren.sizes.stringPages.Store(int32(len(ren.stringPages)))
+	ren.sizes.disabled.Store(int32(len(ren.disabled)))
+	ren.sizes.deprecations.Store(int32(len(ren.deprecations)))
+}
+
+// takeSnapshot copies the cache into a new snapshot and stores it. It is
+// stored under the read lock, so a writer can't drop the snapshot between
+// the copy and the store.
+func (ren *Render) takeSnapshot() *cacheSnapshot {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	if snap := ren.snapshot.Load(); snap != nil {
+		return snap
+	}
+	snap := &cacheSnapshot{
+		pages:       make(map[string]snapshotPage, len(ren.cache)),
+		partialsKey: partialsKey(ren.Partials, ren.Theme),
+		partials:    slices.Clone(ren.Partials),
+		theme:       ren.Theme,
+	}
+	for t, tmpl := range ren.cache {
+		snap.pages[t] = snapshotPage{
+			set:         tmpl,
+			partialsKey: ren.partialsKeys[t],
+			fingerprint: ren.fingerprints[t],
+			proto:       ren.protos[t],
+			keyed:       ren.keyed[t],
+		}
+	}
+	ren.snapshot.Store(snap)
+	return snap
+}
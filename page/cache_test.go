@@ -0,0 +1,198 @@
+package page
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchTemplates are a layout, a partial and a page, as a small site has.
+var benchTemplates = map[string]string{
+	"base.layout.tmpl":    `{{define "base"}}<html><body>{{block "content" .}}{{end}}{{template "footer" .}}</body></html>{{end}}`,
+	"footer.partial.tmpl": `{{define "footer"}}<footer>{{.Title}}</footer>{{end}}`,
+	"home.page.tmpl":      `{{template "base" .}}{{define "content"}}<h1>{{.Title}}</h1>{{range .Items}}<p>{{.}}</p>{{end}}{{end}}`,
+}
+
+// benchData is the template data of the home page of benchTemplates.
+var benchData = map[string]any{"Title": "Home", "Items": []string{"one", "two", "three"}}
+
+// newWarmRender returns a Render for benchTemplates with UseCache and the
+// home page in the cache.
+func newWarmRender(b *testing.B) *Render {
+	b.Helper()
+	ren := newTestRender(b, writeTemplates(b, benchTemplates))
+	ren.UseCache = true
+	if _, err := ren.String("home.page.tmpl", benchData); err != nil {
+		b.Fatal(err)
+	}
+	return ren
+}
+
+// A cache hit reads the snapshot of the cache without taking the lock.
+func BenchmarkShowRequestWarm(b *testing.B) {
+	ren := newWarmRender(b)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ren.ShowRequest(httptest.NewRecorder(), r, "home.page.tmpl", benchData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Warm renders on every CPU at once don't wait for each other.
+func BenchmarkShowRequestWarmParallel(b *testing.B) {
+	ren := newWarmRender(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for pb.Next() {
+			if err := ren.ShowRequest(httptest.NewRecorder(), r, "home.page.tmpl", benchData); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkBuildTemplateHit(b *testing.B) {
+	ren := newWarmRender(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ren.buildTemplate("home.page.tmpl"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// A render of a cached page doesn't take ren.mu: it finishes while a writer
+// holds the lock.
+func TestWarmRenderWithoutLock(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, benchTemplates))
+	ren.UseCache = true
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 2; i++ {
+		if err := ren.ShowRequest(httptest.NewRecorder(), r, "home.page.tmpl", benchData); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	done := make(chan error, 1)
+	go func() {
+		if err := ren.ShowRequest(httptest.NewRecorder(), r, "home.page.tmpl", benchData); err != nil {
+			done <- err
+			return
+		}
+		_, err := ren.String("home.page.tmpl", benchData)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a warm render waited for ren.mu")
+	}
+}
+
+// Every change of the cache drops the snapshot: a render right after it
+// must not be served the set of before.
+func TestCacheSnapshotDropped(t *testing.T) {
+	dir := writeTemplates(t, benchTemplates)
+	ren := newTestRender(t, dir)
+	ren.UseCache = true
+	ren.AddFunc("shout", func(s string) string { return s + "!" })
+	render := func() string {
+		t.Helper()
+		got, err := ren.String("home.page.tmpl", benchData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	// The second render is served from the snapshot taken after the first.
+	for i := 0; i < 2; i++ {
+		if got := render(); got != "<html><body><h1>Home</h1><p>one</p><p>two</p><p>three</p><footer>Home</footer></body></html>" {
+			t.Fatalf("render %d: got %q", i, got)
+		}
+	}
+
+	if err := ren.AddPartialString("footer.partial.tmpl", `{{define "footer"}}<footer>{{shout .Title}}</footer>{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "<html><body><h1>Home</h1><p>one</p><p>two</p><p>three</p><footer>Home!</footer></body></html>" {
+		t.Errorf("after AddPartialString: got %q", got)
+	}
+}
+
+// Partials assigned directly, without SetPartials, don't drop the snapshot;
+// a render after it still builds the page with the new list.
+func TestCacheSnapshotPartialsAssigned(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"a.partial.tmpl": `{{define "p"}}A{{end}}`,
+		"b.partial.tmpl": `{{define "p"}}B{{end}}`,
+		"home.page.tmpl": `[{{template "p"}}]`,
+	})
+	ren := New()
+	ren.TemplateDir = dir
+	ren.UseCache = true
+	ren.Partials = []string{filepath.Join(dir, "a.partial.tmpl")}
+	for i := 0; i < 2; i++ {
+		if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[A]" {
+			t.Fatalf("render %d: got %q, %v", i, got, err)
+		}
+	}
+
+	ren.Partials = []string{filepath.Join(dir, "b.partial.tmpl")}
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[B]" {
+		t.Errorf("after assigning Partials: got %q, %v", got, err)
+	}
+}
+
+// A Render declared as a struct literal, as in main.go, or as a zero value,
+// has no TemplateMap and still caches, lists and drops its sets.
+func TestZeroValueRender(t *testing.T) {
+	dir := writeTemplates(t, benchTemplates)
+	literal := Render{TemplateDir: dir, UseCache: true}
+	if err := literal.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	var zero Render
+	zero.TemplateDir = dir
+	zero.UseCache = true
+	zero.Partials = []string{filepath.Join(dir, "base.layout.tmpl"), filepath.Join(dir, "footer.partial.tmpl")}
+
+	const want = "<html><body><h1>Home</h1><p>one</p><p>two</p><p>three</p><footer>Home</footer></body></html>"
+	for name, ren := range map[string]*Render{"literal": &literal, "zero": &zero} {
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			if err := ren.Show(rec, "home.page.tmpl", benchData); err != nil || rec.Body.String() != want {
+				t.Fatalf("%s: render %d: got %q, %v", name, i, rec.Body.String(), err)
+			}
+		}
+		if got := ren.CachedTemplates(); len(got) != 1 || got[0] != "home.page.tmpl" {
+			t.Errorf("%s: CachedTemplates = %q", name, got)
+		}
+		if ren.TemplateMap != nil {
+			t.Errorf("%s: TemplateMap was written", name)
+		}
+		if !ren.Invalidate("home") {
+			t.Errorf("%s: Invalidate(home) = false", name)
+		}
+		if _, err := ren.String("home.page.tmpl", benchData); err != nil {
+			t.Fatal(err)
+		}
+		ren.ClearCache()
+		if got := ren.CachedTemplates(); len(got) != 0 {
+			t.Errorf("%s: after ClearCache, CachedTemplates = %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package page
+
+import (
+	"html/template"
+	"text/template/parse"
+)
+
+// canaryURL is the start of every canary string. It is a harmless absolute
+// URL, so any ZgotmplZ in canary output comes from the context a value is
+// used in and not from the value itself.
+const canaryURL = "https://canary.invalid/"
+
+// canaryNode describes the synthetic data a template expects at one point:
+// the fields (or map keys) it reads below it and whether it is ranged over.
+type canaryNode struct {
+	fields map[string]*canaryNode
+	list   bool
+}
+
+// child returns the node for the field or key name, creating it when needed.
+func (c *canaryNode) child(name string) *canaryNode {
+	if c.fields == nil {
+		c.fields = make(map[string]*canaryNode)
+	}
+	if c.fields[name] == nil {
+		c.fields[name] = &canaryNode{}
+	}
+	return c.fields[name]
+}
+
+// value builds the synthetic data for the node. Leaves become a canary string
+// naming their path, nodes with fields a map[string]any and nodes that are
+// ranged over a slice holding one such element.
+func (c *canaryNode) value(path string) any {
+	var v any = canaryURL + path
+	if len(c.fields) > 0 {
+		m := make(map[string]any, len(c.fields))
+		for name, f := range c.fields {
+			m[name] = f.value(path + "." + name)
+		}
+		v = m
+	}
+	if c.list {
+		return []any{v}
+	}
+	return v
+}
+
+// canaryData builds synthetic data for executing the template t of the set
+// tmpl: every field chain (.Data.Title), every index with string keys
+// (index .Data "payload") and every range pipe found in the templates that
+// t reaches gets a value, so the whole page executes with canary strings.
+func canaryData(tmpl *template.Template, t string) any {
+	return dataUsage(tmpl, t).value("")
+}
+
+// dataUsage returns the data the template t of the set tmpl reads, as found
+// by walking the templates t reaches.
+func dataUsage(tmpl *template.Template, t string) *canaryNode {
+	w := canaryWalker{set: tmpl, root: &canaryNode{}, visiting: map[string]bool{}}
+	if entry := tmpl.Lookup(t); entry != nil && entry.Tree != nil {
+		w.walk(entry.Tree.Root, w.root)
+	}
+	return w.root
+}
+
+// canaryWalker walks parse trees, recording in root what the data must hold.
+type canaryWalker struct {
+	set      *template.Template
+	root     *canaryNode
+	visiting map[string]bool
+}
+
+// walk records the data used by node, with dot describing the value of dot.
+func (w *canaryWalker) walk(node parse.Node, dot *canaryNode) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			w.walk(c, dot)
+		}
+	case *parse.ActionNode:
+		w.pipe(n.Pipe, dot)
+	case *parse.IfNode:
+		w.pipe(n.Pipe, dot)
+		w.walk(n.List, dot)
+		w.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		elem := w.pipe(n.Pipe, dot)
+		if elem == nil {
+			elem = &canaryNode{}
+		} else {
+			elem.list = true
+		}
+		w.walk(n.List, elem)
+		w.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		value := w.pipe(n.Pipe, dot)
+		if value == nil {
+			value = &canaryNode{}
+		}
+		w.walk(n.List, value)
+		w.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		arg := &canaryNode{}
+		if n.Pipe != nil {
+			if v := w.pipe(n.Pipe, dot); v != nil {
+				arg = v
+			}
+		}
+		called := w.set.Lookup(n.Name)
+		if called == nil || called.Tree == nil || w.visiting[n.Name] {
+			return
+		}
+		w.visiting[n.Name] = true
+		w.walk(called.Tree.Root, arg)
+		delete(w.visiting, n.Name)
+	}
+}
+
+// pipe records the data used by a pipeline and returns the node describing
+// its result, or nil when the result isn't data (e.g. a function's result).
+func (w *canaryWalker) pipe(p *parse.PipeNode, dot *canaryNode) *canaryNode {
+	if p == nil {
+		return nil
+	}
+	var result *canaryNode
+	for _, cmd := range p.Cmds {
+		result = nil
+		for _, arg := range cmd.Args {
+			if sub, ok := arg.(*parse.PipeNode); ok {
+				w.pipe(sub, dot)
+			}
+		}
+		if len(cmd.Args) == 0 {
+			continue
+		}
+		// {{index .Data "payload"}}: a map lookup with string keys.
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && id.Ident == "index" && len(cmd.Args) > 1 {
+			node := w.resolve(cmd.Args[1], dot)
+			for _, key := range cmd.Args[2:] {
+				s, ok := key.(*parse.StringNode)
+				if node == nil || !ok {
+					node = nil
+					break
+				}
+				node = node.child(s.Text)
+			}
+			result = node
+			continue
+		}
+		for _, arg := range cmd.Args {
+			node := w.resolve(arg, dot)
+			if len(cmd.Args) == 1 {
+				result = node
+			}
+		}
+	}
+	return result
+}
+
+// resolve returns the node for a field chain, dot or $ argument.
+func (w *canaryWalker) resolve(arg parse.Node, dot *canaryNode) *canaryNode {
+	node, fields := dot, []string(nil)
+	switch a := arg.(type) {
+	case *parse.DotNode:
+	case *parse.FieldNode:
+		fields = a.Ident
+	case *parse.VariableNode:
+		if a.Ident[0] != "$" {
+			return nil
+		}
+		node, fields = w.root, a.Ident[1:]
+	default:
+		return nil
+	}
+	for _, f := range fields {
+		node = node.child(f)
+	}
+	return node
+}
@@ -0,0 +1,214 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"maps"
+	"slices"
+)
+
+// Clone returns a copy of ren that can be changed without affecting ren or any
+// other clone. This is meant for multi-tenant setups: configure one Render,
+// then Clone it per tenant and add the tenant's own functions and data.
+//
+// Isolation guarantees:
+//   - Functions, GlobalData and Partials are copied, so AddFunc, changes to
+//     GlobalData and changes to Partials on the clone never reach the parent
+//     or a sibling clone (and vice versa).
+//   - The components of RegisterComponent are copied too, and the clone
+//     renders them with its own functions.
+//   - The clone starts with its own, empty cache. Template sets are
+//     built with the function map of the Render that builds them, so a set
+//     cached by one Render is never executed by another.
+//
+// What the clone gets of each field:
+//   - Copied: every other exported setting, and the slices and maps among
+//     them (Extensions, Quotas, SurrogateKeys, ...) as new ones; the pages
+//     of AddTemplateString and AddPartialString, the aliases, the merged
+//     sources of RegisterSource, the partial sets of UsePartialSet, the file
+//     types of the last LoadLayoutsAndPartials and the probed image sizes.
+//   - Copied as newly registered: RegisterRemote sources (without the
+//     fetched copies, and with their fallbacks parsed by the clone),
+//     Deprecate notes, Limit limits and Disable switches, without the
+//     counts and waiting requests of ren.
+//   - Shared: what the settings point to, as assigned. The values stored
+//     in GlobalData and DebugFixtures, the Models map, Coverage, Metrics,
+//     the Loader, TemplateFS and the callbacks are the parent's; a pointer
+//     or map value is shared with the parent. So is the bundle of
+//     LoadBundle.
+//   - Not copied: the cache and everything derived from it, the stats, the
+//     subscribers of Subscribe, what Start left running, the queues of the
+//     async Audit policies, the tenants of AddTenant, the data versions of
+//     InvalidateDataVersion, TemplateMap and DiskCacheDir.
+//
+// DiskCacheDir is not copied, for the same reason the cache isn't: give each
+// clone its own directory if it should cache rendered pages on disk.
+// DiskCachePages and the other disk cache settings are copied.
+func (ren *Render) Clone() *Render {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+
+	clone := &Render{
+		TemplateDir:  ren.currentTemplateDir(),
+		TemplateFS:   ren.TemplateFS,
+		Loader:       ren.Loader,
+		LoaderPoll:   ren.LoaderPoll,
+		WatchPoll:    ren.WatchPoll,
+		Functions:    make(template.FuncMap, len(ren.Functions)),
+		UseCache:     ren.UseCache,
+		Partials:     append([]string(nil), ren.Partials...),
+		GlobalData:   make(map[string]any, len(ren.GlobalData)),
+		Environment:  ren.Environment,
+		Locale:       ren.Locale,
+		SetHTMLLang:  ren.SetHTMLLang,
+		Behavior:     ren.Behavior,
+		Watermark:    ren.Watermark,
+		Debug:        ren.Debug,
+		bundle:       ren.bundle,
+		bundleFile:   ren.bundleFile,
+		partialSets:  append([]*usedPartialSet(nil), ren.partialSets...),
+		partialTypes: append([]string(nil), ren.partialTypes...),
+		stringPages:  make(map[string]string, len(ren.stringPages)),
+		components:   maps.Clone(ren.components),
+		aliases:      make(map[string]string, len(ren.aliases)),
+		registry:     maps.Clone(ren.registry),
+		sourcePages:  maps.Clone(ren.sourcePages),
+
+		SourceTransforms: append([]SourceTransform(nil), ren.SourceTransforms...),
+		TemplateDirs:     append([]string(nil), ren.TemplateDirs...),
+		stringPartials:   append([]stringPartial(nil), ren.stringPartials...),
+		Theme:            ren.Theme,
+		DisableBuiltins:  ren.DisableBuiltins,
+		Extensions:       append([]string(nil), ren.Extensions...),
+		Exclude:          append([]string(nil), ren.Exclude...),
+		Ignore:           slices.Clone(ren.Ignore),
+		FollowSymlinks:   ren.FollowSymlinks,
+		MaxFilesScanned:  ren.MaxFilesScanned,
+		MaxDepth:         ren.MaxDepth,
+		Deterministic:    ren.Deterministic,
+		Clock:            ren.Clock,
+		GeneratedNames:   append([]string(nil), ren.GeneratedNames...),
+		Models:           ren.Models,
+		LimitWait:        ren.LimitWait,
+
+		AssetDir:       ren.AssetDir,
+		AssetURL:       ren.AssetURL,
+		ImageDensities: append([]int(nil), ren.ImageDensities...),
+		ImageVariant:   ren.ImageVariant,
+		imageSizes:     make(map[string]imageSize, len(ren.imageSizes)),
+
+		TemplateHeaders: append([]string(nil), ren.TemplateHeaders...),
+		JSONMarshaler:   ren.JSONMarshaler,
+		Coverage:        ren.Coverage,
+
+		EnableCompression: ren.EnableCompression,
+		Encoders:          append([]Encoder(nil), ren.Encoders...),
+		CompressionLevel:  ren.CompressionLevel,
+		CompressMinSize:   ren.CompressMinSize,
+		NeverCompress:     append([]string(nil), ren.NeverCompress...),
+		Coalesce:          append([]string(nil), ren.Coalesce...),
+		Quotas:            make(map[string]Quota, len(ren.Quotas)),
+		TenantKey:         ren.TenantKey,
+		DebugFixtures:     make(map[string]any, len(ren.DebugFixtures)),
+		DebugAuthorize:    ren.DebugAuthorize,
+		DebugAudit:        ren.DebugAudit,
+		DiskCachePages:    append([]string(nil), ren.DiskCachePages...),
+		DiskCacheMaxBytes: ren.DiskCacheMaxBytes,
+		DiskCacheTTL:      ren.DiskCacheTTL,
+		DiskCacheGrace:    ren.DiskCacheGrace,
+		MaxBufferSize:     ren.MaxBufferSize,
+		MaxRenderBytes:    ren.MaxRenderBytes,
+		TraceBlocks:       ren.TraceBlocks,
+		ProfileFuncs:      ren.ProfileFuncs,
+		CaptureFailures:   ren.CaptureFailures,
+		Redact:            ren.Redact,
+
+		SurrogateKeys:      make(map[string][]string, len(ren.SurrogateKeys)),
+		SurrogateKeyHeader: ren.SurrogateKeyHeader,
+		Audit:              make(map[string]AuditPolicy, len(ren.Audit)),
+		ThemeResolver:      ren.ThemeResolver,
+		ThemeClass:         ren.ThemeClass,
+
+		MaxCachedTemplates: ren.MaxCachedTemplates,
+		OnEvict:            ren.OnEvict,
+		Metrics:            ren.Metrics,
+		CheckModTime:       ren.CheckModTime,
+		AllowCacheBypass:   ren.AllowCacheBypass,
+		OnCacheMiss:        ren.OnCacheMiss,
+		OnBuild:            ren.OnBuild,
+		DefaultContentType: ren.DefaultContentType,
+		ErrorHandler:       ren.ErrorHandler,
+	}
+	for name, fn := range ren.Functions {
+		clone.Functions[name] = fn
+	}
+	for key, value := range ren.GlobalData {
+		clone.GlobalData[key] = value
+	}
+	for name, src := range ren.stringPages {
+		clone.stringPages[name] = src
+	}
+	for alias, name := range ren.aliases {
+		clone.aliases[alias] = name
+	}
+	for tenant, quota := range ren.Quotas {
+		clone.Quotas[tenant] = quota
+	}
+	for pattern, policy := range ren.Audit {
+		clone.Audit[pattern] = policy
+	}
+	for name, keys := range ren.SurrogateKeys {
+		clone.SurrogateKeys[name] = append([]string(nil), keys...)
+	}
+	for name, td := range ren.DebugFixtures {
+		clone.DebugFixtures[name] = td
+	}
+	for name, e := range ren.remotes {
+		if clone.remotes == nil {
+			clone.remotes = make(map[string]*remoteEntry, len(ren.remotes))
+		}
+		clone.remotes[name] = &remoteEntry{src: e.src}
+	}
+	for name, d := range ren.deprecations {
+		if clone.deprecations == nil {
+			clone.deprecations = make(map[string]*deprecation, len(ren.deprecations))
+		}
+		clone.deprecations[name] = &deprecation{note: d.note}
+	}
+	for name, d := range ren.disabled {
+		if clone.disabled == nil {
+			clone.disabled = make(map[string]*Disabled, len(ren.disabled))
+		}
+		clone.disabled[name] = &Disabled{Fallback: d.Fallback, Until: d.Until}
+	}
+	clone.countRegistriesLocked()
+	ren.limits.copyTo(&clone.limits)
+	// Sizes of an older cacheGen are probed again, see imageSize.
+	if ren.imageSizesGen == ren.cacheGen {
+		for name, size := range ren.imageSizes {
+			clone.imageSizes[name] = size
+		}
+	}
+	return clone
+}
+
+// AddFunc adds (or replaces) the template function name.
+// Template sets already in the cache were built with the old function map,
+// so the cache is replaced by a new, empty one and every page is rebuilt with
+// the new function on its next render.
+func (ren *Render) AddFunc(name string, fn any) {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+
+	if ren.Functions == nil {
+		ren.Functions = template.FuncMap{}
+	}
+	ren.Functions[name] = fn
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+
+	if ren.Debug {
+		log.Println("Added template function", name, "- template cache cleared")
+	}
+}
@@ -0,0 +1,274 @@
+package page
+
+import (
+	"reflect"
+	"testing"
+)
+
+// What Clone does with each field of Render, as its doc states: "copied"
+// fields have the value of the parent in the clone, slices and maps as new
+// ones; "shared" ones have the very value of the parent; "fresh" ones start
+// empty. A field added to Render fails TestCloneFields until it is handled
+// in Clone and listed here.
+var cloneFields = map[string]string{
+	"TemplateDir":        "copied",
+	"TemplateFS":         "shared",
+	"Loader":             "shared",
+	"LoaderPoll":         "copied",
+	"WatchPoll":          "copied",
+	"Functions":          "copied",
+	"UseCache":           "copied",
+	"Partials":           "copied",
+	"TemplateMap":        "fresh",
+	"DisableBuiltins":    "copied",
+	"Environment":        "copied",
+	"GlobalData":         "copied",
+	"Locale":             "copied",
+	"SetHTMLLang":        "copied",
+	"Behavior":           "copied",
+	"Watermark":          "copied",
+	"Debug":              "copied",
+	"CheckModTime":       "copied",
+	"AllowCacheBypass":   "copied",
+	"TemplateDirs":       "copied",
+	"Theme":              "copied",
+	"LimitWait":          "copied",
+	"Models":             "shared",
+	"GeneratedNames":     "copied",
+	"Deterministic":      "copied",
+	"Clock":              "shared",
+	"Extensions":         "copied",
+	"Exclude":            "copied",
+	"Ignore":             "copied",
+	"FollowSymlinks":     "copied",
+	"MaxFilesScanned":    "copied",
+	"MaxDepth":           "copied",
+	"SourceTransforms":   "copied",
+	"AssetDir":           "copied",
+	"AssetURL":           "copied",
+	"ImageDensities":     "copied",
+	"ImageVariant":       "shared",
+	"imageSizes":         "copied",
+	"imageSizesGen":      "fresh",
+	"DiskCacheDir":       "fresh",
+	"DiskCachePages":     "copied",
+	"DiskCacheMaxBytes":  "copied",
+	"DiskCacheTTL":       "copied",
+	"DiskCacheGrace":     "copied",
+	"refreshing":         "fresh",
+	"dataVersions":       "fresh",
+	"TemplateHeaders":    "copied",
+	"JSONMarshaler":      "shared",
+	"Coverage":           "shared",
+	"EnableCompression":  "copied",
+	"Encoders":           "copied",
+	"CompressionLevel":   "copied",
+	"CompressMinSize":    "copied",
+	"NeverCompress":      "copied",
+	"Coalesce":           "copied",
+	"Quotas":             "copied",
+	"TenantKey":          "shared",
+	"DebugFixtures":      "copied",
+	"DebugAuthorize":     "shared",
+	"DebugAudit":         "shared",
+	"CaptureFailures":    "shared",
+	"Redact":             "shared",
+	"TraceBlocks":        "copied",
+	"ProfileFuncs":       "copied",
+	"MaxBufferSize":      "copied",
+	"MaxRenderBytes":     "copied",
+	"MaxCachedTemplates": "copied",
+	"OnEvict":            "shared",
+	"Metrics":            "shared",
+	"OnCacheMiss":        "shared",
+	"OnBuild":            "shared",
+	"SurrogateKeys":      "copied",
+	"SurrogateKeyHeader": "copied",
+	"DefaultContentType": "copied",
+	"ErrorHandler":       "shared",
+	"Audit":              "copied",
+	"ThemeResolver":      "shared",
+	"ThemeClass":         "copied",
+
+	"mu":               "fresh",
+	"cache":            "fresh",
+	"fingerprints":     "fresh",
+	"sourceMaps":       "fresh",
+	"protos":           "fresh",
+	"stats":            "fresh",
+	"life":             "fresh",
+	"quotaSlots":       "fresh",
+	"site":             "fresh",
+	"modTimes":         "fresh",
+	"partialsKeys":     "fresh",
+	"snapshot":         "fresh",
+	"partialsMu":       "fresh",
+	"sizes":            "copied",
+	"base":             "fresh",
+	"baseMu":           "fresh",
+	"parsedComponents": "fresh",
+	"componentMu":      "fresh",
+	"templateDir":      "fresh",
+	"calls":            "fresh",
+	"deprecations":     "copied",
+	"deprecatedUses":   "fresh",
+	"components":       "copied",
+	"sizeHints":        "fresh",
+	"blockTimings":     "fresh",
+	"memory":           "fresh",
+	"funcProfile":      "fresh",
+	"limits":           "copied",
+	"bundle":           "shared",
+	"bundleFile":       "copied",
+	"partialSets":      "copied",
+	"coalescer":        "fresh",
+	"builds":           "fresh",
+	"cacheGen":         "fresh",
+	"lru":              "fresh",
+	"events":           "fresh",
+	"tenants":          "fresh",
+	"partialTypes":     "copied",
+	"loaderChecked":    "fresh",
+	"stringPages":      "copied",
+	"stringPartials":   "copied",
+	"pageAliases":      "fresh",
+	"aliases":          "copied",
+	"unreadable":       "fresh",
+	"remotes":          "copied",
+	"banner":           "fresh",
+	"registry":         "copied",
+	"sourcePages":      "copied",
+	"disabled":         "copied",
+	"keyed":            "fresh",
+	"auditQueues":      "fresh",
+}
+
+// nonZero returns a value of type t that is not the zero value, and false
+// for interfaces, which have no such value of their own.
+func nonZero(t reflect.Type) (reflect.Value, bool) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(t, 1, 1))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		v.SetMapIndex(reflect.New(t.Key()).Elem(), reflect.New(t.Elem()).Elem())
+	case reflect.Func:
+		v.Set(reflect.MakeFunc(t, func([]reflect.Value) []reflect.Value {
+			out := make([]reflect.Value, t.NumOut())
+			for i := range out {
+				out[i] = reflect.New(t.Out(i)).Elem()
+			}
+			return out
+		}))
+	case reflect.Pointer:
+		v.Set(reflect.New(t.Elem()))
+	default:
+		return v, false
+	}
+	return v, true
+}
+
+func TestCloneFields(t *testing.T) {
+	rt := reflect.TypeOf(Render{})
+	seen := make(map[string]bool)
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Name
+		seen[name] = true
+		if _, ok := cloneFields[name]; !ok {
+			t.Errorf("Render.%s is new: handle it in Clone, document it there and list it in cloneFields", name)
+		}
+	}
+	for name := range cloneFields {
+		if !seen[name] {
+			t.Errorf("cloneFields lists %s, which Render doesn't have", name)
+		}
+	}
+
+	// Every exported field that can be given a value is set on the parent,
+	// and checked on the clone.
+	ren := New()
+	parent := reflect.ValueOf(ren).Elem()
+	for i := 0; i < rt.NumField(); i++ {
+		if f := rt.Field(i); f.IsExported() {
+			if v, ok := nonZero(f.Type); ok {
+				parent.Field(i).Set(v)
+			}
+		}
+	}
+	clone := reflect.ValueOf(ren.Clone()).Elem()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		pv, cv := parent.Field(i), clone.Field(i)
+		if pv.IsZero() {
+			continue
+		}
+		switch cloneFields[f.Name] {
+		case "fresh":
+			if !cv.IsZero() {
+				t.Errorf("%s: copied to the clone", f.Name)
+			}
+		case "copied", "shared":
+			if cv.IsZero() {
+				t.Errorf("%s: not copied to the clone", f.Name)
+				continue
+			}
+			if k := f.Type.Kind(); k != reflect.Slice && k != reflect.Map {
+				continue
+			}
+			if cv.Len() != pv.Len() {
+				t.Errorf("%s: %d elements in the clone, want %d", f.Name, cv.Len(), pv.Len())
+			}
+			same := cv.UnsafePointer() == pv.UnsafePointer()
+			if shared := cloneFields[f.Name] == "shared"; same != shared {
+				t.Errorf("%s: shared with the clone is %v, want %v", f.Name, same, shared)
+			}
+		}
+	}
+}
+
+func TestCloneRegistrations(t *testing.T) {
+	ren := New()
+	ren.Deprecate("old.page.tmpl", "use new.page.tmpl")
+	ren.Limit("busy.page.tmpl", 2, 10)
+	if err := ren.Disable("broken.page.tmpl", "sorry.page.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	ren.RegisterRemote("news", RemoteSource{URL: "http://news.example/"})
+	clone := ren.Clone()
+
+	if d := clone.deprecations["old.page.tmpl"]; d == nil || d == ren.deprecations["old.page.tmpl"] || d.note != "use new.page.tmpl" {
+		t.Errorf("deprecation in the clone: %+v", d)
+	}
+	l := clone.limits.limits["busy.page.tmpl"]
+	if l == nil || l == ren.limits.limits["busy.page.tmpl"] || cap(l.slots) != 2 || l.perSecond != 10 {
+		t.Errorf("limit in the clone: %+v", l)
+	}
+	if d := clone.disabled["broken.page.tmpl"]; d == nil || d == ren.disabled["broken.page.tmpl"] || d.Fallback != "sorry.page.tmpl" {
+		t.Errorf("disabled page in the clone: %+v", d)
+	}
+	if e := clone.remotes["news"]; e == nil || e == ren.remotes["news"] || e.src.URL != "http://news.example/" {
+		t.Errorf("remote in the clone: %+v", e)
+	}
+
+	// Changes on the clone stay there.
+	clone.Enable("broken.page.tmpl")
+	clone.Limit("busy.page.tmpl", 0, 0)
+	if _, ok := ren.disabled["broken.page.tmpl"]; !ok {
+		t.Error("Enable on the clone enabled the page of the parent")
+	}
+	if ren.limits.limits["busy.page.tmpl"] == nil {
+		t.Error("Limit on the clone removed the limit of the parent")
+	}
+}
@@ -0,0 +1,113 @@
+package page
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"html/template"
+	"path"
+	"sync"
+	"time"
+)
+
+// coalesceKey identifies renders that produce the same bytes: the same
+// cached set and the same data.
+type coalesceKey struct {
+	set  *template.Template
+	data [sha256.Size]byte
+}
+
+// flight is one execution shared by the renders with the same coalesceKey.
+type flight struct {
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// coalescer holds the executions in flight and the count of the renders
+// that joined one instead of executing, by page.
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[coalesceKey]*flight
+	joined  map[string]int64
+}
+
+// coalesceKeyFor returns the key of a render of t from the set tmpl with td,
+// or false when the render is executed on its own: t is not in Coalesce,
+// tmpl is not the cached set (a copy with per-request functions bound, as
+// for response hints or tracing), or td can't be encoded as JSON.
+func (ren *Render) coalesceKeyFor(tmpl *template.Template, t string, td any) (coalesceKey, bool) {
+	coalesce := false
+	for _, pattern := range ren.Coalesce {
+		if ok, _ := path.Match(pattern, t); ok {
+			coalesce = true
+			break
+		}
+	}
+	if !coalesce {
+		return coalesceKey{}, false
+	}
+	ren.mu.RLock()
+	cached := ren.cache[t]
+	ren.mu.RUnlock()
+	if tmpl != cached {
+		return coalesceKey{}, false
+	}
+	data, err := json.Marshal(td)
+	if err != nil {
+		return coalesceKey{}, false
+	}
+	return coalesceKey{set: tmpl, data: sha256.Sum256(data)}, true
+}
+
+// coalesced returns the result of render for key: the first caller executes
+// it, and callers arriving while it runs wait for it and get a copy of its
+// result, with their own Duration, measured from start.
+func (ren *Render) coalesced(key coalesceKey, t string, start time.Time, render func() (Result, error)) (Result, error) {
+	c := &ren.coalescer
+	c.mu.Lock()
+	if f, ok := c.flights[key]; ok {
+		if c.joined == nil {
+			c.joined = make(map[string]int64)
+		}
+		c.joined[t]++
+		c.mu.Unlock()
+		<-f.done
+		result := f.result
+		result.Body = bytes.Clone(f.result.Body)
+		result.SurrogateKeys = append([]string(nil), f.result.SurrogateKeys...)
+		result.Duration = time.Since(start)
+		return result, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	if c.flights == nil {
+		c.flights = make(map[coalesceKey]*flight)
+	}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	// The flight keeps its own copy: the caller owns the Body it gets.
+	result, err := render()
+	f.result, f.err = result, err
+	f.result.Body = bytes.Clone(result.Body)
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(f.done)
+	return result, err
+}
+
+// snapshot returns the coalesced renders per page, or nil when there were
+// none.
+func (c *coalescer) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.joined) == 0 {
+		return nil
+	}
+	joined := make(map[string]int64, len(c.joined))
+	for t, n := range c.joined {
+		joined[t] = n
+	}
+	return joined
+}
@@ -0,0 +1,130 @@
+package page
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// spike renders home.page.tmpl of ren from n goroutines at once, with the
+// data of goroutine i being data(i), while the page's {{work}} waits for
+// release. It returns the outputs once all renders are done.
+func spike(t *testing.T, ren *Render, n int, data func(i int) any, ready func() bool, release chan struct{}) []string {
+	t.Helper()
+	outs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out, err := ren.String("home.page.tmpl", data(i))
+			if err != nil {
+				t.Error(err)
+			}
+			outs[i] = out
+		}(i)
+	}
+	waitFor(t, "the renders to start", ready)
+	close(release)
+	wg.Wait()
+	return outs
+}
+
+// A spike of identical renders of a page in Coalesce executes the page
+// once; without Coalesce, or with different data, every render executes it.
+func TestCoalesceSpike(t *testing.T) {
+	const n = 100
+	tests := []struct {
+		name      string
+		coalesce  []string
+		sameData  bool
+		wantExecs int64
+	}{
+		{"coalesced", []string{"home.*"}, true, 1},
+		{"not in Coalesce", nil, true, n},
+		{"different data", []string{"home.*"}, false, n},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ren := newTestRender(t, writeTemplates(t, map[string]string{
+				"home.page.tmpl": `{{work}}home {{.}}`,
+			}))
+			ren.UseCache = true
+			ren.Coalesce = tt.coalesce
+			var execs, waiting atomic.Int64
+			release := make(chan struct{})
+			ren.AddFunc("work", func() string {
+				execs.Add(1)
+				waiting.Add(1)
+				<-release
+				return ""
+			})
+			// The set is cached first, so the renders share it.
+			if _, err := ren.buildTemplate("home.page.tmpl"); err != nil {
+				t.Fatal(err)
+			}
+
+			data := func(i int) any {
+				if tt.sameData {
+					return "anonymous"
+				}
+				return fmt.Sprint("user", i)
+			}
+			ready := func() bool {
+				// Renders either execute and wait in {{work}}, or joined
+				// an execution.
+				return waiting.Load()+ren.Stats().Coalesced["home.page.tmpl"] == n
+			}
+			outs := spike(t, ren, n, data, ready, release)
+
+			if got := execs.Load(); got != tt.wantExecs {
+				t.Errorf("page executed %d times for %d renders, want %d", got, n, tt.wantExecs)
+			}
+			if got, want := ren.Stats().Coalesced["home.page.tmpl"], n-tt.wantExecs; got != want {
+				t.Errorf("Stats().Coalesced = %d, want %d", got, want)
+			}
+			for i, out := range outs {
+				if want := fmt.Sprint("home ", data(i)); out != want {
+					t.Fatalf("render %d: got %q, want %q", i, out, want)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkSpike measures spikes of 100 concurrent renders of the large page
+// of largeTemplates with the same data, with the page in Coalesce or not.
+// Renders only coalesce when they overlap, so run it with -cpu 4 or more:
+// with GOMAXPROCS 1 they mostly run one after the other.
+func benchmarkSpike(b *testing.B, coalesce []string) {
+	ren := newTestRender(b, writeTemplates(b, largeTemplates))
+	ren.UseCache = true
+	ren.Coalesce = coalesce
+	items := largeData()[:2000]
+	if _, err := ren.String("large.page.tmpl", items); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < 100; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := ren.String("large.page.tmpl", items); err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+	joined := ren.Stats().Coalesced["large.page.tmpl"]
+	b.ReportMetric(float64(int64(b.N)*100-joined)/float64(b.N), "execs/spike")
+}
+
+func BenchmarkSpike(b *testing.B) { benchmarkSpike(b, nil) }
+
+func BenchmarkSpikeCoalesced(b *testing.B) { benchmarkSpike(b, []string{"large.*"}) }
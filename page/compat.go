@@ -0,0 +1,92 @@
+package page
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Behavior selects earlier behavior of this package where it changed in
+// ways callers can observe. Each flag brings back one old behavior, so a
+// deployment can upgrade the package first and then drop the flags one at a
+// time. The zero value is the current behavior.
+type Behavior uint
+
+const (
+	// StreamingShow makes Show execute the page straight into the
+	// ResponseWriter, as it used to: a page failing halfway leaves the output
+	// written so far, followed by the http.Error text. The post-processing
+	// of Render (SetHTMLLang, Watermark) doesn't apply to streamed pages.
+	StreamingShow Behavior = 1 << iota
+	// RawErrors returns errors as the template package reports them instead
+	// of as a *RenderError.
+	RawErrors
+	// ExecuteString makes String execute the set with Execute, its root
+	// template, instead of going through Render.
+	ExecuteString
+	// ErrorResponses makes Show and the other Show methods answer a page
+	// that fails to render with a 500 and the error text themselves, next
+	// to returning the error, as they used to. Handlers answering the error
+	// too then write a second, superfluous response.
+	ErrorResponses
+
+	// CompatV1 is the behavior of version 1 of this package.
+	CompatV1 = StreamingShow | RawErrors | ExecuteString | ErrorResponses
+)
+
+// compatError returns err as it is with the current behavior, or the error
+// of the template package inside it with RawErrors.
+func (ren *Render) compatError(err error) error {
+	var renderErr *RenderError
+	if ren.Behavior&RawErrors != 0 && errors.As(err, &renderErr) {
+		return renderErr.Err
+	}
+	return err
+}
+
+// showStreaming is show with StreamingShow.
+func (ren *Render) showStreaming(w http.ResponseWriter, status int, header http.Header, t string, td any) error {
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		return err
+	}
+	// The headers go out with the first byte of output.
+	addHeaders(w, header)
+	ren.setContentType(w)
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+	if err := tmpl.ExecuteTemplate(w, t, td); err != nil {
+		err = ren.compatError(renderError(t, ren.sources(t), err))
+		if ren.Debug {
+			log.Println("error executing", err)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	ren.noteDeprecated(t)
+	return nil
+}
+
+// executeString is String with ExecuteString.
+func (ren *Render) executeString(t string, td any) (s string, err error) {
+	if ren.Metrics != nil {
+		defer ren.observeRender(t, time.Now(), &err)
+	}
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		return "", err
+	}
+	// The buffer goes back to the pool of execute, error or not.
+	buf := ren.getBuffer(t)
+	defer ren.putBuffer(t, buf)
+	if err := tmpl.Execute(buf, td); err != nil {
+		return "", ren.compatError(renderError(t, ren.sources(t), err))
+	}
+	ren.noteDeprecated(t)
+	return string(ren.postProcess(tmpl, buf.Bytes())), nil
+}
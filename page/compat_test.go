@@ -0,0 +1,87 @@
+package page
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// compatTemplates have a page with a layout, and one failing halfway when
+// its data has fewer than six items.
+var compatTemplates = map[string]string{
+	"base.layout.tmpl": `{{define "base"}}<html><body>{{block "content" .}}{{end}}</body></html>{{end}}`,
+	"home.page.tmpl":   `{{template "base" .}}{{define "content"}}home{{end}}`,
+	"fail.page.tmpl":   `before {{index . 5}} after`,
+}
+
+func TestCompatShow(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior Behavior
+		page     string
+		// The response: status, body prefix and whether it has the error
+		// text and a Content-Length.
+		code      int
+		prefix    string
+		errorText bool
+		length    bool
+	}{
+		{"current", 0, "home", http.StatusOK, `<html lang="ar" dir="rtl"><body>home`, false, true},
+		{"current failing", 0, "fail", http.StatusOK, "", false, false},
+		{"StreamingShow", StreamingShow, "home", http.StatusOK, "<html><body>home", false, false},
+		// The output so far goes out, then the error text; the status was
+		// written with the first byte.
+		{"StreamingShow failing", StreamingShow, "fail", http.StatusOK, "before ", true, false},
+		{"ErrorResponses failing", ErrorResponses, "fail", http.StatusInternalServerError, "rendering fail.page.tmpl", true, false},
+		{"ErrorResponses missing page", ErrorResponses, "missing", http.StatusOK, "", false, false},
+		{"CompatV1 failing", CompatV1, "fail", http.StatusOK, "before ", true, false},
+	}
+	for _, tt := range tests {
+		ren := newTestRender(t, writeTemplates(t, compatTemplates))
+		ren.SetHTMLLang = true
+		ren.Locale = "ar"
+		ren.Behavior = tt.behavior
+		rec := httptest.NewRecorder()
+		err := ren.Show(rec, tt.page, []int{1})
+		if (err != nil) != (tt.page != "home") {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		body := rec.Body.String()
+		if rec.Code != tt.code || !strings.HasPrefix(body, tt.prefix) || (tt.prefix == "" && body != "") {
+			t.Errorf("%s: got %d %q, want %d %q...", tt.name, rec.Code, body, tt.code, tt.prefix)
+		}
+		if got := err != nil && strings.Contains(body, "index out of range"); got != tt.errorText {
+			t.Errorf("%s: error text in the body: %v, want %v", tt.name, got, tt.errorText)
+		}
+		if got := rec.Header().Get("Content-Length") != ""; got != tt.length {
+			t.Errorf("%s: Content-Length %q", tt.name, rec.Header().Get("Content-Length"))
+		}
+		if strings.Count(body, "index out of range") > 1 {
+			t.Errorf("%s: the error was answered more than once: %q", tt.name, body)
+		}
+	}
+}
+
+func TestCompatString(t *testing.T) {
+	for _, behavior := range []Behavior{0, ExecuteString, RawErrors, ExecuteString | RawErrors, CompatV1} {
+		ren := newTestRender(t, writeTemplates(t, compatTemplates))
+		ren.Behavior = behavior
+		if got, err := ren.String("home", nil); err != nil || got != "<html><body>home</body></html>" {
+			t.Errorf("behavior %v: home: got %q, %v", behavior, got, err)
+		}
+
+		_, err := ren.String("fail", []int{1})
+		if err == nil {
+			t.Fatalf("behavior %v: the failing page rendered", behavior)
+		}
+		var renderErr *RenderError
+		if got, want := errors.As(err, &renderErr), behavior&RawErrors == 0; got != want {
+			t.Errorf("behavior %v: %v is a *RenderError: %v, want %v", behavior, err, got, want)
+		}
+		if !strings.Contains(err.Error(), "index out of range") {
+			t.Errorf("behavior %v: error %v", behavior, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"path/filepath"
+	"reflect"
+)
+
+// component is a template registered with RegisterComponent. It is never
+// changed once registered, so clones share it; each Render parses it on its
+// own, see componentTemplate.
+type component struct {
+	name  string
+	file  string       // Path of the template file, joined with TemplateDir.
+	props reflect.Type // The type T of the value the component takes.
+}
+
+// parsedComponent is a component parsed by one Render, with the cacheGen it
+// was parsed in.
+type parsedComponent struct {
+	c    *component
+	gen  uint64
+	tmpl *template.Template
+	err  error
+}
+
+// RegisterComponent registers the template file (relative to TemplateDir) as
+// the component name, taking a value of type T:
+//
+//	page.RegisterComponent[CardProps](ren, "card", "components/card.partial.tmpl")
+//
+// Pages then render it with {{card .Card}}. The argument is checked against T
+// when the page executes; passing another type fails the render with an error
+// naming the page, line and call, e.g.
+//
+//	template: home.page.tmpl:4:7: executing "content" at <card .User>: error calling card: card takes page_test.CardProps, got main.User
+//
+// A *T is accepted too. The component is executed with the value as its data
+// (dot). When the file defines a template called name that one is executed,
+// otherwise the file itself. Validate checks that every component parses and
+// executes with the zero value of T.
+//
+// Registering a component adds the function name and clears the cache like
+// AddFunc does, so do it while configuring ren; it replaces a function of
+// the same name added before, and AddFunc after it replaces the component.
+// The function is bound to the Render rendering the page: a Clone renders
+// the component with its own functions, and the component file is parsed
+// again after everything that clears the cache.
+func RegisterComponent[T any](ren *Render, name, file string) {
+	c := &component{
+		name:  name,
+		file:  ren.lookupTemplate(file),
+		props: reflect.TypeOf((*T)(nil)).Elem(),
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.components == nil {
+		ren.components = make(map[string]*component)
+	}
+	ren.components[name] = c
+	delete(ren.Functions, name)
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	if ren.Debug {
+		log.Println("Registered component", name, "- template cache cleared")
+	}
+}
+
+// componentFuncs adds the functions of the registered components, bound to
+// ren, to funcs. The caller must hold ren.mu.
+func (ren *Render) componentFuncs(funcs template.FuncMap) {
+	for name, c := range ren.components {
+		funcs[name] = func(props any) (template.HTML, error) {
+			return ren.renderComponent(c, props)
+		}
+	}
+}
+
+// renderComponent executes the component c with props after checking its type.
+func (ren *Render) renderComponent(c *component, props any) (template.HTML, error) {
+	v := reflect.ValueOf(props)
+	if v.Kind() == reflect.Pointer && v.Type().Elem() == c.props && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.Type().AssignableTo(c.props) {
+		return "", fmt.Errorf("%s takes %v, got %T", c.name, c.props, props)
+	}
+	tmpl, err := ren.componentTemplate(c)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v.Interface()); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// componentTemplate returns the template of c parsed with the functions of
+// ren. With UseCache, it is parsed once per cacheGen, so it is parsed again
+// with the page sets after Reload, ClearCache, AddFunc and the like, and so
+// is a file that failed to parse; without, on every render.
+func (ren *Render) componentTemplate(c *component) (*template.Template, error) {
+	ren.mu.RLock()
+	gen := ren.cacheGen
+	ren.mu.RUnlock()
+
+	ren.componentMu.Lock()
+	defer ren.componentMu.Unlock()
+	if p := ren.parsedComponents[c.name]; ren.UseCache && p != nil && p.c == c && p.gen == gen {
+		return p.tmpl, p.err
+	}
+	p := &parsedComponent{c: c, gen: gen}
+	set := template.New(filepath.Base(c.file)).Funcs(ren.templateFuncs())
+	if p.err = ren.parseFiles(set, nil, c.file); p.err == nil {
+		p.tmpl = set
+		if named := set.Lookup(c.name); named != nil {
+			p.tmpl = named
+		}
+	}
+	if ren.parsedComponents == nil {
+		ren.parsedComponents = make(map[string]*parsedComponent)
+	}
+	ren.parsedComponents[c.name] = p
+	return p.tmpl, p.err
+}
+
+// validateComponents checks that every registered component parses and
+// executes with the zero value of its type.
+func (ren *Render) validateComponents() []error {
+	ren.mu.RLock()
+	components := make([]*component, 0, len(ren.components))
+	for _, c := range ren.components {
+		components = append(components, c)
+	}
+	ren.mu.RUnlock()
+
+	var errs []error
+	for _, c := range components {
+		tmpl, err := ren.componentTemplate(c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("component %s: %w", c.name, err))
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, reflect.Zero(c.props).Interface()); err != nil {
+			errs = append(errs, fmt.Errorf("component %s with zero %v: %w", c.name, c.props, err))
+		}
+	}
+	return errs
+}
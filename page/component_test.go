@@ -0,0 +1,90 @@
+package page
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type cardProps struct {
+	Title string
+}
+
+func newComponentRender(t *testing.T) (*Render, string) {
+	t.Helper()
+	dir := writeTemplates(t, map[string]string{
+		"card.partial.tmpl": `<div>{{greet}} {{.Title}}</div>`,
+		"home.page.tmpl":    `{{card .}}`,
+	})
+	ren := New()
+	ren.TemplateDir = dir
+	ren.AddFunc("greet", func() string { return "parent" })
+	RegisterComponent[cardProps](ren, "card", "card.partial.tmpl")
+	return ren, dir
+}
+
+// A clone renders the component with its own functions, and the parent
+// with its own.
+func TestComponentClone(t *testing.T) {
+	ren, _ := newComponentRender(t)
+	clone := ren.Clone()
+	clone.AddFunc("greet", func() string { return "clone" })
+
+	for _, tt := range []struct {
+		ren  *Render
+		want string
+	}{
+		{ren, "<div>parent x</div>"},
+		{clone, "<div>clone x</div>"},
+		{ren, "<div>parent x</div>"},
+	} {
+		got, err := tt.ren.String("home.page.tmpl", cardProps{Title: "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// The component is parsed again after the cache is cleared, also after a
+// parse error.
+func TestComponentReparse(t *testing.T) {
+	ren, dir := newComponentRender(t)
+	file := filepath.Join(dir, "card.partial.tmpl")
+	render := func() (string, error) {
+		return ren.String("home.page.tmpl", &cardProps{Title: "x"})
+	}
+	if got, err := render(); err != nil || got != "<div>parent x</div>" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	if err := os.WriteFile(file, []byte(`<p>{{.Title}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := render(); got != "<div>parent x</div>" {
+		t.Errorf("cached component not used: %q", got)
+	}
+	ren.ClearCache()
+	if _, err := render(); err == nil || !strings.Contains(err.Error(), "card") {
+		t.Errorf("broken component: got error %v", err)
+	}
+
+	if err := os.WriteFile(file, []byte(`<p>{{.Title}}</p>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ren.ClearCache()
+	if got, err := render(); err != nil || got != "<p>x</p>" {
+		t.Errorf("fixed component: got %q, %v", got, err)
+	}
+}
+
+func TestComponentProps(t *testing.T) {
+	ren, _ := newComponentRender(t)
+	_, err := ren.String("home.page.tmpl", "not props")
+	if err == nil || !strings.Contains(err.Error(), "card takes page.cardProps, got string") {
+		t.Errorf("got error %v", err)
+	}
+}
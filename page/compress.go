@@ -0,0 +1,218 @@
+package page
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// defaultCompressMinSize is the CompressMinSize used when it is 0.
+const defaultCompressMinSize = 1 << 10
+
+// gzipPools holds reusable gzip writers, one pool per level from
+// gzip.HuffmanOnly up: a new writer allocates several hundred KB.
+var gzipPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// Encoder is a content encoding ShowRequest can answer with. The package
+// ships GzipEncoder; others, like brotli or zstd, come from the package of
+// your choice, so this one stays free of dependencies:
+//
+//	type brotliEncoder struct{}
+//
+//	func (brotliEncoder) Name() string                    { return "br" }
+//	func (brotliEncoder) Wrap(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+//
+// Name is the token of the encoding in Accept-Encoding and Content-Encoding.
+// Wrap returns a writer encoding into w. The whole body is written to it,
+// then it is closed once, so Close may return it to a pool.
+type Encoder interface {
+	Name() string
+	Wrap(w io.Writer) io.WriteCloser
+}
+
+// GzipEncoder is the Encoder of gzip at the level Level, from
+// gzip.HuffmanOnly to gzip.BestCompression; 0 uses gzip.DefaultCompression.
+// Its writers are pooled.
+type GzipEncoder struct {
+	Level int
+}
+
+// Name returns "gzip".
+func (GzipEncoder) Name() string { return "gzip" }
+
+// Wrap returns a pooled gzip writer into w. An invalid Level is compressed
+// at gzip.DefaultCompression; ShowRequest rejects it before writing.
+func (e GzipEncoder) Wrap(w io.Writer) io.WriteCloser {
+	level := e.Level
+	if level == 0 || !validGzipLevel(level) {
+		level = gzip.DefaultCompression
+	}
+	pool := &gzipPools[level-gzip.HuffmanOnly]
+	gz, ok := pool.Get().(*gzip.Writer)
+	if ok {
+		gz.Reset(w)
+	} else {
+		gz, _ = gzip.NewWriterLevel(w, level)
+	}
+	return &pooledGzip{Writer: gz, pool: pool}
+}
+
+// validGzipLevel reports whether level is a level of compress/gzip.
+func validGzipLevel(level int) bool {
+	return level >= gzip.HuffmanOnly && level <= gzip.BestCompression
+}
+
+// pooledGzip is a gzip writer that goes back to its pool when closed.
+type pooledGzip struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (z *pooledGzip) Close() error {
+	err := z.Writer.Close()
+	z.pool.Put(z.Writer)
+	z.Writer = nil
+	return err
+}
+
+// compressionKey is the context key of the per-request override set by
+// WithCompression.
+type compressionKey struct{}
+
+// WithCompression returns a copy of r that overrides the compression policy
+// for the ShowRequest call it is passed to: allow=true compresses even a page
+// in NeverCompress or one carrying a CSRF token, allow=false never compresses.
+// The client still has to accept one of the Encoders, and EnableCompression
+// must be set.
+func WithCompression(r *http.Request, allow bool) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), compressionKey{}, allow))
+}
+
+// encoders returns Encoders, or gzip at CompressionLevel when it is nil.
+func (ren *Render) encoders() []Encoder {
+	if ren.Encoders != nil {
+		return ren.Encoders
+	}
+	return []Encoder{GzipEncoder{Level: ren.CompressionLevel}}
+}
+
+// compressMinSize returns CompressMinSize or its default.
+func (ren *Render) compressMinSize() int {
+	if ren.CompressMinSize > 0 {
+		return ren.CompressMinSize
+	}
+	return defaultCompressMinSize
+}
+
+// encoderFor returns the encoder ShowRequest encodes body, the page t
+// rendered with td, with, or nil to send it as it is.
+func (ren *Render) encoderFor(r *http.Request, t string, td any, body []byte) Encoder {
+	if !ren.EnableCompression || len(body) < ren.compressMinSize() {
+		return nil
+	}
+	if allow, ok := r.Context().Value(compressionKey{}).(bool); ok {
+		if !allow {
+			return nil
+		}
+	} else if ren.neverCompress(t, td) {
+		return nil
+	}
+	return preferredEncoder(r.Header.Get("Accept-Encoding"), ren.encoders())
+}
+
+// neverCompress reports whether the policy forbids compressing the page t
+// rendered with td: NeverCompress, or a CSRF token in td.
+func (ren *Render) neverCompress(t string, td any) bool {
+	for _, pattern := range ren.NeverCompress {
+		if ok, _ := path.Match(pattern, t); ok {
+			return true
+		}
+	}
+	return hasCSRFToken(td)
+}
+
+// preferredEncoder returns the encoder of encoders the Accept-Encoding header
+// accept ranks highest, or nil to send the body unencoded (identity). An
+// encoding has the quality of its name ("x-gzip" counts as "gzip"), or else
+// that of "*", or else isn't acceptable; ties go to the earlier encoder, so
+// encoders is in the order the server prefers. Identity wins over the best
+// encoder only when the header ranks it higher, by "identity" or "*". An
+// empty header asks for no encoding.
+func preferredEncoder(accept string, encoders []Encoder) Encoder {
+	ranges := parseAccept(accept)
+	quality := func(name string) (q float64, listed bool) {
+		anyQ, anyListed := 0.0, false
+		for _, r := range ranges {
+			switch {
+			case r.value == name || (name == "gzip" && r.value == "x-gzip"):
+				q, listed = r.q, true
+			case r.value == "*":
+				anyQ, anyListed = r.q, true
+			}
+		}
+		if listed {
+			return q, true
+		}
+		return anyQ, anyListed
+	}
+
+	var best Encoder
+	bestQ := 0.0
+	for _, enc := range encoders {
+		if q, _ := quality(strings.ToLower(enc.Name())); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	if q, listed := quality("identity"); best == nil || (listed && q > bestQ) {
+		return nil
+	}
+	return best
+}
+
+// hasCSRFToken reports whether td carries a non-empty CSRF token: a CSRFToken
+// field (in td or its Data) or a "CSRFToken" key in a map[string]any.
+func hasCSRFToken(td any) bool {
+	for _, v := range []any{td, unwrapData(td)} {
+		if m, ok := v.(map[string]any); ok {
+			if token, ok := m["CSRFToken"].(string); ok && token != "" {
+				return true
+			}
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() == reflect.Struct {
+			if f := rv.FieldByName("CSRFToken"); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeEncoded writes body encoded with enc to w, after setting the headers
+// and status. The body is encoded as it is written, so there is no
+// Content-Length. A GzipEncoder with an invalid level fails before anything
+// is written.
+func writeEncoded(w http.ResponseWriter, status int, body []byte, enc Encoder) error {
+	if g, ok := enc.(GzipEncoder); ok && g.Level != 0 && !validGzipLevel(g.Level) {
+		return fmt.Errorf("invalid compression level %d", g.Level)
+	}
+	w.Header().Set("Content-Encoding", enc.Name())
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	ew := enc.Wrap(w)
+	if _, err := ew.Write(body); err != nil {
+		ew.Close()
+		return err
+	}
+	return ew.Close()
+}
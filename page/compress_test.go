@@ -0,0 +1,184 @@
+package page
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeEncoder is an Encoder of any name that marks its output with a prefix
+// instead of compressing it.
+type fakeEncoder string
+
+func (e fakeEncoder) Name() string { return string(e) }
+
+func (e fakeEncoder) Wrap(w io.Writer) io.WriteCloser {
+	io.WriteString(w, string(e)+":")
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestPreferredEncoder(t *testing.T) {
+	gz := GzipEncoder{}
+	br := fakeEncoder("br")
+	tests := []struct {
+		accept   string
+		encoders []Encoder
+		want     string // Name of the encoder; "" for none.
+	}{
+		{"", []Encoder{gz}, ""},
+		{"gzip", []Encoder{gz}, "gzip"},
+		{"GZIP", []Encoder{gz}, "gzip"},
+		{"x-gzip", []Encoder{gz}, "gzip"},
+		{"deflate", []Encoder{gz}, ""},
+		{"gzip;q=0", []Encoder{gz}, ""},
+		{"gzip;q=abc", []Encoder{gz}, ""},
+		{"gzip;q=2", []Encoder{gz}, ""},
+
+		// Ties go to the order of the server.
+		{"gzip, br", []Encoder{br, gz}, "br"},
+		{"gzip, br", []Encoder{gz, br}, "gzip"},
+		{"gzip;q=0.8, br;q=0.8", []Encoder{br, gz}, "br"},
+		// A higher q wins over the order of the server.
+		{"br;q=0.5, gzip", []Encoder{br, gz}, "gzip"},
+		{"gzip;q=0.1, br;q=0.9", []Encoder{gz, br}, "br"},
+
+		// "*" stands for the encodings not listed.
+		{"*", []Encoder{br, gz}, "br"},
+		{"*;q=0.5, br;q=0", []Encoder{br, gz}, "gzip"},
+		{"br;q=0.4, *;q=0.5", []Encoder{br, gz}, "gzip"},
+		{"*;q=0", []Encoder{gz}, ""},
+
+		// Identity wins only when ranked above the best encoder.
+		{"identity", []Encoder{gz}, ""},
+		{"gzip;q=0.5, identity", []Encoder{gz}, ""},
+		{"gzip, identity;q=0.5", []Encoder{gz}, "gzip"},
+		{"gzip, identity", []Encoder{gz}, "gzip"},
+		{"br, *;q=0.9", []Encoder{br}, "br"},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, enc := range tt.encoders {
+			names = append(names, enc.Name())
+		}
+		got := ""
+		if enc := preferredEncoder(tt.accept, tt.encoders); enc != nil {
+			got = enc.Name()
+		}
+		if got != tt.want {
+			t.Errorf("preferredEncoder(%q, %v) = %q, want %q", tt.accept, names, got, tt.want)
+		}
+	}
+}
+
+func TestShowRequestEncoders(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+	dir := writeTemplates(t, map[string]string{"big.page.tmpl": body})
+	ren := newTestRender(t, dir)
+	ren.EnableCompression = true
+	ren.Encoders = []Encoder{fakeEncoder("br"), GzipEncoder{}}
+
+	show := func(accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		rec := httptest.NewRecorder()
+		if err := ren.ShowRequest(rec, r, "big.page.tmpl", nil); err != nil {
+			t.Fatal(err)
+		}
+		if vary := rec.Header().Get("Vary"); !strings.Contains(vary, "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: Vary %q", accept, vary)
+		}
+		return rec
+	}
+
+	rec := show("gzip, br")
+	if enc := rec.Header().Get("Content-Encoding"); enc != "br" {
+		t.Errorf("Content-Encoding %q, want br", enc)
+	}
+	if got := rec.Body.String(); got != "br:"+body {
+		t.Errorf("br body: %.20q...", got)
+	}
+
+	rec = show("gzip")
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding %q, want gzip", enc)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("encoded response with Content-Length %s", cl)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || string(got) != body {
+		t.Errorf("gunzipped body: %d bytes, %v", len(got), err)
+	}
+
+	rec = show("identity")
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding %q for identity", enc)
+	}
+	if got := rec.Body.String(); got != body {
+		t.Errorf("identity body: %.20q...", got)
+	}
+}
+
+// Pages excluded from compression are sent without Content-Encoding to a
+// client that accepts gzip: those in NeverCompress, by name or glob, and
+// those with a CSRF token in their data, unless WithCompression allows it.
+func TestNeverCompress(t *testing.T) {
+	body := strings.Repeat("x", 2048)
+	dir := writeTemplates(t, map[string]string{
+		"big.page.tmpl":          body,
+		"secret.page.tmpl":       body,
+		"admin/users.page.tmpl":  body,
+		"form.page.tmpl":         body + `{{.CSRFToken}}`,
+		"admin/nested.page.tmpl": body,
+	})
+	ren := newTestRender(t, dir)
+	ren.EnableCompression = true
+	ren.NeverCompress = []string{"secret.page.tmpl", "admin/*"}
+
+	token := map[string]any{"CSRFToken": "t0k3n"}
+	tests := []struct {
+		page     string
+		td       any
+		override string // "allow" or "forbid" with WithCompression.
+		want     string
+	}{
+		{"big.page.tmpl", nil, "", "gzip"},
+		{"secret.page.tmpl", nil, "", ""},
+		{"admin/users.page.tmpl", nil, "", ""},
+		{"admin/nested.page.tmpl", nil, "", ""},
+		{"form.page.tmpl", token, "", ""},
+		{"form.page.tmpl", map[string]any{"CSRFToken": ""}, "", "gzip"},
+		{"secret.page.tmpl", nil, "allow", "gzip"},
+		{"form.page.tmpl", token, "allow", "gzip"},
+		{"big.page.tmpl", nil, "forbid", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if tt.override != "" {
+			r = WithCompression(r, tt.override == "allow")
+		}
+		rec := httptest.NewRecorder()
+		if err := ren.ShowRequest(rec, r, tt.page, tt.td); err != nil {
+			t.Fatal(err)
+		}
+		if enc := rec.Header().Get("Content-Encoding"); enc != tt.want {
+			t.Errorf("%s (td %v, override %q): Content-Encoding %q, want %q", tt.page, tt.td, tt.override, enc, tt.want)
+			continue
+		}
+		if tt.want == "" && !strings.HasPrefix(rec.Body.String(), body) {
+			t.Errorf("%s: uncompressed body: %.20q...", tt.page, rec.Body.String())
+		}
+	}
+}
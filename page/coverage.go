@@ -0,0 +1,157 @@
+package page
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+// Coverage records which templates are executed, to find the partials and
+// blocks a test suite never renders. Set Render.Coverage to a NewCoverage
+// in tests; sets built while it is set are instrumented. When it is nil
+// (production) nothing is instrumented and renders pay nothing.
+type Coverage struct {
+	mu    sync.Mutex
+	known map[coverageKey]bool
+	hits  map[coverageKey]int64
+}
+
+// coverageKey identifies a defined template by its name and the file it is in.
+type coverageKey struct {
+	name, file string
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{known: make(map[coverageKey]bool), hits: make(map[coverageKey]int64)}
+}
+
+// TemplateCoverage is the coverage of one defined template.
+type TemplateCoverage struct {
+	Name       string `json:"name"`       // Template name, e.g. "footer".
+	File       string `json:"file"`       // File it is defined in, e.g. "footer.partial.tmpl".
+	Executions int64  `json:"executions"` // Number of times it was executed.
+}
+
+// CoverageReport lists every instrumented template with its execution count.
+type CoverageReport struct {
+	Templates []TemplateCoverage `json:"templates"`
+}
+
+// Report returns the coverage recorded so far, sorted by file and name.
+func (c *Coverage) Report() CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var report CoverageReport
+	for key := range c.known {
+		report.Templates = append(report.Templates, TemplateCoverage{Name: key.name, File: key.file, Executions: c.hits[key]})
+	}
+	sort.Slice(report.Templates, func(i, j int) bool {
+		a, b := report.Templates[i], report.Templates[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// Unexecuted returns the templates that were never executed.
+func (r CoverageReport) Unexecuted() []TemplateCoverage {
+	var never []TemplateCoverage
+	for _, t := range r.Templates {
+		if t.Executions == 0 {
+			never = append(never, t)
+		}
+	}
+	return never
+}
+
+// WriteText writes the report as text: one line per template, followed by
+// a summary per file and the list of templates that were never executed.
+func (r CoverageReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	files := make(map[string][2]int)
+	var order []string
+	for _, t := range r.Templates {
+		fmt.Fprintf(&b, "%-40s %-30s %d\n", t.File, t.Name, t.Executions)
+		counts, seen := files[t.File]
+		if !seen {
+			order = append(order, t.File)
+		}
+		counts[1]++
+		if t.Executions > 0 {
+			counts[0]++
+		}
+		files[t.File] = counts
+	}
+	b.WriteString("\nfiles:\n")
+	for _, f := range order {
+		fmt.Fprintf(&b, "%-40s %d/%d templates executed\n", f, files[f][0], files[f][1])
+	}
+	b.WriteString("\nnever executed:\n")
+	for _, t := range r.Unexecuted() {
+		fmt.Fprintf(&b, "%s (%s)\n", t.Name, t.File)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r CoverageReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// hit is the pageCoverage template function called by instrumented templates.
+// It always returns false, so the {{if}} around it renders nothing.
+func (c *Coverage) hit(name, file string) bool {
+	c.mu.Lock()
+	c.hits[coverageKey{name, file}]++
+	c.mu.Unlock()
+	return false
+}
+
+// instrument adds {{if pageCoverage "name" "file"}}{{end}} to the start of
+// every template in the set that has content, and registers it as known.
+// The marker never produces output in any escaping context. Templates whose
+// body is only whitespace (the wrappers of files holding only {{define}}s)
+// are skipped, since they are never executed on their own.
+func (c *Coverage) instrument(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil || onlyWhitespace(t.Tree.Root) {
+			continue
+		}
+		key := coverageKey{name: t.Name(), file: t.Tree.ParseName}
+		c.mu.Lock()
+		c.known[key] = true
+		c.mu.Unlock()
+
+		src := "{{if pageCoverage " + strconv.Quote(key.name) + " " + strconv.Quote(key.file) + "}}{{end}}"
+		trees, err := parse.Parse("coverage", src, "", "", map[string]any{"pageCoverage": c.hit})
+		if err != nil {
+			return err
+		}
+		marker := trees["coverage"].Root.Nodes[0]
+		t.Tree.Root.Nodes = append([]parse.Node{marker}, t.Tree.Root.Nodes...)
+	}
+	return nil
+}
+
+// onlyWhitespace reports whether list holds nothing but whitespace text.
+func onlyWhitespace(list *parse.ListNode) bool {
+	for _, node := range list.Nodes {
+		text, ok := node.(*parse.TextNode)
+		if !ok || strings.TrimSpace(string(text.Text)) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,301 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DebugHandler returns a handler with debugging endpoints for ren. Nothing in
+// this package serves it: it is only reachable where it is mounted, and it
+// has no authentication of its own, so mount it behind the application's
+// admin authentication:
+//
+//	mux.Handle("/debug/templates/", http.StripPrefix("/debug/templates", adminOnly(ren.DebugHandler())))
+//
+// Every endpoint is an action, checked with DebugAuthorize. Without it, the
+// read-only actions (blocks, disabled, funcs, templates) are allowed and the others (diff,
+// disable, enable, invalidate, reload) are denied with 403. Allowed actions
+// other than the read-only ones are logged with the principal of the request
+// (see WithPrincipal) and passed to DebugAudit.
+//
+// Endpoints:
+//   - POST /diff with form values "template" and "fixture": renders the page
+//     with the data DebugFixtures[fixture] through the cache and freshly
+//     parsed from disk, and returns the hashes of both outputs and a unified
+//     diff when they differ. The fresh set is not stored in the cache.
+//   - GET /blocks: the per-block timings of Stats.Blocks as JSON, slowest
+//     p95 first; see TraceBlocks.
+//   - POST /disable with form values "template", "fallback" and "ttl" (e.g.
+//     "30m", optional): Disable or DisableFor.
+//   - POST /enable with form value "template": Enable.
+//   - GET /disabled: the disabled pages of Stats.Disabled as JSON.
+//   - POST /invalidate with form value "template": InvalidateDataVersion.
+//   - POST /reload with form value "source": ReloadSource; without it, and
+//     with form values "type" (e.g. ".layout"), WarmReload of TemplateDir.
+//   - GET /funcs: the function calls of Stats.Funcs as JSON, largest total
+//     time first; see ProfileFuncs.
+//   - GET /templates: what the cache holds, as JSON: every cached page with
+//     the templates defined in its set, the Partials list and the cache
+//     counters of Stats. It shows the structure of every page, so it
+//     answers 404 unless Debug is set.
+func (ren *Render) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/diff", ren.debugAction("diff", true, formTarget("template"), ren.debugDiff))
+	mux.HandleFunc("/blocks", ren.debugAction("blocks", false, nil, ren.debugBlocks))
+	mux.HandleFunc("/disable", ren.debugAction("disable", true, formTarget("template"), ren.debugDisable))
+	mux.HandleFunc("/enable", ren.debugAction("enable", true, formTarget("template"), ren.debugEnable))
+	mux.HandleFunc("/disabled", ren.debugAction("disabled", false, nil, ren.debugDisabled))
+	mux.HandleFunc("/invalidate", ren.debugAction("invalidate", true, formTarget("template"), ren.debugInvalidate))
+	mux.HandleFunc("/reload", ren.debugAction("reload", true, formTarget("source"), ren.debugReload))
+	mux.HandleFunc("/funcs", ren.debugAction("funcs", false, nil, ren.debugFuncs))
+	mux.HandleFunc("/templates", ren.debugAction("templates", false, nil, ren.debugTemplates))
+	return mux
+}
+
+// blockEntry is one entry in the response of the /blocks debug endpoint.
+type blockEntry struct {
+	Name  string `json:"name"`
+	File  string `json:"file"`
+	Count int64  `json:"count"`
+	P50   string `json:"p50"`
+	P95   string `json:"p95"`
+}
+
+// debugBlocks serves the /blocks debug endpoint.
+func (ren *Render) debugBlocks(w http.ResponseWriter, r *http.Request) {
+	blocks := ren.Stats().Blocks
+	entries := make([]blockEntry, 0, len(blocks))
+	for name, b := range blocks {
+		entries = append(entries, blockEntry{Name: name, File: b.File, Count: b.Count, P50: b.P50.String(), P95: b.P95.String()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		bi, bj := blocks[entries[i].Name], blocks[entries[j].Name]
+		if bi.P95 != bj.P95 {
+			return bi.P95 > bj.P95
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// debugDisable serves the /disable debug endpoint.
+func (ren *Render) debugDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var ttl time.Duration
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid ttl "+v, http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if err := ren.DisableFor(r.FormValue("template"), r.FormValue("fallback"), ttl); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugEnable serves the /enable debug endpoint.
+func (ren *Render) debugEnable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ren.Enable(r.FormValue("template"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugInvalidate serves the /invalidate debug endpoint.
+func (ren *Render) debugInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	t := r.FormValue("template")
+	if t == "" {
+		http.Error(w, "invalid template name", http.StatusBadRequest)
+		return
+	}
+	ren.InvalidateDataVersion(t)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugReload serves the /reload debug endpoint.
+func (ren *Render) debugReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var err error
+	if source := r.FormValue("source"); source != "" {
+		err = ren.ReloadSource(source)
+	} else {
+		err = ren.WarmReload(WarmReloadOptions{FileTypes: r.Form["type"]})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugDisabled serves the /disabled debug endpoint.
+func (ren *Render) debugDisabled(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ren.Stats().Disabled)
+}
+
+// renderDiff is the response of the /diff debug endpoint.
+type renderDiff struct {
+	Template    string `json:"template"`
+	Fixture     string `json:"fixture"`
+	CachedHash  string `json:"cached_hash"`
+	FreshHash   string `json:"fresh_hash"`
+	Equal       bool   `json:"equal"`
+	UnifiedDiff string `json:"diff,omitempty"`
+}
+
+// debugDiff serves the /diff debug endpoint.
+func (ren *Render) debugDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	t, fixture := r.FormValue("template"), r.FormValue("fixture")
+	if t == "" || strings.ContainsAny(t, `/\`) {
+		http.Error(w, "invalid template name", http.StatusBadRequest)
+		return
+	}
+	ren.mu.RLock()
+	td, ok := ren.DebugFixtures[fixture]
+	ren.mu.RUnlock()
+	if !ok {
+		http.Error(w, "unknown fixture "+fixture, http.StatusBadRequest)
+		return
+	}
+
+	cached, err := ren.buildTemplate(t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cachedOut, err := ren.execute(cached, t, td)
+	if err != nil {
+		http.Error(w, "cached: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The fresh set reads the partials from disk as well: the base the
+	// cached sets share may be as old as they are.
+	fresh, err := ren.parseFreshSet(t, ren.partials())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	freshOut, err := ren.execute(fresh.tmpl, t, td)
+	if err != nil {
+		http.Error(w, "fresh: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cachedHash, freshHash := sha256.Sum256(cachedOut), sha256.Sum256(freshOut)
+	resp := renderDiff{
+		Template:    t,
+		Fixture:     fixture,
+		CachedHash:  hex.EncodeToString(cachedHash[:]),
+		FreshHash:   hex.EncodeToString(freshHash[:]),
+		Equal:       cachedHash == freshHash,
+		UnifiedDiff: unifiedDiff("cached/"+t, "fresh/"+t, string(cachedOut), string(freshOut)),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// cacheListing is the response of the /templates debug endpoint.
+type cacheListing struct {
+	Pages    []cachedPage `json:"pages"`
+	Partials []string     `json:"partials"`
+	Stats    cacheStats   `json:"stats"`
+}
+
+// cachedPage is a page in the response of the /templates debug endpoint.
+type cachedPage struct {
+	Name        string   `json:"name"`
+	Fingerprint string   `json:"fingerprint"`
+	Defined     []string `json:"defined"` // Names of the templates in its set, sorted.
+}
+
+// cacheStats are the counters of Stats in the response of the /templates
+// debug endpoint.
+type cacheStats struct {
+	Cached      int    `json:"cached"`
+	CacheHits   int64  `json:"cache_hits"`
+	CacheMisses int64  `json:"cache_misses"`
+	SetsBuilt   int64  `json:"sets_built"`
+	BuildErrors int64  `json:"build_errors"`
+	Evicted     int64  `json:"evicted"`
+	ParseTime   string `json:"parse_time"`
+}
+
+// debugTemplates serves the /templates debug endpoint. The cache is copied
+// under the read lock, and the sets are listed after it is released.
+func (ren *Render) debugTemplates(w http.ResponseWriter, r *http.Request) {
+	if !ren.Debug {
+		http.NotFound(w, r)
+		return
+	}
+	ren.mu.RLock()
+	sets := make(map[string]*template.Template, len(ren.cache))
+	for t, tmpl := range ren.cache {
+		sets[t] = tmpl
+	}
+	fingerprints := make(map[string]string, len(sets))
+	for t := range sets {
+		fingerprints[t] = ren.fingerprints[t]
+	}
+	partials := append([]string{}, ren.Partials...)
+	ren.mu.RUnlock()
+
+	resp := cacheListing{Pages: make([]cachedPage, 0, len(sets)), Partials: partials}
+	for t, tmpl := range sets {
+		var defined []string
+		for _, d := range tmpl.Templates() {
+			// Sets cloned from the base of the partials hold its root, which
+			// has no tree.
+			if d.Tree != nil {
+				defined = append(defined, d.Name())
+			}
+		}
+		sort.Strings(defined)
+		resp.Pages = append(resp.Pages, cachedPage{Name: t, Fingerprint: fingerprints[t], Defined: defined})
+	}
+	sort.Slice(resp.Pages, func(i, j int) bool { return resp.Pages[i].Name < resp.Pages[j].Name })
+	stats := ren.Stats()
+	resp.Stats = cacheStats{
+		Cached:      stats.Cached,
+		CacheHits:   stats.CacheHits,
+		CacheMisses: stats.CacheMisses,
+		SetsBuilt:   stats.SetsBuilt,
+		BuildErrors: stats.BuildErrors,
+		Evicted:     stats.Evicted,
+		ParseTime:   stats.ParseTime.String(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
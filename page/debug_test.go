@@ -0,0 +1,73 @@
+package page
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postDiff asks the /diff endpoint of ren to compare the page t.
+func postDiff(t *testing.T, ren *Render, page string) renderDiff {
+	t.Helper()
+	form := url.Values{"template": {page}, "fixture": {"default"}}
+	r := httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	ren.DebugHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/diff: %d %s", w.Code, w.Body.String())
+	}
+	var diff renderDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil {
+		t.Fatal(err)
+	}
+	return diff
+}
+
+// After a partial is edited on disk, /diff must see the edit on its fresh
+// side, while the cached set and the base the cached sets share stay as
+// they were.
+func TestDebugDiffEditedPartial(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}<main>{{template "footer" .}}</main>{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}old footer{{end}}`,
+		"home.page.tmpl":      `{{template "base" .}}`,
+	})
+	ren := newTestRender(t, dir)
+	ren.DebugFixtures = map[string]any{"default": nil}
+	ren.DebugAuthorize = func(r *http.Request, action, target string) bool { return true }
+
+	if diff := postDiff(t, ren, "home.page.tmpl"); !diff.Equal {
+		t.Fatalf("unchanged files differ:\n%s", diff.UnifiedDiff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "footer.partial.tmpl"), []byte(`{{define "footer"}}new footer{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diff := postDiff(t, ren, "home.page.tmpl")
+	if diff.Equal || !strings.Contains(diff.UnifiedDiff, "+<main>new footer</main>") {
+		t.Fatalf("edited partial not diffed: %+v", diff)
+	}
+
+	// The cache, and the base other pages are built on, still hold the old
+	// partial.
+	for _, page := range []string{"home.page.tmpl", "other.page.tmpl"} {
+		if page == "other.page.tmpl" {
+			if err := os.WriteFile(filepath.Join(dir, page), []byte(`{{template "base" .}}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out, err := ren.String(page, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "<main>old footer</main>" {
+			t.Errorf("%s: got %q, want the cached partial", page, out)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package page
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DebugAction is a mutating DebugHandler action that was allowed, as
+// passed to Render.DebugAudit.
+type DebugAction struct {
+	Action    string // E.g. "disable".
+	Target    string // The template or source acted on; "" for actions on everything.
+	Principal string // Who acted, see WithPrincipal.
+	Time      time.Time
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the id of the user or service
+// making the request, for the authorization and audit of DebugHandler.
+func WithPrincipal(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, principalKey{}, id)
+}
+
+// principal returns the id set with WithPrincipal on the context of r.
+func principal(r *http.Request) string {
+	id, _ := r.Context().Value(principalKey{}).(string)
+	return id
+}
+
+// debugAction wraps the handler of a DebugHandler action with its
+// authorization: target reads the template or source acted on from the
+// request. Read-only actions are allowed without DebugAuthorize; mutating
+// ones are denied without it. Allowed mutating actions are logged and passed
+// to DebugAudit before they run.
+func (ren *Render) debugAction(action string, mutating bool, target func(r *http.Request) string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := ""
+		if target != nil {
+			t = target(r)
+		}
+		allowed := !mutating
+		if ren.DebugAuthorize != nil {
+			allowed = ren.DebugAuthorize(r, action, t)
+		}
+		if !allowed {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if mutating {
+			entry := DebugAction{Action: action, Target: t, Principal: principal(r), Time: time.Now()}
+			log.Println("debug:", entry.Principal, entry.Action, entry.Target)
+			if ren.DebugAudit != nil {
+				ren.DebugAudit(entry)
+			}
+		}
+		h(w, r)
+	}
+}
+
+// formTarget returns a target function reading the form value key.
+func formTarget(key string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.FormValue(key)
+	}
+}
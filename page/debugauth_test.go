@@ -0,0 +1,116 @@
+package page
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// debugActions are the actions of DebugHandler, with a request for each.
+var debugActions = []struct {
+	action   string
+	method   string
+	form     url.Values
+	target   string
+	mutating bool
+}{
+	{"diff", http.MethodPost, url.Values{"template": {"home.page.tmpl"}, "fixture": {"default"}}, "home.page.tmpl", true},
+	{"disable", http.MethodPost, url.Values{"template": {"home.page.tmpl"}, "fallback": {"sorry.page.tmpl"}}, "home.page.tmpl", true},
+	{"enable", http.MethodPost, url.Values{"template": {"home.page.tmpl"}}, "home.page.tmpl", true},
+	{"invalidate", http.MethodPost, url.Values{"template": {"home.page.tmpl"}}, "home.page.tmpl", true},
+	{"reload", http.MethodPost, url.Values{"type": {".layout", ".partial"}}, "", true},
+	{"blocks", http.MethodGet, nil, "", false},
+	{"disabled", http.MethodGet, nil, "", false},
+	{"funcs", http.MethodGet, nil, "", false},
+	{"templates", http.MethodGet, nil, "", false},
+}
+
+// TestDebugAuthorize sends every action with no DebugAuthorize, with one
+// denying everything and with one allowing everything, and checks the
+// answer, what DebugAuthorize was asked and what DebugAudit recorded.
+func TestDebugAuthorize(t *testing.T) {
+	const (
+		noHook = "no hook"
+		deny   = "deny"
+		allow  = "allow"
+	)
+	for _, mode := range []string{noHook, deny, allow} {
+		for _, tt := range debugActions {
+			dir := writeTemplates(t, map[string]string{
+				"home.page.tmpl":  `home`,
+				"sorry.page.tmpl": `sorry`,
+			})
+			ren := newTestRender(t, dir)
+			ren.DebugFixtures = map[string]any{"default": nil}
+			var asked []string
+			if mode != noHook {
+				ren.DebugAuthorize = func(r *http.Request, action, target string) bool {
+					asked = append(asked, action+" "+target)
+					return mode == allow
+				}
+			}
+			var audited []DebugAction
+			ren.DebugAudit = func(a DebugAction) { audited = append(audited, a) }
+
+			r := httptest.NewRequest(tt.method, "/"+tt.action, strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r = r.WithContext(WithPrincipal(r.Context(), "alice"))
+			w := httptest.NewRecorder()
+			ren.DebugHandler().ServeHTTP(w, r)
+
+			allowed := mode == allow || mode == noHook && !tt.mutating
+			if forbidden := w.Code == http.StatusForbidden; forbidden == allowed {
+				t.Errorf("%s, %s: status %d, allowed %v", mode, tt.action, w.Code, allowed)
+			}
+			if want := tt.action + " " + tt.target; mode != noHook && (len(asked) != 1 || asked[0] != want) {
+				t.Errorf("%s, %s: DebugAuthorize asked %q, want %q", mode, tt.action, asked, want)
+			}
+			wantAudit := allowed && tt.mutating
+			if !wantAudit {
+				if len(audited) != 0 {
+					t.Errorf("%s, %s: audited %+v", mode, tt.action, audited)
+				}
+				continue
+			}
+			if len(audited) != 1 {
+				t.Errorf("%s, %s: audited %d entries, want 1", mode, tt.action, len(audited))
+				continue
+			}
+			if a := audited[0]; a.Action != tt.action || a.Target != tt.target || a.Principal != "alice" || a.Time.IsZero() {
+				t.Errorf("%s, %s: audited %+v", mode, tt.action, a)
+			}
+		}
+	}
+}
+
+// A denied mutating action doesn't run.
+func TestDebugAuthorizeDeniedDisable(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"home.page.tmpl":  `home`,
+		"sorry.page.tmpl": `sorry`,
+	}))
+	form := url.Values{"template": {"home.page.tmpl"}, "fallback": {"sorry.page.tmpl"}}
+	post := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/disable", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		ren.DebugHandler().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post(); code != http.StatusForbidden {
+		t.Fatalf("without DebugAuthorize: status %d", code)
+	}
+	if d := ren.Stats().Disabled; len(d) != 0 {
+		t.Fatalf("denied disable ran: %+v", d)
+	}
+	ren.DebugAuthorize = func(r *http.Request, action, target string) bool { return true }
+	if code := post(); code != http.StatusNoContent {
+		t.Fatalf("allowed: status %d", code)
+	}
+	if _, ok := ren.Stats().Disabled["home.page.tmpl"]; !ok {
+		t.Error("allowed disable didn't run")
+	}
+}
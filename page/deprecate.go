@@ -0,0 +1,153 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"sort"
+	"text/template/parse"
+	"time"
+)
+
+// deprecationWarnEvery is how often a deprecated template is logged at most.
+const deprecationWarnEvery = time.Minute
+
+// deprecation is a template registered with Deprecate.
+type deprecation struct {
+	note      string
+	count     int64     // Renders using it.
+	lastWarn  time.Time // When it was last logged.
+	sinceWarn int64     // Renders using it since then.
+}
+
+// Deprecate marks the template name as scheduled for removal. name is a page
+// ("old.page.tmpl") or a template defined in a partial ("old-banner").
+// Rendering it keeps working, but every render of a page that is or calls it
+// is counted in Stats.Deprecated, and logged at most once a minute per
+// template, as
+//
+//	deprecated template: name="old-banner" page="home.page.tmpl" renders=12 note="use banner"
+//
+// where renders counts the renders since the last warning. Analyze lists
+// the pages still calling it. A page counts as calling a template when its
+// source has a {{template}} call of it, even one that is not executed.
+func (ren *Render) Deprecate(name, note string) {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.deprecations == nil {
+		ren.deprecations = make(map[string]*deprecation)
+	}
+	if d, ok := ren.deprecations[name]; ok {
+		d.note = note
+		return
+	}
+	ren.deprecations[name] = &deprecation{note: note}
+	ren.countRegistriesLocked()
+	ren.deprecatedUses = nil
+}
+
+// noteDeprecated counts and logs the deprecated templates used by a render of
+// the page t.
+func (ren *Render) noteDeprecated(t string) {
+	if ren.sizes.deprecations.Load() == 0 {
+		return
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	uses, ok := ren.deprecatedUses[t]
+	if !ok {
+		uses = deprecatedIn(t, ren.calls[t], ren.deprecations)
+		if ren.deprecatedUses == nil {
+			ren.deprecatedUses = make(map[string][]string)
+		}
+		ren.deprecatedUses[t] = uses
+	}
+	now := time.Now()
+	for _, name := range uses {
+		d := ren.deprecations[name]
+		d.count++
+		d.sinceWarn++
+		if now.Sub(d.lastWarn) >= deprecationWarnEvery {
+			log.Printf("deprecated template: name=%q page=%q renders=%d note=%q", name, t, d.sinceWarn, d.note)
+			d.lastWarn, d.sinceWarn = now, 0
+		}
+	}
+}
+
+// deprecatedIn returns the names in deprecations that are the page t or are
+// in calls, sorted.
+func deprecatedIn(t string, calls []string, deprecations map[string]*deprecation) []string {
+	found := make(map[string]bool)
+	if _, ok := deprecations[t]; ok {
+		found[t] = true
+	}
+	for _, name := range calls {
+		if _, ok := deprecations[name]; ok {
+			found[name] = true
+		}
+	}
+	uses := make([]string, 0, len(found))
+	for name := range found {
+		uses = append(uses, name)
+	}
+	sort.Strings(uses)
+	return uses
+}
+
+// calledTemplates returns the names of the templates called with {{template}}
+// anywhere in the set tmpl. It must run before foldStaticTemplates, which
+// removes the calls of static templates.
+func calledTemplates(tmpl *template.Template) []string {
+	var names []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		walkTree(t.Tree.Root, func(n parse.Node) {
+			if call, ok := n.(*parse.TemplateNode); ok {
+				names = append(names, call.Name)
+			}
+		})
+	}
+	return names
+}
+
+// deprecatedCounts returns the render counts of the deprecated templates.
+func (ren *Render) deprecatedCounts() map[string]int64 {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	if len(ren.deprecations) == 0 {
+		return nil
+	}
+	counts := make(map[string]int64, len(ren.deprecations))
+	for name, d := range ren.deprecations {
+		counts[name] = d.count
+	}
+	return counts
+}
+
+// deprecatedReferences parses every page in pages and returns, for every
+// deprecated template, the pages that are it or call it.
+func (ren *Render) deprecatedReferences(pages []string) (map[string][]string, error) {
+	ren.mu.RLock()
+	deprecations := make(map[string]*deprecation, len(ren.deprecations))
+	for name, d := range ren.deprecations {
+		deprecations[name] = d
+	}
+	ren.mu.RUnlock()
+	if len(deprecations) == 0 {
+		return nil, nil
+	}
+
+	partials := ren.partials()
+	refs := make(map[string][]string)
+	for _, t := range pages {
+		set, err := ren.parseSet(t, partials)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range deprecatedIn(t, set.calls, deprecations) {
+			refs[name] = append(refs[name], t)
+		}
+	}
+	return refs, nil
+}
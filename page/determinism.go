@@ -0,0 +1,15 @@
+package page
+
+import "time"
+
+// now is the {{now}} template function: the time of the render, from the
+// clock of ren.
+func (ren *Render) now() time.Time {
+	if ren.Deterministic {
+		if ren.Clock == nil {
+			return time.Unix(0, 0).UTC()
+		}
+		return ren.Clock()
+	}
+	return time.Now()
+}
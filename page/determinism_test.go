@@ -0,0 +1,75 @@
+package page
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+// renderSite renders every page of the fixture site in ../templates with a
+// new Render, and returns the hash of all outputs.
+func renderSite(t *testing.T) [sha256.Size]byte {
+	t.Helper()
+	ren := newTestRender(t, "../templates")
+	ren.Deterministic = true
+	ren.Clock = func() time.Time { return time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC) }
+	pages, err := ren.pageNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no pages in ../templates")
+	}
+	h := sha256.New()
+	for _, page := range pages {
+		out, err := ren.String(page, map[string]any{"Data": map[string]any{"payload": "fixture"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write([]byte(page + "\x00" + out + "\x00"))
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+func TestDeterministicFixtureSite(t *testing.T) {
+	if first, second := renderSite(t), renderSite(t); first != second {
+		t.Errorf("two renders of the fixture site differ: %x, %x", first, second)
+	}
+}
+
+// With Deterministic, {{now}} is the time of Clock, or the epoch without
+// one, and maps in the data are ranged over in sorted order; surrogate keys
+// are sorted too.
+func TestDeterministicClock(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"home.page.tmpl": `{{now.Format "2006-01-02T15:04:05Z07:00"}}{{range $k, $v := .}} {{$k}}={{$v}}{{end}}` +
+			`{{surrogateKey "zeta"}}{{surrogateKey "alpha"}}{{surrogateKey "mid"}}`,
+	})
+	data := map[string]int{"c": 3, "a": 1, "b": 2, "e": 5, "d": 4}
+	tests := []struct {
+		clock func() time.Time
+		want  string
+	}{
+		{nil, "1970-01-01T00:00:00Z a=1 b=2 c=3 d=4 e=5"},
+		{func() time.Time { return time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC) }, "2024-07-01T12:00:00Z a=1 b=2 c=3 d=4 e=5"},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 3; i++ {
+			ren := newTestRender(t, dir)
+			ren.Deterministic = true
+			ren.Clock = tt.clock
+			result, err := ren.Render("home.page.tmpl", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result.Body) != tt.want {
+				t.Errorf("got %q, want %q", result.Body, tt.want)
+			}
+			if keys := result.SurrogateKeys; len(keys) != 3 || keys[0] != "alpha" || keys[1] != "mid" || keys[2] != "zeta" {
+				t.Errorf("surrogate keys %q, want sorted", keys)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package page
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unifiedDiff returns a unified diff (3 lines of context) turning a into b,
+// labelled with the names nameA and nameB, or "" when they are equal.
+func unifiedDiff(nameA, nameB, a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// ops is the edit script: ' ' keeps x[i], '-' drops x[i], '+' adds y[j].
+	type op struct {
+		kind byte
+		line string
+		i, j int // line numbers in x and y before this op
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			ops = append(ops, op{' ', x[i], i, j})
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', x[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// A hunk runs from context lines before the change to context lines
+		// after the last change that is at most 2*context lines further.
+		start, end := max(0, k-context), k
+		for n := k; n < len(ops); n++ {
+			if ops[n].kind != ' ' {
+				end = n
+			} else if n-end > 2*context {
+				break
+			}
+		}
+		end = min(len(ops), end+context+1)
+
+		var countA, countB int
+		var body strings.Builder
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				countA++
+			}
+			if o.kind != '-' {
+				countB++
+			}
+			body.WriteByte(o.kind)
+			body.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", ops[start].i+1, countA, ops[start].j+1, countB, body.String())
+		k = end
+	}
+	return out.String()
+}
+
+// splitLines splits s after every newline; a final newline starts no line.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
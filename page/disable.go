@@ -0,0 +1,134 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Disabled is the state of a page switched off with Disable, as reported in
+// Stats.Disabled.
+type Disabled struct {
+	Fallback string    // Page rendered instead; "" means a plain 503.
+	Until    time.Time // When the page is enabled again; zero means never.
+	Served   int64     // Requests answered with the fallback since Disable.
+}
+
+// Disable switches the page name off: Show and ShowRequest answer its
+// requests with status 503 and the page fallback, or a plain 503 when
+// fallback is "", without building or executing name. It is meant for
+// incidents, to stop rendering one expensive or broken page at once.
+// Render and String are not affected. It takes effect for requests
+// starting after it returns; renders already running finish. name may be
+// a short name like "home", as for Show; a name matching no page is an
+// error.
+func (ren *Render) Disable(name, fallback string) error {
+	return ren.DisableFor(name, fallback, 0)
+}
+
+// DisableFor is Disable for ttl: name is enabled again automatically once
+// ttl has passed. A ttl of 0 disables name until Enable.
+func (ren *Render) DisableFor(name, fallback string, ttl time.Duration) error {
+	name, err := ren.pageName(name)
+	if err != nil {
+		return fmt.Errorf("disable: %w", err)
+	}
+	if fallback != "" {
+		if fallback, err = ren.pageName(fallback); err != nil {
+			return fmt.Errorf("disable: fallback: %w", err)
+		}
+	}
+	if fallback == name {
+		return errors.New("disable: a page can't be its own fallback")
+	}
+	d := &Disabled{Fallback: fallback}
+	if ttl > 0 {
+		d.Until = time.Now().Add(ttl)
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.disabled == nil {
+		ren.disabled = make(map[string]*Disabled)
+	}
+	ren.disabled[name] = d
+	ren.countRegistriesLocked()
+	log.Println("page", name, "disabled, fallback", fallback, "ttl", ttl)
+	return nil
+}
+
+// Enable switches the page name on again after Disable. Like Disable, it
+// takes a short name.
+func (ren *Render) Enable(name string) {
+	if resolved, err := ren.pageName(name); err == nil {
+		name = resolved
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if _, ok := ren.disabled[name]; ok {
+		delete(ren.disabled, name)
+		ren.countRegistriesLocked()
+		log.Println("page", name, "enabled")
+	}
+}
+
+// disabledFallback reports whether t is disabled, and if so counts the
+// request and returns its fallback. An expired disable is removed.
+func (ren *Render) disabledFallback(t string) (string, bool) {
+	if ren.sizes.disabled.Load() == 0 {
+		return "", false
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	d, ok := ren.disabled[t]
+	if !ok {
+		return "", false
+	}
+	if !d.Until.IsZero() && time.Now().After(d.Until) {
+		delete(ren.disabled, t)
+		ren.countRegistriesLocked()
+		log.Println("page", t, "enabled, its disable expired")
+		return "", false
+	}
+	d.Served++
+	return d.Fallback, true
+}
+
+// disabledPages returns a copy of the disabled pages for Stats, or nil when
+// there are none.
+func (ren *Render) disabledPages() map[string]Disabled {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	var pages map[string]Disabled
+	for name, d := range ren.disabled {
+		if !d.Until.IsZero() && time.Now().After(d.Until) {
+			continue
+		}
+		if pages == nil {
+			pages = make(map[string]Disabled)
+		}
+		pages[name] = *d
+	}
+	return pages
+}
+
+// showDisabled answers a request for a disabled page with status 503 and
+// the page fallback, rendered with td, or a plain 503.
+func (ren *Render) showDisabled(w http.ResponseWriter, fallback string, td any) error {
+	if fallback != "" {
+		result, err := ren.Render(fallback, td)
+		if err == nil {
+			if w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", result.ContentType)
+			}
+			setContentLength(w, len(result.Body))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, err = w.Write(result.Body)
+			return err
+		}
+		log.Println("error rendering fallback", fallback, err)
+	}
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	return nil
+}
@@ -0,0 +1,49 @@
+package page
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Disable and Enable take the short names Show takes, and Stats reports
+// the page under its full name.
+func TestDisableShortName(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"home.page.tmpl":  `home`,
+		"sorry.page.tmpl": `sorry`,
+	})
+	ren := newTestRender(t, dir)
+	show := func(name string) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		if err := ren.ShowRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil), name, nil); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, rec.Body.String()
+	}
+
+	if err := ren.Disable("home", "sorry"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"home", "home.page.tmpl"} {
+		if code, body := show(name); code != http.StatusServiceUnavailable || body != "sorry" {
+			t.Errorf("%s while disabled: %d %q", name, code, body)
+		}
+	}
+	if d, ok := ren.Stats().Disabled["home.page.tmpl"]; !ok || d.Fallback != "sorry.page.tmpl" || d.Served != 2 {
+		t.Errorf("Stats().Disabled = %+v", ren.Stats().Disabled)
+	}
+
+	ren.Enable("home")
+	if code, body := show("home"); code != http.StatusOK || body != "home" {
+		t.Errorf("home after Enable: %d %q", code, body)
+	}
+
+	if err := ren.Disable("missing", ""); err == nil {
+		t.Error("Disable of a missing page succeeded")
+	}
+	if err := ren.Disable("home", "home.page.tmpl"); err == nil {
+		t.Error("Disable with the page as its own fallback succeeded")
+	}
+}
@@ -0,0 +1,298 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diskCached reports whether ShowRequest serves the page t rendered with td
+// from the disk cache: DiskCacheDir is set, t is in DiskCachePages, and td
+// carries no CSRF token, which the cached file would hand to every visitor.
+func (ren *Render) diskCached(t string, td any) bool {
+	if ren.DiskCacheDir == "" || hasCSRFToken(td) {
+		return false
+	}
+	for _, pattern := range ren.DiskCachePages {
+		if ok, _ := path.Match(pattern, t); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// showFromDiskCache is ShowRequest for the pages of diskCached.
+//
+// Rendered pages are kept as files in DiskCacheDir and served from there with
+// http.ServeContent, which handles Range and If-Modified-Since requests. A
+// cached file is used for as long as both the fingerprint of the template
+// files and the page's data version are unchanged; see InvalidateDataVersion.
+// This is meant for pages whose data only changes when you say so (a brochure
+// site): td is not part of the cache key, so the file rendered for one
+// visitor is served to all of them.
+//
+// With DiskCacheTTL set, a file older than that is rendered again. Within
+// DiskCacheGrace after that, the old file is still served at once while one
+// background render (per file) replaces it; the td of the request that found
+// it stale is used for that render, so it must not be changed after
+// ShowRequest returns. A failed refresh is logged and keeps the old file, to
+// be tried again by the next request. Stop stops the refreshes.
+func (ren *Render) showFromDiskCache(w http.ResponseWriter, r *http.Request, t string, td any) error {
+	// Build (or fetch) the set first: the cache file name needs its fingerprint.
+	if _, err := ren.buildTemplate(t); err != nil {
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		ren.renderFailed(w, r, err, "")
+		return err
+	}
+	file := filepath.Join(ren.DiskCacheDir, ren.diskCacheName(t))
+
+	if f, err := os.Open(file); err == nil {
+		defer f.Close()
+		if info, err := f.Stat(); err == nil && ren.serveCached(t, file, info.ModTime(), td) {
+			if ren.Debug {
+				log.Println("Serving", t, "from disk cache", file)
+			}
+			if err := ren.audit(r, t, td); err != nil {
+				ren.renderFailed(w, r, err, http.StatusText(http.StatusInternalServerError))
+				return err
+			}
+			// The page isn't executed, so its surrogate keys come from the
+			// file written next to it.
+			if keys, err := os.ReadFile(file + ".keys"); err == nil {
+				ren.setSurrogateKeys(w, strings.Fields(string(keys)))
+			}
+			ren.setContentType(w)
+			http.ServeContent(w, r, t, info.ModTime(), f)
+			return nil
+		}
+	}
+
+	result, err := ren.Render(t, td)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error executing", err)
+		}
+		ren.renderFailed(w, r, err, err.Error())
+		return err
+	}
+	if err := ren.audit(r, t, td); err != nil {
+		ren.renderFailed(w, r, err, http.StatusText(http.StatusInternalServerError))
+		return err
+	}
+	// A page that can't be cached is still served.
+	if err := ren.writeDiskCache(t, file, result.Body, result.SurrogateKeys); err != nil {
+		log.Println("error writing", t, "to the disk cache:", err)
+	}
+	ren.setSurrogateKeys(w, result.SurrogateKeys)
+	ren.setContentType(w)
+	http.ServeContent(w, r, t, time.Now(), bytes.NewReader(result.Body))
+	return nil
+}
+
+// serveCached reports whether the cache file of t, last written at modTime,
+// is served. A file within DiskCacheGrace past DiskCacheTTL is served, and
+// refreshed in the background with td.
+func (ren *Render) serveCached(t, file string, modTime time.Time, td any) bool {
+	age := time.Since(modTime)
+	if ren.DiskCacheTTL <= 0 || age <= ren.DiskCacheTTL {
+		return true
+	}
+	if age > ren.DiskCacheTTL+ren.DiskCacheGrace {
+		return false
+	}
+	ren.stats.staleServed.Add(1)
+	ren.refreshDiskCache(t, file, td)
+	return true
+}
+
+// refreshDiskCache renders t with td into file in the background, unless
+// file is being refreshed already or Stop was called.
+func (ren *Render) refreshDiskCache(t, file string, td any) {
+	ren.mu.Lock()
+	if ren.refreshing[file] {
+		ren.mu.Unlock()
+		return
+	}
+	if ren.refreshing == nil {
+		ren.refreshing = make(map[string]bool)
+	}
+	ren.refreshing[file] = true
+	ren.mu.Unlock()
+
+	started := ren.goBackground(func(ctx context.Context) {
+		defer func() {
+			ren.mu.Lock()
+			delete(ren.refreshing, file)
+			ren.mu.Unlock()
+		}()
+		if ctx.Err() != nil {
+			return
+		}
+		result, err := ren.Render(t, td)
+		if err == nil && ctx.Err() == nil {
+			err = ren.writeDiskCache(t, file, result.Body, result.SurrogateKeys)
+		}
+		if err != nil {
+			log.Println("error refreshing", t, "in the disk cache:", err)
+		}
+	})
+	if !started {
+		ren.mu.Lock()
+		delete(ren.refreshing, file)
+		ren.mu.Unlock()
+	}
+}
+
+// InvalidateDataVersion marks the data behind page as changed: the next
+// ShowRequest for page renders it again instead of serving the file from
+// DiskCacheDir.
+func (ren *Render) InvalidateDataVersion(page string) {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.dataVersions == nil {
+		ren.dataVersions = make(map[string]uint64)
+	}
+	ren.dataVersions[page]++
+	if ren.Debug {
+		log.Println("Data version of", page, "is now", ren.dataVersions[page])
+	}
+	ren.publish(TemplateEvent{Type: TemplateInvalidated, Path: page, Pages: []string{page}})
+}
+
+// diskCacheName returns the file name for t in the disk cache. It combines
+// the page name, the template fingerprint and the data version, so a change
+// in either gives a new name.
+func (ren *Render) diskCacheName(t string) string {
+	ren.mu.RLock()
+	version := ren.dataVersions[t]
+	ren.mu.RUnlock()
+	fingerprint := ren.fingerprint(t)
+	if len(fingerprint) > 16 {
+		fingerprint = fingerprint[:16]
+	}
+	return fmt.Sprintf("%s.%s.v%d.html", diskCachePrefix(t), fingerprint, version)
+}
+
+// diskCachePrefix turns a template name into the start of its cache file
+// names. Names are escaped as URL path segments ("admin/users" gives
+// "admin%2Fusers"), so two pages never share a prefix.
+func diskCachePrefix(t string) string {
+	return url.PathEscape(t)
+}
+
+// diskCachePage returns the prefix of the page a file of the disk cache
+// (a page or its .keys file) belongs to, as diskCacheName made it.
+func diskCachePage(name string) (prefix string, ok bool) {
+	name, ok = strings.CutSuffix(strings.TrimSuffix(name, ".keys"), ".html")
+	if !ok {
+		return "", false
+	}
+	// Strip the version, then the fingerprint; neither has a dot.
+	for i := 0; i < 2; i++ {
+		dot := strings.LastIndexByte(name, '.')
+		if dot < 0 {
+			return "", false
+		}
+		name = name[:dot]
+	}
+	return name, true
+}
+
+// writeDiskCache writes out to file atomically (write to a temporary file,
+// then rename), removes older files of the same page and prunes the directory
+// to DiskCacheMaxBytes. The surrogate keys of the page, if any, are written
+// to file.keys first, so the page is never served without them; without
+// keys, a file.keys of before is removed.
+func (ren *Render) writeDiskCache(t, file string, out []byte, keys []string) error {
+	if err := os.MkdirAll(ren.DiskCacheDir, 0o755); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := os.WriteFile(file+".keys", []byte(strings.Join(keys, "\n")), 0o644); err != nil {
+			return err
+		}
+	} else if err := os.Remove(file + ".keys"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	tmp, err := os.CreateTemp(ren.DiskCacheDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	entries, err := os.ReadDir(ren.DiskCacheDir)
+	if err != nil {
+		return err
+	}
+	prefix := diskCachePrefix(t)
+	for _, e := range entries {
+		if page, ok := diskCachePage(e.Name()); ok && page == prefix && e.Name() != filepath.Base(file) && e.Name() != filepath.Base(file)+".keys" {
+			os.Remove(filepath.Join(ren.DiskCacheDir, e.Name()))
+		}
+	}
+	return ren.pruneDiskCache()
+}
+
+// pruneDiskCache removes the least recently written pages until the cached
+// files fit in DiskCacheMaxBytes.
+func (ren *Render) pruneDiskCache() error {
+	if ren.DiskCacheMaxBytes <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(ren.DiskCacheDir)
+	if err != nil {
+		return err
+	}
+	var files []fs.FileInfo
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".html") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, info := range files {
+		if total <= ren.DiskCacheMaxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(ren.DiskCacheDir, info.Name())); err == nil {
+			os.Remove(filepath.Join(ren.DiskCacheDir, info.Name()+".keys"))
+			total -= info.Size()
+			if ren.Debug {
+				log.Println("Pruned", info.Name(), "from the disk cache")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package page
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// showDisk renders page through ShowRequest with td, returning the response.
+func showDisk(t *testing.T, ren *Render, page string, td any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := ren.ShowRequest(w, httptest.NewRequest("GET", "/", nil), page, td); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// diskCacheFiles returns the names of the files in the disk cache of ren.
+func diskCacheFiles(t *testing.T, ren *Render) []string {
+	t.Helper()
+	entries, err := os.ReadDir(ren.DiskCacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestDiskCacheOptIn(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"brochure.page.tmpl": `brochure for {{.Name}}`,
+		"account.page.tmpl":  `account of {{.Name}}`,
+	})
+	ren := newTestRender(t, dir)
+	ren.DiskCacheDir = t.TempDir()
+	ren.DiskCachePages = []string{"brochure*"}
+
+	show := func(page string, td map[string]any) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		if err := ren.ShowRequest(w, httptest.NewRequest("GET", "/", nil), page, td); err != nil {
+			t.Fatal(err)
+		}
+		return w.Body.String()
+	}
+
+	// A page not in DiskCachePages is rendered for every request.
+	if got := show("account.page.tmpl", map[string]any{"Name": "alice"}); got != "account of alice" {
+		t.Errorf("got %q", got)
+	}
+	if got := show("account.page.tmpl", map[string]any{"Name": "bob"}); got != "account of bob" {
+		t.Errorf("page not in DiskCachePages served from the disk cache: %q", got)
+	}
+
+	// A page with a CSRF token isn't cached either, even when listed.
+	for _, name := range []string{"alice", "bob"} {
+		if got := show("brochure.page.tmpl", map[string]any{"Name": name, "CSRFToken": "token-" + name}); got != "brochure for "+name {
+			t.Errorf("page with a CSRF token served from the disk cache: %q", got)
+		}
+	}
+	if entries, _ := os.ReadDir(ren.DiskCacheDir); len(entries) != 0 {
+		t.Errorf("disk cache holds %d files, want none", len(entries))
+	}
+
+	// A listed page is cached on disk; td is not part of the key.
+	show("brochure.page.tmpl", map[string]any{"Name": "alice"})
+	if got := show("brochure.page.tmpl", map[string]any{"Name": "bob"}); got != "brochure for alice" {
+		t.Errorf("listed page not served from the disk cache: %q", got)
+	}
+	if entries, _ := os.ReadDir(ren.DiskCacheDir); len(entries) == 0 {
+		t.Error("disk cache is empty")
+	}
+}
+
+func TestDiskCachePage(t *testing.T) {
+	tests := []struct {
+		name, page string
+		ok         bool
+	}{
+		{"home.page.tmpl.0123456789abcdef.v0.html", "home.page.tmpl", true},
+		{"home.page.tmpl.0123456789abcdef.v12.html.keys", "home.page.tmpl", true},
+		{"admin%2Fusers.page.tmpl.0123456789abcdef.v0.html", "admin%2Fusers.page.tmpl", true},
+		{"home.page.tmpl.0123456789abcdef.v0.html.more.0123456789abcdef.v0.html", "home.page.tmpl.0123456789abcdef.v0.html.more", true},
+		{".tmp-123", "", false},
+		{"v0.html", "", false},
+	}
+	for _, tt := range tests {
+		if page, ok := diskCachePage(tt.name); page != tt.page || ok != tt.ok {
+			t.Errorf("diskCachePage(%q) = %q, %v; want %q, %v", tt.name, page, ok, tt.page, tt.ok)
+		}
+	}
+	// Pages whose names used to map to one prefix get their own.
+	for _, pair := range [][2]string{
+		{"admin/users.page.tmpl", "admin_users.page.tmpl"},
+		{`admin\users.page.tmpl`, "admin_users.page.tmpl"},
+		{"a/b_c.page.tmpl", "a_b/c.page.tmpl"},
+	} {
+		if a, b := diskCachePrefix(pair[0]), diskCachePrefix(pair[1]); a == b {
+			t.Errorf("%q and %q have the prefix %q", pair[0], pair[1], a)
+		}
+	}
+}
+
+// Pages whose names differ only in "/" and "_" keep their cached files
+// apart: caching one doesn't remove the other's.
+func TestDiskCacheSimilarNames(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"admin/users.page.tmpl": `nested {{.Name}}`,
+		"admin_users.page.tmpl": `flat {{.Name}}`,
+	})
+	ren := newTestRender(t, dir)
+	ren.DiskCacheDir = t.TempDir()
+	ren.DiskCachePages = []string{"*", "admin/*"}
+
+	for _, name := range []string{"alice", "bob"} {
+		for page, want := range map[string]string{
+			"admin/users.page.tmpl": "nested alice",
+			"admin_users.page.tmpl": "flat alice",
+		} {
+			if got := showDisk(t, ren, page, map[string]any{"Name": name}).Body.String(); got != want {
+				t.Errorf("%s for %s: got %q, want %q", page, name, got, want)
+			}
+		}
+	}
+	if files := diskCacheFiles(t, ren); len(files) != 2 {
+		t.Errorf("disk cache holds %q, want a file per page", files)
+	}
+}
+
+// A page rendered again without surrogate keys loses the .keys file of its
+// earlier render, so the cached file isn't served with keys it no longer has.
+func TestDiskCacheKeysRemoved(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"brochure.page.tmpl": `{{range .Keys}}{{surrogateKey .}}{{end}}brochure`,
+	})
+	ren := newTestRender(t, dir)
+	ren.DiskCacheDir = t.TempDir()
+	ren.DiskCachePages = []string{"brochure*"}
+
+	if got := showDisk(t, ren, "brochure.page.tmpl", map[string]any{"Keys": []string{"product-1"}}).Header().Get(DefaultSurrogateKeyHeader); got != "product-1" {
+		t.Fatalf("first render: surrogate keys %q", got)
+	}
+	if w := showDisk(t, ren, "brochure.page.tmpl", nil); w.Header().Get(DefaultSurrogateKeyHeader) != "product-1" {
+		t.Fatalf("served from the disk cache without its keys")
+	}
+
+	// The file expired, and is rendered again to the same name, now
+	// without keys.
+	ren.DiskCacheTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if got := showDisk(t, ren, "brochure.page.tmpl", map[string]any{"Keys": []string{}}).Header().Get(DefaultSurrogateKeyHeader); got != "" {
+		t.Errorf("render without keys: surrogate keys %q", got)
+	}
+	ren.DiskCacheTTL = 0
+	if got := showDisk(t, ren, "brochure.page.tmpl", nil).Header().Get(DefaultSurrogateKeyHeader); got != "" {
+		t.Errorf("served from the disk cache with the keys of before: %q", got)
+	}
+	for _, f := range diskCacheFiles(t, ren) {
+		if strings.HasSuffix(f, ".keys") {
+			t.Errorf("disk cache still holds %s", f)
+		}
+	}
+}
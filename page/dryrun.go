@@ -0,0 +1,91 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"text/template/parse"
+)
+
+// DryRunOption configures DryRun.
+type DryRunOption func(*dryRunOptions)
+
+type dryRunOptions struct {
+	required []string
+}
+
+// RequireBlocks makes DryRun fail when the set of the page doesn't define
+// every one of blocks, e.g. RequireBlocks("title", "content").
+func RequireBlocks(blocks ...string) DryRunOption {
+	return func(o *dryRunOptions) {
+		o.required = append(o.required, blocks...)
+	}
+}
+
+// DryRun checks that Show would get past resolving and building the page t,
+// without executing anything: it resolves the page (including its variant for
+// the current Environment) and parses it with the partials the way Show does,
+// then checks that the entry template t has content, that every template
+// called with {{template}} is defined and that the RequireBlocks are.
+// Template functions are never called and the cache is left alone.
+func (ren *Render) DryRun(t string, opts ...DryRunOption) error {
+	var o dryRunOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t, err := ren.pageName(t)
+	if err != nil {
+		return err
+	}
+	set, err := ren.parseSet(t, ren.partials())
+	if err != nil {
+		return err
+	}
+	entry := set.tmpl.Lookup(t)
+	if entry == nil || entry.Tree == nil || entry.Tree.Root == nil || onlyWhitespace(entry.Tree.Root) {
+		return fmt.Errorf("%s: entry template is empty", t)
+	}
+
+	missing := make(map[string]bool)
+	for _, name := range o.required {
+		if set.tmpl.Lookup(name) == nil {
+			missing[name] = true
+		}
+	}
+	for _, tmpl := range set.tmpl.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		walkTree(tmpl.Tree.Root, func(n parse.Node) {
+			if call, ok := n.(*parse.TemplateNode); ok && set.tmpl.Lookup(call.Name) == nil {
+				missing[call.Name] = true
+			}
+		})
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, fmt.Sprintf("%q", name))
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%s: templates not defined: %v", t, names)
+	}
+	return nil
+}
+
+// DryRunAll runs DryRun for every page in TemplateDir and returns the errors
+// of all pages joined.
+func (ren *Render) DryRunAll(opts ...DryRunOption) error {
+	pages, err := ren.pageNames()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range pages {
+		if err := ren.DryRun(t, opts...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
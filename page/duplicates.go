@@ -0,0 +1,130 @@
+package page
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// fileDefines is what one template file defines.
+type fileDefines struct {
+	file   string
+	names  []string        // Templates of its {{define}} and {{block}} actions, unless empty.
+	blocks map[string]bool // The names of names defined by a {{block}}.
+}
+
+// CheckDuplicates parses every partial and page on its own and returns an
+// error naming every template defined in more than one file, with the files:
+//   - a name defined with {{define}} in two partials, where the set keeps
+//     whichever is parsed last, which depends on the order of the files
+//   - a name a page defines that a partial also defines with {{define}}
+//
+// A {{block}} in a layout or partial is a default meant to be replaced, by a
+// partial or a page, and is fine; so is an empty definition, which never
+// replaces another.
+//
+// It runs in LoadLayoutsAndPartials when Debug is set and in Validate; call
+// it from CI to fail a build on duplicates.
+func (ren *Render) CheckDuplicates() error {
+	theme := ren.currentTheme()
+	partials, err := ren.definesOf(ren.resolvePartialFiles(ren.partials(), theme))
+	if err != nil {
+		return err
+	}
+	pageNames, err := ren.pageNames()
+	if err != nil {
+		return err
+	}
+	pageFiles := make([]string, 0, len(pageNames))
+	for _, t := range pageNames {
+		pageFiles = append(pageFiles, ren.resolvePage(t, theme))
+	}
+	pages, err := ren.definesOf(pageFiles)
+	if err != nil {
+		return err
+	}
+
+	// Files defining each name among the partials with {{define}}.
+	defined := make(map[string][]string)
+	for _, p := range partials {
+		for _, name := range p.names {
+			if !p.blocks[name] {
+				defined[name] = append(defined[name], p.file)
+			}
+		}
+	}
+
+	var errs []error
+	names := make([]string, 0, len(defined))
+	for name := range defined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if files := defined[name]; len(files) > 1 {
+			errs = append(errs, fmt.Errorf("template %q is defined in more than one partial: %s", name, strings.Join(files, ", ")))
+		}
+	}
+	for _, p := range pages {
+		for _, name := range p.names {
+			if files := defined[name]; len(files) > 0 {
+				errs = append(errs, fmt.Errorf("template %q of page %s is also defined in %s", name, p.file, strings.Join(files, ", ")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// definesOf parses every file of files on its own and returns what each
+// defines, in the order of files. The template named after the file itself
+// doesn't count, nor do empty definitions.
+func (ren *Render) definesOf(files []string) ([]fileDefines, error) {
+	funcs := ren.templateFuncs()
+	result := make([]fileDefines, 0, len(files))
+	for _, file := range files {
+		src, err := ren.readTemplate(file)
+		if err != nil {
+			return nil, err
+		}
+		src, _, err = ren.transformSource(file, src)
+		if err != nil {
+			return nil, err
+		}
+		name := ren.templateName(file)
+		tmpl, err := template.New(name).Funcs(funcs).Parse(string(src))
+		if err != nil {
+			return nil, err
+		}
+		fd := fileDefines{file: file, blocks: make(map[string]bool)}
+		for _, t := range tmpl.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			walkTree(t.Tree.Root, func(n parse.Node) {
+				if tn, ok := n.(*parse.TemplateNode); ok && isBlock(src, tn) {
+					fd.blocks[tn.Name] = true
+				}
+			})
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Name() != name && t.Tree != nil && !parse.IsEmptyTree(t.Tree.Root) {
+				fd.names = append(fd.names, t.Name())
+			}
+		}
+		sort.Strings(fd.names)
+		result = append(result, fd)
+	}
+	return result, nil
+}
+
+// isBlock reports whether the template action tn, parsed from src, is a
+// {{block}} rather than a {{template}}: the parser records both as a
+// TemplateNode positioned at the name, after the keyword.
+func isBlock(src []byte, tn *parse.TemplateNode) bool {
+	before := bytes.TrimRight(src[:tn.Pos], " \t\r\n")
+	return bytes.HasSuffix(before, []byte("block"))
+}
@@ -0,0 +1,96 @@
+package page
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The templates of this repo override the {{block}} defaults of
+// base.layout.tmpl in partials; with Debug, loading them must not fail.
+func TestLoadRepoTemplatesDebug(t *testing.T) {
+	ren := New()
+	ren.TemplateDir = filepath.Join("..", "templates")
+	ren.Debug = true
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := ren.Show(w, "home.page.tmpl", map[string]any{"Data": map[string]any{"payload": "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "link-to-stylesheet.css") {
+		t.Errorf("css.partial.tmpl didn't replace the css block:\n%s", w.Body.String())
+	}
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // Substrings of the error; none for no error.
+	}{
+		{
+			name: "block overridden by partial",
+			files: map[string]string{
+				"base.layout.tmpl":    `{{define "base"}}{{block "css" .}}default{{end}}{{end}}`,
+				"css.partial.tmpl":    `{{define "css"}}<link>{{end}}`,
+				"home.page.tmpl":      `{{template "base" .}}`,
+				"footer.partial.tmpl": `{{define "footer"}}f{{end}}`,
+			},
+		},
+		{
+			name: "empty definitions",
+			files: map[string]string{
+				"a.partial.tmpl": `{{define "x"}}{{end}}`,
+				"b.partial.tmpl": `{{define "x"}}  {{end}}{{define "y"}}y{{end}}`,
+				"home.page.tmpl": `{{define "y"}}{{end}}`,
+			},
+		},
+		{
+			name: "block keyword in a comment",
+			files: map[string]string{
+				"a.partial.tmpl": `{{/* {{block "x" .}} */}}{{define "x"}}a{{end}}`,
+				"b.partial.tmpl": `{{define "x"}}b{{end}}`,
+			},
+			want: []string{`template "x" is defined in more than one partial`},
+		},
+		{
+			name: "two partials",
+			files: map[string]string{
+				"a.partial.tmpl": `{{define "x"}}a{{end}}`,
+				"b.partial.tmpl": `{{template "x" .}}{{define "x"}}b{{end}}`,
+			},
+			want: []string{`template "x" is defined in more than one partial`, "a.partial.tmpl", "b.partial.tmpl"},
+		},
+		{
+			name: "page redefines partial",
+			files: map[string]string{
+				"a.partial.tmpl": `{{define "x"}}a{{end}}`,
+				"home.page.tmpl": `{{block "x" .}}page{{end}}`,
+			},
+			want: []string{`template "x" of page`, "home.page.tmpl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ren := newTestRender(t, writeTemplates(t, tt.files))
+			err := ren.CheckDuplicates()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+}
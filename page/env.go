@@ -0,0 +1,115 @@
+package page
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// envTag returns the marker environment variants of files carry in their
+// name: "prod" for Environment "production", "dev" for "development" and
+// Environment itself otherwise. It is "" when Environment is not set.
+func (ren *Render) envTag() string {
+	switch ren.Environment {
+	case "production":
+		return "prod"
+	case "development":
+		return "dev"
+	}
+	return ren.Environment
+}
+
+// variantName returns the name of the variant of file for tag:
+// "home.page.tmpl" and "prod" give "home.page.prod.tmpl".
+func variantName(file, tag string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + tag + ext
+}
+
+// variantOf reports whether file is an environment variant of another file,
+// which is the case when removing the last dotted part before the extension
+// gives a file that exists: "footer.partial.prod.tmpl" is the "prod" variant
+// of "footer.partial.tmpl" when that file exists.
+func variantOf(file string, exists func(string) bool) (base, tag string, ok bool) {
+	ext := filepath.Ext(file)
+	stem := strings.TrimSuffix(file, ext)
+	i := strings.LastIndex(stem, ".")
+	if i < 0 || strings.ContainsAny(stem[i:], `/\`) {
+		return "", "", false
+	}
+	base = stem[:i] + ext
+	if !exists(base) {
+		return "", "", false
+	}
+	return base, stem[i+1:], true
+}
+
+// selectVariants resolves environment variants in a list of discovered files:
+// a file with a variant for the current environment is replaced by that
+// variant (in its place), and variants for other environments are dropped.
+// Doing this once at discovery means renders never branch on the environment.
+func (ren *Render) selectVariants(files []string) []string {
+	inList := make(map[string]bool, len(files))
+	for _, f := range files {
+		inList[f] = true
+	}
+	exists := func(f string) bool { return inList[f] }
+
+	tag := ren.envTag()
+	var result []string
+	for _, f := range files {
+		if _, _, isVariant := variantOf(f, exists); isVariant {
+			continue
+		}
+		if tag != "" && inList[variantName(f, tag)] {
+			f = variantName(f, tag)
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// resolvePage returns the file to parse for the page t: its variant for the
+// current environment when that exists, the page file itself otherwise. With
+// several TemplateDirs, the last directory having either wins; within a
+// directory, the page of theme comes before the one outside the themes.
+func (ren *Render) resolvePage(t, theme string) string {
+	dirs := ren.templateDirs()
+	tag := ren.envTag()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		roots := []string{dirs[i]}
+		if theme != "" {
+			roots = []string{filepath.Join(dirs[i], themesDir, theme), dirs[i]}
+		}
+		for _, root := range roots {
+			file := filepath.Join(root, filepath.FromSlash(t))
+			if tag != "" && ren.templateExists(variantName(file, tag)) {
+				return variantName(file, tag)
+			}
+			if ren.templateExists(file) {
+				return file
+			}
+		}
+	}
+	return filepath.Join(dirs[0], filepath.FromSlash(t))
+}
+
+// environmentVariants returns, for every file in TemplateDir with environment
+// variants, the variant files, keyed by the base file.
+func (ren *Render) environmentVariants() (map[string][]string, error) {
+	files, err := ren.findTemplates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	inList := make(map[string]bool, len(files))
+	for _, f := range files {
+		inList[f] = true
+	}
+	variants := make(map[string][]string)
+	for _, f := range files {
+		if base, _, ok := variantOf(f, func(b string) bool { return inList[b] }); ok {
+			variants[base] = append(variants[base], f)
+		}
+	}
+	return variants, nil
+}
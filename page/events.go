@@ -0,0 +1,154 @@
+package page
+
+import (
+	"sort"
+	"sync"
+)
+
+// TemplateEventType is the kind of a TemplateEvent.
+type TemplateEventType int
+
+const (
+	TemplateAdded       TemplateEventType = iota + 1 // A partial was added, or WarmReload built a page new to the cache.
+	TemplateChanged                                  // WarmReload rebuilt a page with a new fingerprint.
+	TemplateRemoved                                  // A partial was removed.
+	TemplateInvalidated                              // Cached sets or cached output were dropped.
+	TemplateReloaded                                 // A WarmReload or ReloadSource finished.
+)
+
+// String returns the name of t, e.g. "changed".
+func (t TemplateEventType) String() string {
+	switch t {
+	case TemplateAdded:
+		return "added"
+	case TemplateChanged:
+		return "changed"
+	case TemplateRemoved:
+		return "removed"
+	case TemplateInvalidated:
+		return "invalidated"
+	case TemplateReloaded:
+		return "reloaded"
+	}
+	return "unknown"
+}
+
+// TemplateEvent is a change of the templates of a Render, for purging caches
+// outside of it (a CDN, a fragment cache); see Subscribe.
+type TemplateEvent struct {
+	Type        TemplateEventType
+	Path        string   // The partial file, the page name or the source name; "" for the whole cache.
+	Pages       []string // Names of the pages whose cached sets or output the change affects, sorted.
+	Fingerprint string   // The new fingerprint of the page, for TemplateAdded and TemplateChanged of pages.
+}
+
+// eventBuffer is the number of events a subscriber may be behind before
+// events to it are dropped.
+const eventBuffer = 64
+
+// subscriber is a call of Subscribe.
+type subscriber struct {
+	ch chan TemplateEvent
+}
+
+// eventHub holds the subscribers of Subscribe.
+type eventHub struct {
+	mu      sync.Mutex
+	subs    map[*subscriber]bool
+	dropped int64
+}
+
+// Subscribe calls fn with every TemplateEvent of ren, in the order they
+// happen, until the returned function is called. fn runs in a goroutine of
+// its own, so a slow subscriber never holds up a reload: when it is more
+// than 64 events behind, further events to it are dropped and counted in
+// Stats.EventsDropped.
+//
+// Events come from SetPartials and AddPartials (partials added or removed,
+// then the cached pages dropped), WarmReload and ReloadBundle (partials
+// added or removed, pages added or changed, cached pages dropped without
+// being rebuilt, then TemplateReloaded with the pages rebuilt), ReloadSource
+// and InvalidateDataVersion. Every partial is parsed into every page, so the
+// events of partials name every page in the cache.
+func (ren *Render) Subscribe(fn func(TemplateEvent)) (unsubscribe func()) {
+	s := &subscriber{ch: make(chan TemplateEvent, eventBuffer)}
+	h := &ren.events
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*subscriber]bool)
+	}
+	h.subs[s] = true
+	h.mu.Unlock()
+
+	go func() {
+		for ev := range s.ch {
+			fn(ev)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, s)
+			close(s.ch)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// publish sends the events evs to every subscriber without waiting for any.
+// It may be called with ren.mu held.
+func (ren *Render) publish(evs ...TemplateEvent) {
+	h := &ren.events
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		for _, ev := range evs {
+			select {
+			case s.ch <- ev:
+			default:
+				h.dropped++
+			}
+		}
+	}
+}
+
+// eventsDropped returns the number of events dropped for slow subscribers.
+func (ren *Render) eventsDropped() int64 {
+	ren.events.mu.Lock()
+	defer ren.events.mu.Unlock()
+	return ren.events.dropped
+}
+
+// cachedPagesLocked returns the names of the pages in the cache, sorted. The
+// caller must hold ren.mu.
+func (ren *Render) cachedPagesLocked() []string {
+	pages := make([]string, 0, len(ren.cache))
+	for t := range ren.cache {
+		pages = append(pages, t)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// fileEvents returns a TemplateAdded event for every file in files not in
+// old, and a TemplateRemoved event for every file in old not in files, each
+// naming pages.
+func fileEvents(old, files, pages []string) []TemplateEvent {
+	var evs []TemplateEvent
+	for _, diff := range []struct {
+		typ      TemplateEventType
+		from, in []string
+	}{{TemplateRemoved, old, files}, {TemplateAdded, files, old}} {
+		in := make(map[string]bool, len(diff.in))
+		for _, f := range diff.in {
+			in[f] = true
+		}
+		for _, f := range diff.from {
+			if !in[f] {
+				evs = append(evs, TemplateEvent{Type: diff.typ, Path: f, Pages: pages})
+			}
+		}
+	}
+	return evs
+}
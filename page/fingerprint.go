@@ -0,0 +1,85 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"log"
+)
+
+// fingerprintFiles returns a hash over the names and contents of files.
+// Two template sets built from the same files with the same contents have
+// the same fingerprint.
+func (ren *Render) fingerprintFiles(files []string) (string, error) {
+	h := sha256.New()
+	if err := ren.hashFiles(h, files); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFiles writes the names and contents of files to h, for
+// fingerprintFiles.
+func (ren *Render) hashFiles(h hash.Hash, files []string) error {
+	for _, file := range files {
+		f, err := ren.openTemplate(file)
+		if err != nil {
+			return err
+		}
+		io.WriteString(h, file)
+		h.Write([]byte{0})
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		h.Write([]byte{0})
+	}
+	return nil
+}
+
+// fingerprint returns the fingerprint of the set cached for t, or "" when t
+// has not been built yet.
+func (ren *Render) fingerprint(t string) string {
+	if p, ok := ren.cachedPage(t); ok {
+		return p.fingerprint
+	}
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return ren.fingerprints[t]
+}
+
+// partialsKey returns a hash over the partial files partials and the theme
+// theme, the inputs a set is built with besides its page. A cached set whose
+// key differs from that of Partials and Theme was built with other
+// partials, which happens when the fields are assigned directly instead of
+// through SetPartials or SetTheme. Renders compare the keys in a snapshot of
+// the cache, which is taken again once the fields differ from those it was
+// taken with; then the sets built before are built again. See cachedSet.
+func partialsKey(partials []string, theme string) uint64 {
+	h := fnv.New64a()
+	io.WriteString(h, theme)
+	for _, p := range partials {
+		h.Write([]byte{0})
+		io.WriteString(h, p)
+	}
+	return h.Sum64()
+}
+
+// partialsChanged drops tmpl, the cached set of page t, from the cache, as
+// it was built with other partials or another theme than the current ones,
+// so the render builds it again.
+func (ren *Render) partialsChanged(t string, tmpl *template.Template) {
+	ren.mu.Lock()
+	if ren.cache[t] == tmpl {
+		delete(ren.cache, t)
+		ren.snapshot.Store(nil)
+	}
+	ren.mu.Unlock()
+	if ren.Debug {
+		log.Println("Partials of", t, "changed, building it again")
+	}
+}
@@ -0,0 +1,95 @@
+package page
+
+import (
+	"html/template"
+	"text/template/parse"
+)
+
+// foldStaticTemplates replaces every {{template "name"}} call (and {{block}},
+// which is a call too) in the set tmpl by the text of "name" when that template
+// contains no actions at all: only text, or calls of other such templates.
+// An SVG sprite sheet or a <link> tag partial is then copied into the page at
+// parse time instead of being executed on every render.
+// A template containing even one action is never folded.
+// It must run before the set is executed, and returns the number of calls
+// that were replaced.
+func foldStaticTemplates(tmpl *template.Template) int {
+	f := folder{set: tmpl, text: make(map[string]*string), visiting: make(map[string]bool)}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			f.foldList(t.Tree.Root)
+		}
+	}
+	return f.folded
+}
+
+// folder holds the state of one foldStaticTemplates run.
+type folder struct {
+	set      *template.Template
+	text     map[string]*string // static text per template name; nil when it has actions
+	visiting map[string]bool
+	folded   int
+}
+
+// staticText returns the text of the template name and whether it is static.
+func (f *folder) staticText(name string) (string, bool) {
+	if text, ok := f.text[name]; ok {
+		if text == nil {
+			return "", false
+		}
+		return *text, true
+	}
+	t := f.set.Lookup(name)
+	if t == nil || t.Tree == nil || t.Tree.Root == nil || f.visiting[name] {
+		return "", false
+	}
+
+	f.visiting[name] = true
+	defer delete(f.visiting, name)
+
+	var text []byte
+	for _, node := range t.Tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			text = append(text, n.Text...)
+		case *parse.TemplateNode:
+			called, ok := f.staticText(n.Name)
+			if !ok {
+				f.text[name] = nil
+				return "", false
+			}
+			text = append(text, called...)
+		default:
+			f.text[name] = nil
+			return "", false
+		}
+	}
+	s := string(text)
+	f.text[name] = &s
+	return s, true
+}
+
+// foldList replaces static template calls in list and in the lists below it.
+func (f *folder) foldList(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for i, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TemplateNode:
+			if text, ok := f.staticText(n.Name); ok {
+				list.Nodes[i] = &parse.TextNode{NodeType: parse.NodeText, Pos: n.Pos, Text: []byte(text)}
+				f.folded++
+			}
+		case *parse.IfNode:
+			f.foldList(n.List)
+			f.foldList(n.ElseList)
+		case *parse.RangeNode:
+			f.foldList(n.List)
+			f.foldList(n.ElseList)
+		case *parse.WithNode:
+			f.foldList(n.List)
+			f.foldList(n.ElseList)
+		}
+	}
+}
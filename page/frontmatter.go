@@ -0,0 +1,59 @@
+package page
+
+import (
+	"bytes"
+	"strings"
+)
+
+// splitFrontMatter splits the front matter off the source of a page. Front
+// matter is a block of "key: value" lines between two "---" lines at the very
+// start of the file:
+//
+//	---
+//	title: About us
+//	nav-order: 2
+//	---
+//	{{template "base" .}}
+//
+// It returns the metadata (nil when there is no front matter), the source
+// after it and the number of lines removed, for the source map.
+func splitFrontMatter(src []byte) (meta map[string]string, body []byte, lines int) {
+	rest, ok := bytes.CutPrefix(src, []byte("---\n"))
+	if !ok {
+		rest, ok = bytes.CutPrefix(src, []byte("---\r\n"))
+	}
+	if !ok {
+		return nil, src, 0
+	}
+	meta = make(map[string]string)
+	lines = 1
+	for len(rest) > 0 {
+		line, after, _ := bytes.Cut(rest, []byte("\n"))
+		rest = after
+		lines++
+		text := strings.TrimSpace(string(line))
+		if text == "---" {
+			return meta, rest, lines
+		}
+		if key, value, ok := strings.Cut(text, ":"); ok {
+			meta[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	// No closing line: it wasn't front matter after all.
+	return nil, src, 0
+}
+
+// PageMeta returns the front matter of the page t (see splitFrontMatter), or
+// nil when it has none.
+func (ren *Render) PageMeta(t string) (map[string]string, error) {
+	t, err := ren.pageName(t)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ren.readTemplate(ren.resolvePage(t, ren.currentTheme()))
+	if err != nil {
+		return nil, err
+	}
+	meta, _, _ := splitFrontMatter(src)
+	return meta, nil
+}
@@ -0,0 +1,156 @@
+package page
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FuncTiming is what the calls of one function from one page took, as
+// reported in Stats.Funcs.
+type FuncTiming struct {
+	Calls int64
+	Total time.Duration
+}
+
+// funcCounter counts the calls of one function from one page.
+type funcCounter struct {
+	calls atomic.Int64
+	nanos atomic.Int64
+}
+
+// funcProfile holds the counters of every function wrapped by profiledFuncs,
+// by page and function name.
+type funcProfile struct {
+	mu       sync.Mutex
+	counters map[string]map[string]*funcCounter
+}
+
+// counter returns the counter of fn in page t, adding it on first use. Sets
+// built again (reloads) keep counting into the same counter.
+func (p *funcProfile) counter(t, fn string) *funcCounter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counters == nil {
+		p.counters = make(map[string]map[string]*funcCounter)
+	}
+	if p.counters[t] == nil {
+		p.counters[t] = make(map[string]*funcCounter)
+	}
+	c := p.counters[t][fn]
+	if c == nil {
+		c = &funcCounter{}
+		p.counters[t][fn] = c
+	}
+	return c
+}
+
+// snapshot returns the timings per page and function, or nil when nothing
+// is profiled.
+func (p *funcProfile) snapshot() map[string]map[string]FuncTiming {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.counters) == 0 {
+		return nil
+	}
+	timings := make(map[string]map[string]FuncTiming, len(p.counters))
+	for t, fns := range p.counters {
+		timings[t] = make(map[string]FuncTiming, len(fns))
+		for fn, c := range fns {
+			timings[t][fn] = FuncTiming{Calls: c.calls.Load(), Total: time.Duration(c.nanos.Load())}
+		}
+	}
+	return timings
+}
+
+// setFuncs returns the function map of the set of page t: templateFuncs,
+// with the functions of ren.Functions and the components wrapped to count
+// into the profile of t when ProfileFuncs is set.
+func (ren *Render) setFuncs(t string) template.FuncMap {
+	funcs := ren.templateFuncs()
+	if !ren.ProfileFuncs {
+		return funcs
+	}
+	ren.mu.RLock()
+	names := make([]string, 0, len(ren.Functions)+len(ren.components))
+	for name := range ren.Functions {
+		names = append(names, name)
+	}
+	for name := range ren.components {
+		if _, ok := ren.Functions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	ren.mu.RUnlock()
+	for _, name := range names {
+		funcs[name] = profiledFunc(funcs[name], ren.funcProfile.counter(t, name))
+	}
+	return funcs
+}
+
+// profiledFunc returns fn wrapped to count its calls and their duration into
+// c. The wrapper is built with reflect.MakeFunc and has the exact type of fn,
+// so the template package checks and calls it as it would fn: arguments,
+// variadic calls and the (value, error) results are passed through as they
+// are, and an error still stops the execution. A call that panics is counted
+// too. Values that aren't functions are returned as they are, for Funcs to
+// reject.
+func profiledFunc(fn any, c *funcCounter) any {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fn
+	}
+	return reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+		start := time.Now()
+		defer func() {
+			c.calls.Add(1)
+			c.nanos.Add(int64(time.Since(start)))
+		}()
+		if v.Type().IsVariadic() {
+			return v.CallSlice(args)
+		}
+		return v.Call(args)
+	}).Interface()
+}
+
+// funcEntry is one entry in the response of the /funcs debug endpoint.
+type funcEntry struct {
+	Template string `json:"template"`
+	Func     string `json:"func"`
+	Calls    int64  `json:"calls"`
+	Total    string `json:"total"`
+	Mean     string `json:"mean"`
+
+	total time.Duration
+}
+
+// debugFuncs serves the /funcs debug endpoint.
+func (ren *Render) debugFuncs(w http.ResponseWriter, r *http.Request) {
+	entries := []funcEntry{}
+	for t, fns := range ren.Stats().Funcs {
+		for fn, ft := range fns {
+			var mean time.Duration
+			if ft.Calls > 0 {
+				mean = ft.Total / time.Duration(ft.Calls)
+			}
+			entries = append(entries, funcEntry{Template: t, Func: fn, Calls: ft.Calls, Total: ft.Total.String(), Mean: mean.String(), total: ft.Total})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.total != b.total {
+			return a.total > b.total
+		}
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		return a.Func < b.Func
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,51 @@
+package page
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errNoKey = errors.New("no such key")
+
+// Wrapped functions behave as the functions themselves: a (value, error)
+// function still fails the render with its error, and variadic calls pass
+// their arguments through.
+func TestProfileFuncsErrors(t *testing.T) {
+	for _, profile := range []bool{false, true} {
+		ren := newTestRender(t, writeTemplates(t, map[string]string{
+			"home.page.tmpl": `{{lookup .}} {{join "-" "a" "b" "c"}}`,
+		}))
+		ren.ProfileFuncs = profile
+		ren.AddFunc("lookup", func(key string) (string, error) {
+			if key == "bad" {
+				return "", errNoKey
+			}
+			return "value of " + key, nil
+		})
+		ren.AddFunc("join", func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		})
+
+		got, err := ren.String("home.page.tmpl", "good")
+		if err != nil || got != "value of good a-b-c" {
+			t.Errorf("profile %v: got %q, %v", profile, got, err)
+		}
+		_, err = ren.String("home.page.tmpl", "bad")
+		var re *RenderError
+		if !errors.Is(err, errNoKey) || !errors.As(err, &re) {
+			t.Errorf("profile %v: error %v, want a *RenderError wrapping errNoKey", profile, err)
+		}
+
+		funcs := ren.Stats().Funcs["home.page.tmpl"]
+		if !profile {
+			if funcs != nil {
+				t.Errorf("profiled without ProfileFuncs: %+v", funcs)
+			}
+			continue
+		}
+		if funcs["lookup"].Calls != 2 || funcs["join"].Calls != 1 {
+			t.Errorf("calls: %+v", funcs)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package page
+
+import (
+	"fmt"
+	"html/template"
+)
+
+// templateFuncs returns the function map handed to template.Funcs when a
+// template set is built.
+// It starts with the functions this package provides itself and then adds
+// ren.Functions on top, so a user function with the same name always wins.
+// A fresh map is returned on every call: the result belongs to the one
+// template set being built and is never shared with other sets or clones.
+func (ren *Render) templateFuncs() template.FuncMap {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+
+	funcs := template.FuncMap{
+		"global":   ren.global,
+		"langAttr": ren.langAttr,
+		"dirAttr":  ren.dirAttr,
+		"dict":     dict,
+		"img":      ren.img,
+		"status":   noHint,
+		"header":   noHint,
+		"theme":    noHint,
+		"remote":   ren.remote,
+		"now":      ren.now,
+
+		"noWatermark":  noWatermark,
+		"surrogateKey": noSurrogateKey,
+	}
+	if ren.Coverage != nil {
+		funcs["pageCoverage"] = ren.Coverage.hit
+	}
+	if ren.TraceBlocks > 0 {
+		funcs["pageBlockStart"] = noBlockMarker
+		funcs["pageBlockEnd"] = noBlockMarker
+	}
+	ren.componentFuncs(funcs)
+	for name, fn := range ren.Functions {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// global is the {{global "key"}} template function.
+// It returns the value stored under key in GlobalData, or nil when there is none.
+func (ren *Render) global(key string) any {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return ren.GlobalData[key]
+}
+
+// dict is the {{dict "key" value "key2" value2}} template function. It builds a
+// map from key/value pairs, e.g. to pass several values to a partial or helper.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments (%d)", len(pairs))
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is a %T, not a string", pairs[i], pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// needsHTMLLang reports whether postProcess sets lang and dir on <html>.
+func (ren *Render) needsHTMLLang(tmpl *template.Template) bool {
+	return ren.SetHTMLLang && ren.Locale != "" && !usesFunc(tmpl, "langAttr", "dirAttr")
+}
+
+// postProcess applies the output rewrites enabled on ren to the rendered
+// output of tmpl:
+//   - with SetHTMLLang, lang and dir are set on <html>
+//   - with Environment "staging" or Watermark (never in "production"), an
+//     environment banner is inserted before </body>; pages without </body>
+//     are left alone, and a page opts out by calling {{noWatermark}}
+func (ren *Render) postProcess(tmpl *template.Template, out []byte) []byte {
+	if ren.needsHTMLLang(tmpl) {
+		out = setHTMLLang(out, ren.Locale)
+	}
+	if ren.needsWatermark(tmpl) {
+		out = ren.watermark(out)
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GroupError is returned by RenderGroup when members of the group failed.
+// Errors holds the error of every failed member by name.
+type GroupError struct {
+	Errors map[string]error
+}
+
+// Error lists the failed members in name order.
+func (e *GroupError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + e.Errors[name].Error()
+	}
+	return "render group: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the member errors, so errors.Is and errors.As look into them.
+func (e *GroupError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// GroupOption changes how RenderGroup behaves.
+type GroupOption func(*groupOptions)
+
+type groupOptions struct {
+	allowPartial bool
+}
+
+// AllowPartial makes RenderGroup return the outputs of the members that did
+// render, together with a *GroupError for the ones that failed. Without it,
+// a failing member means no outputs at all.
+func AllowPartial() GroupOption {
+	return func(o *groupOptions) {
+		o.allowPartial = true
+	}
+}
+
+// RenderGroup renders several templates with the same data and returns the
+// outputs by name. It is meant for things that belong together, like the
+// subject, preheader, HTML body and text body of an email.
+// @ names:
+// -	template names: "welcome.page.tmpl", or a block of one: "welcome.page.tmpl#subject"
+// @ td:
+// -	template data, passed to every member
+//
+// Members from the same file share one (cached) template set.
+// When a member fails, the returned error is a *GroupError naming it.
+func (ren *Render) RenderGroup(names []string, td any, opts ...GroupOption) (map[string]string, error) {
+	var o groupOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	outputs := make(map[string]string, len(names))
+	failed := make(map[string]error)
+	for _, name := range names {
+		out, err := ren.renderMember(name, td)
+		if err != nil {
+			failed[name] = err
+			continue
+		}
+		outputs[name] = out
+	}
+
+	if len(failed) == 0 {
+		return outputs, nil
+	}
+	if o.allowPartial {
+		return outputs, &GroupError{Errors: failed}
+	}
+	return nil, &GroupError{Errors: failed}
+}
+
+// renderMember renders one member of a group: a template, or a block of a
+// template when name has the form "file#block".
+func (ren *Render) renderMember(name string, td any) (string, error) {
+	t, block, _ := strings.Cut(name, "#")
+	if block == "" {
+		block = t
+	}
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		return "", err
+	}
+	if tmpl.Lookup(block) == nil {
+		return "", errors.New("no block " + block + " defined in " + t)
+	}
+	out, err := ren.execute(tmpl, block, td)
+	if err != nil {
+		return "", fmt.Errorf("executing %s: %w", name, err)
+	}
+	return string(out), nil
+}
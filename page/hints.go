@@ -0,0 +1,104 @@
+package page
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// DefaultTemplateHeaders are the response headers a template may set with
+// {{header}} when TemplateHeaders is nil.
+var DefaultTemplateHeaders = []string{"Cache-Control", "Content-Language", "Link", "X-Robots-Tag"}
+
+// hintFuncs are the template functions that only do something in a
+// request-aware render (ShowRequest). Sets using them keep an unexecuted
+// prototype so every such render can bind its own functions.
+var hintFuncs = []string{"status", "header", "theme"}
+
+// responseHints collects the status and headers a template asks for while it
+// is executed by ShowRequest.
+type responseHints struct {
+	allowed map[string]bool
+	status  int
+	header  http.Header
+	theme   string // The result of {{theme}}, see ThemeResolver.
+}
+
+// newResponseHints returns an empty collector allowing the headers in
+// TemplateHeaders (or DefaultTemplateHeaders).
+func (ren *Render) newResponseHints() *responseHints {
+	allowedHeaders := ren.TemplateHeaders
+	if allowedHeaders == nil {
+		allowedHeaders = DefaultTemplateHeaders
+	}
+	h := &responseHints{allowed: make(map[string]bool), header: make(http.Header)}
+	for _, name := range allowedHeaders {
+		h.allowed[http.CanonicalHeaderKey(name)] = true
+	}
+	return h
+}
+
+// funcs returns the {{status}} and {{header}} functions recording into h,
+// and {{theme}} returning its theme.
+func (h *responseHints) funcs() template.FuncMap {
+	return template.FuncMap{
+		"status": func(code int) (string, error) {
+			if code < 100 || code > 599 {
+				return "", fmt.Errorf("status: invalid status code %d", code)
+			}
+			h.status = code
+			return "", nil
+		},
+		"header": func(name, value string) (string, error) {
+			if !h.allowed[http.CanonicalHeaderKey(name)] {
+				return "", fmt.Errorf("header: templates may not set %q", name)
+			}
+			h.header.Set(name, value)
+			return "", nil
+		},
+		"theme": func() string {
+			return h.theme
+		},
+	}
+}
+
+// apply copies the collected headers to w, skipping any header the handler
+// already set (the handler wins), and returns the status to write.
+func (h *responseHints) apply(w http.ResponseWriter) int {
+	for name, values := range h.header {
+		if _, set := w.Header()[name]; !set {
+			w.Header()[name] = values
+		}
+	}
+	if h.status == 0 {
+		return http.StatusOK
+	}
+	return h.status
+}
+
+// noHint is the {{status}}, {{header}} and {{theme}} function outside
+// ShowRequest: String, Render and Show ignore response hints, and {{theme}}
+// is "" there.
+func noHint(args ...any) string {
+	return ""
+}
+
+// hintTemplate returns a copy of the prototype of t with the functions of h
+// bound, or nil when t doesn't use response hints.
+func (ren *Render) hintTemplate(t string, h *responseHints) (*template.Template, error) {
+	p, ok := ren.cachedPage(t)
+	if !ok {
+		ren.mu.RLock()
+		p.proto = ren.protos[t]
+		ren.mu.RUnlock()
+	}
+	proto := p.proto
+	if proto == nil {
+		return nil, nil
+	}
+	clone, err := proto.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(h.funcs()), nil
+}
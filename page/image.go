@@ -0,0 +1,247 @@
+package page
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// imageSize holds the dimensions of an image in the asset directory.
+type imageSize struct {
+	Width, Height int
+}
+
+// imageExtensions are the file types LoadImageSizes probes.
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// LoadImageSizes reads the dimensions of every JPEG, PNG and WebP image in
+// AssetDir and caches them for the {{img}} template function. Call it at
+// startup, and again when the images change: it replaces the whole cache.
+// Images that are not in the cache are probed on first use.
+// The cache is dropped with the template cache (ClearCache, Reload,
+// WarmReload, AddFunc, ...), so an image added or replaced since, or one
+// found missing before, is probed again after those too.
+func (ren *Render) LoadImageSizes() error {
+	sizes := make(map[string]imageSize)
+	err := filepath.WalkDir(ren.AssetDir, func(s string, d fs.DirEntry, e error) error {
+		if e != nil {
+			return e
+		}
+		if d.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(s))] {
+			return nil
+		}
+		size, err := probeImageFile(s)
+		if err != nil {
+			if ren.Debug {
+				log.Println("Skipping image", s, "-", err)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(ren.AssetDir, s)
+		if err != nil {
+			return err
+		}
+		sizes[filepath.ToSlash(rel)] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ren.mu.Lock()
+	ren.imageSizes, ren.imageSizesGen = sizes, ren.cacheGen
+	ren.mu.Unlock()
+	return nil
+}
+
+// imageSize returns the dimensions of the image name (relative to AssetDir),
+// probing and caching it when it is not cached yet. Sizes cached before the
+// template cache was last cleared (see cacheGen) are probed again.
+func (ren *Render) imageSize(name string) (imageSize, error) {
+	ren.mu.RLock()
+	size, ok := ren.imageSizes[name]
+	ok = ok && ren.imageSizesGen == ren.cacheGen
+	ren.mu.RUnlock()
+	if ok {
+		if size.Width == 0 {
+			return imageSize{}, errImageUnreadable
+		}
+		return size, nil
+	}
+
+	// Images that can't be probed are cached as a zero size, so a missing
+	// image (or srcset variant) doesn't cost a file open on every render.
+	size, err := probeImageFile(filepath.Join(ren.AssetDir, filepath.FromSlash(name)))
+	ren.mu.Lock()
+	if ren.imageSizes == nil || ren.imageSizesGen != ren.cacheGen {
+		ren.imageSizes, ren.imageSizesGen = make(map[string]imageSize), ren.cacheGen
+	}
+	ren.imageSizes[name] = size
+	ren.mu.Unlock()
+	return size, err
+}
+
+// errImageUnreadable is returned for images that were probed before and
+// turned out missing or unreadable.
+var errImageUnreadable = errors.New("image missing or unreadable")
+
+// imageVariant returns the file name of the variant of name for density,
+// using ImageVariant when set and the "hero@2x.jpg" convention otherwise.
+func (ren *Render) imageVariant(name string, density int) string {
+	if ren.ImageVariant != nil {
+		return ren.ImageVariant(name, density)
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s@%dx%s", strings.TrimSuffix(name, ext), density, ext)
+}
+
+// assetURL returns the URL of the asset name.
+func (ren *Render) assetURL(name string) string {
+	if ren.AssetURL == "" {
+		return name
+	}
+	return strings.TrimSuffix(ren.AssetURL, "/") + "/" + strings.TrimPrefix(name, "/")
+}
+
+// img is the {{img "hero.jpg" "Hero" (dict "sizes" "100vw")}} template function.
+// It returns an <img> tag with the width and height of the image, loading="lazy"
+// and, when ImageDensities is set and variants exist, a srcset. Keys of the
+// optional attribute map are added as attributes and may override loading.
+// An image that is missing or can't be read gives a plain tag without
+// dimensions (and a log line in Debug) instead of failing the page.
+func (ren *Render) img(name, alt string, attrs ...map[string]any) template.HTML {
+	attributes := map[string]string{
+		"src":     ren.assetURL(name),
+		"alt":     alt,
+		"loading": "lazy",
+	}
+
+	size, err := ren.imageSize(name)
+	if err != nil {
+		if ren.Debug {
+			log.Println("img:", name, "-", err)
+		}
+	} else {
+		attributes["width"] = fmt.Sprint(size.Width)
+		attributes["height"] = fmt.Sprint(size.Height)
+
+		var srcset []string
+		for _, density := range ren.ImageDensities {
+			variant := ren.imageVariant(name, density)
+			variantSize, err := ren.imageSize(variant)
+			if err != nil {
+				continue
+			}
+			srcset = append(srcset, fmt.Sprintf("%s %dw", ren.assetURL(variant), variantSize.Width))
+		}
+		if len(srcset) > 0 {
+			srcset = append([]string{fmt.Sprintf("%s %dw", attributes["src"], size.Width)}, srcset...)
+			attributes["srcset"] = strings.Join(srcset, ", ")
+		}
+	}
+
+	for _, m := range attrs {
+		for k, v := range m {
+			attributes[k] = fmt.Sprint(v)
+		}
+	}
+
+	// Write src and alt first and the rest sorted, so output is stable.
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		if k != "src" && k != "alt" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"src", "alt"}, keys...)
+
+	var b strings.Builder
+	b.WriteString("<img")
+	for _, k := range keys {
+		fmt.Fprintf(&b, ` %s="%s"`, template.HTMLEscapeString(k), template.HTMLEscapeString(attributes[k]))
+	}
+	b.WriteString(">")
+	return template.HTML(b.String())
+}
+
+// probeImageFile reads the dimensions of a JPEG, PNG or WebP file from its header.
+func probeImageFile(file string) (imageSize, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return imageSize{}, err
+	}
+	defer f.Close()
+	return probeImage(f)
+}
+
+// probeImage reads the dimensions of a JPEG, PNG or WebP image from its header,
+// without decoding the pixels.
+func probeImage(r io.Reader) (imageSize, error) {
+	header := make([]byte, 30)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return imageSize{}, err
+	}
+	header = header[:n]
+
+	if len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP" {
+		return probeWebP(header)
+	}
+
+	// JPEG and PNG are handled by the standard library's DecodeConfig.
+	config, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(header), r))
+	if err != nil {
+		return imageSize{}, err
+	}
+	return imageSize{Width: config.Width, Height: config.Height}, nil
+}
+
+// probeWebP reads the dimensions from the first 30 bytes of a WebP file.
+// WebP has three flavours, each storing the size differently:
+// -	"VP8 " (lossy): 14 bit width and height after the frame start code
+// -	"VP8L" (lossless): 14 bit width-1 and height-1 packed after a signature byte
+// -	"VP8X" (extended): 24 bit canvas width-1 and height-1
+func probeWebP(header []byte) (imageSize, error) {
+	if len(header) < 30 {
+		return imageSize{}, errors.New("webp: header too short")
+	}
+	switch string(header[12:16]) {
+	case "VP8 ":
+		if header[23] != 0x9d || header[24] != 0x01 || header[25] != 0x2a {
+			return imageSize{}, errors.New("webp: missing VP8 start code")
+		}
+		return imageSize{
+			Width:  int(binary.LittleEndian.Uint16(header[26:28]) & 0x3fff),
+			Height: int(binary.LittleEndian.Uint16(header[28:30]) & 0x3fff),
+		}, nil
+	case "VP8L":
+		if header[20] != 0x2f {
+			return imageSize{}, errors.New("webp: missing VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		return imageSize{
+			Width:  int(bits&0x3fff) + 1,
+			Height: int(bits>>14&0x3fff) + 1,
+		}, nil
+	case "VP8X":
+		return imageSize{
+			Width:  int(uint32(header[24])|uint32(header[25])<<8|uint32(header[26])<<16) + 1,
+			Height: int(uint32(header[27])|uint32(header[28])<<8|uint32(header[29])<<16) + 1,
+		}, nil
+	}
+	return imageSize{}, errors.New("webp: unknown chunk " + string(header[12:16]))
+}
@@ -0,0 +1,157 @@
+package page
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePNG writes a PNG of w×h pixels to file.
+func writePNG(t *testing.T, file string, w, h int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// webpHeader returns the first 30 bytes of a WebP file of the chunk type
+// chunk, with payload written from byte 20 on.
+func webpHeader(chunk string, payload []byte) []byte {
+	h := make([]byte, 30)
+	copy(h, "RIFF")
+	copy(h[8:], "WEBP")
+	copy(h[12:], chunk)
+	copy(h[20:], payload)
+	return h
+}
+
+func TestProbeImage(t *testing.T) {
+	var pngBuf, jpegBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, image.NewGray(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegBuf, image.NewGray(image.Rect(0, 0, 64, 48)), nil); err != nil {
+		t.Fatal(err)
+	}
+	vp8 := make([]byte, 10)
+	copy(vp8[3:], []byte{0x9d, 0x01, 0x2a})
+	binary.LittleEndian.PutUint16(vp8[6:], 320)
+	binary.LittleEndian.PutUint16(vp8[8:], 200)
+	vp8l := make([]byte, 5)
+	vp8l[0] = 0x2f
+	binary.LittleEndian.PutUint32(vp8l[1:], (100-1)|(50-1)<<14)
+	vp8x := make([]byte, 10)
+	copy(vp8x[4:], []byte{0xff, 0x0f, 0x00}) // 4096-1
+	copy(vp8x[7:], []byte{0xff, 0x07, 0x00}) // 2048-1
+
+	tests := []struct {
+		name string
+		data []byte
+		want imageSize
+		err  bool
+	}{
+		{"png", pngBuf.Bytes(), imageSize{40, 30}, false},
+		{"jpeg", jpegBuf.Bytes(), imageSize{64, 48}, false},
+		{"webp lossy", webpHeader("VP8 ", vp8), imageSize{320, 200}, false},
+		{"webp lossless", webpHeader("VP8L", vp8l), imageSize{100, 50}, false},
+		{"webp extended", webpHeader("VP8X", vp8x), imageSize{4096, 2048}, false},
+		{"webp unknown chunk", webpHeader("ABCD", nil), imageSize{}, true},
+		{"webp short", webpHeader("VP8X", nil)[:20], imageSize{}, true},
+		{"not an image", []byte("GIF89a, or rather not"), imageSize{}, true},
+		{"empty", nil, imageSize{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeImage(bytes.NewReader(tt.data))
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, want error %t", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newImageRender(t *testing.T) *Render {
+	t.Helper()
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"home.page.tmpl": `{{img "hero.png" "Hero"}}`,
+	}))
+	ren.AssetDir = t.TempDir()
+	ren.AssetURL = "/static/"
+	return ren
+}
+
+func TestImg(t *testing.T) {
+	ren := newImageRender(t)
+	ren.ImageDensities = []int{2, 3}
+	writePNG(t, filepath.Join(ren.AssetDir, "hero.png"), 40, 30)
+	writePNG(t, filepath.Join(ren.AssetDir, "hero@2x.png"), 80, 60)
+
+	got, err := ren.String("home.page.tmpl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<img src="/static/hero.png" alt="Hero" height="30" loading="lazy" srcset="/static/hero.png 40w, /static/hero@2x.png 80w" width="40">`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// An image missing at its first render is probed again once the template
+// cache is cleared or reloaded, and so is one replaced since.
+func TestImgProbedAgain(t *testing.T) {
+	ren := newImageRender(t)
+	file := filepath.Join(ren.AssetDir, "hero.png")
+	render := func() string {
+		t.Helper()
+		got, err := ren.String("home.page.tmpl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	const (
+		missing = `<img src="/static/hero.png" alt="Hero" loading="lazy">`
+		small   = `<img src="/static/hero.png" alt="Hero" height="30" loading="lazy" width="40">`
+		large   = `<img src="/static/hero.png" alt="Hero" height="60" loading="lazy" width="80">`
+	)
+
+	if got := render(); got != missing {
+		t.Fatalf("missing image: %s", got)
+	}
+	writePNG(t, file, 40, 30)
+	if got := render(); got != missing {
+		t.Errorf("missing image probed again before the cache was cleared: %s", got)
+	}
+	ren.ClearCache()
+	if got := render(); got != small {
+		t.Errorf("after ClearCache: %s", got)
+	}
+
+	writePNG(t, file, 80, 60)
+	if err := ren.Reload([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != large {
+		t.Errorf("after Reload: %s", got)
+	}
+
+	writePNG(t, file, 40, 30)
+	if err := ren.WarmReload(WarmReloadOptions{FileTypes: []string{".layout", ".partial"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != small {
+		t.Errorf("after WarmReload: %s", got)
+	}
+}
@@ -0,0 +1,190 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// StartOptions configures Start.
+type StartOptions struct {
+	// Layout and partial types to discover, as for LoadLayoutsAndPartials.
+	FileTypes []string
+	// Run Validate after discovery. Build errors fail Start; findings are
+	// logged, and fail Start too when FailOnFindings is set.
+	Validate       bool
+	FailOnFindings bool
+	// Build pages into the cache before Start returns. Critical pages are
+	// built first, then the other pages in TemplateDir.
+	Warm     bool
+	Critical []string
+	// Run Watch in the background once the other phases are done, until
+	// Stop is called or the context of Start is done. Its first scan is part
+	// of Start, so a file edited after Start returned is noticed.
+	Watch bool
+	// Called after every phase ("sources", "discover", "validate", "warm",
+	// "watch") with the time it took and its error, if any. Phases are
+	// logged when Debug is set.
+	OnPhase func(phase string, took time.Duration, err error)
+}
+
+// lifecycle holds what Start launched, for Stop.
+type lifecycle struct {
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	ctx        context.Context // Done when Stop is called; nil before Start.
+	stopped    bool            // Stop was called and Start wasn't called since.
+	background sync.WaitGroup
+}
+
+// goBackground runs fn in a goroutine Stop waits for, with a context that is
+// done when Stop is called. It returns false, without running fn, after Stop.
+func (ren *Render) goBackground(fn func(ctx context.Context)) bool {
+	ren.life.mu.Lock()
+	defer ren.life.mu.Unlock()
+	if ren.life.stopped {
+		return false
+	}
+	ctx := ren.life.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ren.life.background.Add(1)
+	go func() {
+		defer ren.life.background.Done()
+		fn(ctx)
+	}()
+	return true
+}
+
+// Start runs the startup of ren in order: merging the sources registered with
+// RegisterSource, discovery of layouts and partials, then optionally
+// validation, pre-warming of the cache and watching the template files (see
+// Watch). ctx is checked
+// between phases and between pages while warming; Start returns ctx.Err()
+// when it is cancelled. A failed Start stops again, so it can be retried.
+// Work Start leaves running in the background stops with Stop (or when ctx
+// is cancelled).
+//
+// Start fits errgroup-based startups:
+//
+//	g.Go(func() error { return ren.Start(ctx, page.StartOptions{FileTypes: []string{".layout", ".partial"}, Warm: true}) })
+func (ren *Render) Start(ctx context.Context, opts StartOptions) error {
+	ren.life.mu.Lock()
+	if ren.life.cancel != nil {
+		ren.life.mu.Unlock()
+		return errors.New("Start called twice without Stop")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ren.life.cancel, ren.life.ctx, ren.life.stopped = cancel, ctx, false
+	ren.life.mu.Unlock()
+
+	phases := []struct {
+		name string
+		on   bool
+		run  func(context.Context) error
+	}{
+		{"sources", true, func(context.Context) error { return ren.mergeSources() }},
+		{"discover", true, func(ctx context.Context) error { return ren.LoadLayoutsAndPartialsContext(ctx, opts.FileTypes) }},
+		{"validate", opts.Validate, func(context.Context) error { return ren.startValidate(opts.FailOnFindings) }},
+		{"warm", opts.Warm, func(ctx context.Context) error { return ren.warm(ctx, opts.Critical) }},
+		{"watch", opts.Watch, ren.startWatch},
+	}
+	for _, phase := range phases {
+		if !phase.on {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			ren.Stop(context.Background())
+			return err
+		}
+		start := time.Now()
+		err := phase.run(ctx)
+		took := time.Since(start)
+		if ren.Debug {
+			log.Println("Start:", phase.name, "took", took, err)
+		}
+		if opts.OnPhase != nil {
+			opts.OnPhase(phase.name, took, err)
+		}
+		if err != nil {
+			ren.Stop(context.Background())
+			return fmt.Errorf("start %s: %w", phase.name, err)
+		}
+	}
+	return nil
+}
+
+// Stop stops what Start left running in the background, i.e. Watch, and the
+// background refreshes of the disk cache (see DiskCacheGrace), and waits for
+// them to finish, or for ctx to be done. No new background work starts after Stop;
+// Start may be called again after it.
+func (ren *Render) Stop(ctx context.Context) error {
+	ren.life.mu.Lock()
+	cancel := ren.life.cancel
+	ren.life.cancel, ren.life.ctx, ren.life.stopped = nil, nil, true
+	ren.life.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ren.life.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startValidate is the validation phase of Start.
+func (ren *Render) startValidate(failOnFindings bool) error {
+	findings, err := ren.Validate()
+	for _, f := range findings {
+		log.Println("validate:", f)
+	}
+	if err != nil {
+		return err
+	}
+	if failOnFindings && len(findings) > 0 {
+		return fmt.Errorf("%d validation findings", len(findings))
+	}
+	return nil
+}
+
+// startWatch is the watch phase of Start: it scans the template files, and
+// watches them in the background until Stop.
+func (ren *Render) startWatch(ctx context.Context) error {
+	files, err := ren.scanFiles(ctx)
+	if err != nil {
+		return err
+	}
+	if !ren.goBackground(func(ctx context.Context) { ren.watch(ctx, files) }) {
+		return errors.New("stopped")
+	}
+	return nil
+}
+
+// warm builds the critical pages and then every other page into the cache.
+func (ren *Render) warm(ctx context.Context, critical []string) error {
+	pages, err := ren.pageNames()
+	if err != nil {
+		return err
+	}
+	for _, t := range dedupe(critical, append(pages, ren.sourcePageNames()...)) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := ren.buildTemplate(t); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package page
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Start with Watch serves edited files until Stop, which ends the watch.
+func TestStartWatch(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}[{{template "footer" .}}]{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}v1{{end}}`,
+		"home.page.tmpl":      `{{template "base" .}}`,
+	})
+	ren := New()
+	ren.TemplateDir = dir
+	ren.UseCache = true
+	ren.WatchPoll = 10 * time.Millisecond
+	var phases []string
+	err := ren.Start(context.Background(), StartOptions{
+		FileTypes: []string{".layout", ".partial"},
+		Warm:      true,
+		Watch:     true,
+		OnPhase:   func(phase string, _ time.Duration, _ error) { phases = append(phases, phase) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sources", "discover", "warm", "watch"}; !reflect.DeepEqual(phases, want) {
+		t.Errorf("phases %q, want %q", phases, want)
+	}
+	render := func(want string) func() bool {
+		return func() bool {
+			got, err := ren.String("home.page.tmpl", nil)
+			return err == nil && got == want
+		}
+	}
+	write := func(src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "footer.partial.tmpl"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first scan was taken by Start: a write right after it is seen.
+	write(`{{define "footer"}}v2{{end}}`)
+	waitFor(t, "the edited footer", render("[v2]"))
+
+	if err := ren.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	write(`{{define "footer"}}v3 after Stop{{end}}`)
+	time.Sleep(10 * ren.WatchPoll)
+	if !render("[v2]")() {
+		t.Error("a file edited after Stop was picked up")
+	}
+
+	// Start may be called again after Stop, and watches again.
+	if err := ren.Start(context.Background(), StartOptions{FileTypes: []string{".layout", ".partial"}, Watch: true}); err != nil {
+		t.Fatal(err)
+	}
+	defer ren.Stop(context.Background())
+	waitFor(t, "the footer after the second Start", render("[v3 after Stop]"))
+	write(`{{define "footer"}}v4{{end}}`)
+	waitFor(t, "the footer edited after the second Start", render("[v4]"))
+}
@@ -0,0 +1,240 @@
+package page
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Loader is a source of template files, for templates that are not on disk
+// or in an fs.FS: remote storage, a database, or a test double. Names are
+// slash-separated paths relative to the template directory, e.g.
+// "home.page.tmpl" or "partials/footer.partial.tmpl"; files keep their path
+// on disk (TemplateDir joined with the name) as their name in the Render.
+type Loader interface {
+	// Load returns the contents of the file name. The error for a file that
+	// doesn't exist wraps fs.ErrNotExist.
+	Load(name string) ([]byte, error)
+	// List returns the names of all files.
+	List() ([]string, error)
+}
+
+// ChangeLoader is a Loader that can tell which files changed, e.g. from an
+// updated_at column. With UseCache set, a Render asks it at most once per
+// LoaderPoll, before building or serving a page, and discovers the layouts
+// and partials again (with the file types of the last LoadLayoutsAndPartials)
+// when anything changed, which clears the cache. Files edited while the
+// application runs are then served without a restart.
+type ChangeLoader interface {
+	Loader
+	// Changed returns the names of the files changed or added after since.
+	Changed(since time.Time) ([]string, error)
+}
+
+// defaultLoaderPoll is how often a ChangeLoader is asked for changes when
+// LoaderPoll is 0.
+const defaultLoaderPoll = time.Second
+
+// checkLoader discovers the layouts and partials again when Loader is a
+// ChangeLoader reporting changes since the last check. Errors are logged:
+// the cached sets are served as they are until the next check.
+func (ren *Render) checkLoader() {
+	cl, ok := ren.Loader.(ChangeLoader)
+	if !ok || !ren.UseCache {
+		return
+	}
+	poll := ren.LoaderPoll
+	if poll <= 0 {
+		poll = defaultLoaderPoll
+	}
+	now := time.Now()
+	ren.mu.Lock()
+	since := ren.loaderChecked
+	if !since.IsZero() && now.Sub(since) < poll {
+		ren.mu.Unlock()
+		return
+	}
+	ren.loaderChecked = now
+	fileTypes := ren.partialTypes
+	ren.mu.Unlock()
+	if since.IsZero() {
+		return
+	}
+
+	changed, err := cl.Changed(since)
+	if err != nil {
+		log.Println("checking the template loader:", err)
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+	if ren.Debug {
+		log.Println("Templates changed:", changed)
+	}
+	if err := ren.LoadLayoutsAndPartials(fileTypes); err != nil {
+		log.Println("reloading changed templates:", err)
+	}
+}
+
+// DiskLoader is the Loader of the files in the directory Dir, which is what
+// a Render without a Loader reads.
+type DiskLoader struct {
+	Dir string
+}
+
+// Load reads the file name in Dir.
+func (l DiskLoader) Load(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(l.Dir, filepath.FromSlash(name)))
+}
+
+// List returns the files in the tree below Dir.
+func (l DiskLoader) List() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(l.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(l.Dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// loaderFS is the fs.FS of the files of a Loader, so reading and scanning
+// templates works the same for a Loader as for TemplateFS. Directories are
+// those the listed names imply.
+type loaderFS struct {
+	loader Loader
+	// The names of the files, when listed once for a scan; see withList.
+	names  []string
+	listed bool
+}
+
+// withList returns l with the names of its files listed once, for a scan
+// that reads every directory; otherwise every ReadDir lists them again, which
+// for an SQLLoader is a query per directory.
+func (l loaderFS) withList() (loaderFS, error) {
+	names, err := l.loader.List()
+	if err != nil {
+		return l, err
+	}
+	l.names, l.listed = names, true
+	return l, nil
+}
+
+// list returns the names of the files.
+func (l loaderFS) list() ([]string, error) {
+	if l.listed {
+		return l.names, nil
+	}
+	return l.loader.List()
+}
+
+// Open opens the file or directory name.
+func (l loaderFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		data, err := l.loader.Load(name)
+		if err == nil {
+			return &loaderFile{Reader: bytes.NewReader(data), info: loaderInfo{name: path.Base(name), size: int64(len(data))}}, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) && !l.isDir(name) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if !l.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &loaderFile{Reader: bytes.NewReader(nil), info: loaderInfo{name: path.Base(name), dir: true}}, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (l loaderFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	names, err := l.list()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	entries := make(map[string]bool) // Entry name -> whether it is a directory.
+	for _, n := range names {
+		rest, ok := strings.CutPrefix(n, prefix)
+		if !ok {
+			continue
+		}
+		entry, _, isDir := strings.Cut(rest, "/")
+		entries[entry] = entries[entry] || isDir
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for entry, isDir := range entries {
+		list = append(list, fs.FileInfoToDirEntry(loaderInfo{name: entry, dir: isDir}))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// isDir reports whether name is "." or the directory of a listed file.
+func (l loaderFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	names, err := l.list()
+	if err != nil {
+		return false
+	}
+	for _, n := range names {
+		if strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// loaderFile is a file or directory opened in a loaderFS.
+type loaderFile struct {
+	*bytes.Reader
+	info loaderInfo
+}
+
+func (f *loaderFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *loaderFile) Close() error               { return nil }
+
+// loaderInfo is the fs.FileInfo of a file of a loaderFS. A Loader has no
+// modification times or modes.
+type loaderInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i loaderInfo) Name() string       { return i.name }
+func (i loaderInfo) Size() int64        { return i.size }
+func (i loaderInfo) ModTime() time.Time { return time.Time{} }
+func (i loaderInfo) IsDir() bool        { return i.dir }
+func (i loaderInfo) Sys() any           { return nil }
+
+func (i loaderInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
@@ -0,0 +1,120 @@
+package page
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rtlLanguages holds the primary language subtags written right-to-left.
+var rtlLanguages = map[string]bool{
+	"ar":  true, // Arabic
+	"ckb": true, // Central Kurdish (Sorani)
+	"dv":  true, // Divehi
+	"fa":  true, // Persian
+	"he":  true, // Hebrew
+	"iw":  true, // Hebrew (deprecated tag)
+	"ji":  true, // Yiddish (deprecated tag)
+	"ps":  true, // Pashto
+	"sd":  true, // Sindhi
+	"ug":  true, // Uyghur
+	"ur":  true, // Urdu
+	"yi":  true, // Yiddish
+}
+
+// rtlScripts holds the script subtags written right-to-left. A script subtag
+// overrides the language, e.g. "az-Arab" is rtl and "ku-Latn" is ltr.
+var rtlScripts = map[string]bool{
+	"adlm": true, "arab": true, "hebr": true, "nkoo": true,
+	"rohg": true, "syrc": true, "thaa": true,
+}
+
+// TextDirection returns "rtl" when the language tag (e.g. "ar", "he-IL",
+// "az-Arab") is written right-to-left and "ltr" otherwise.
+func TextDirection(tag string) string {
+	parts := strings.Split(strings.ToLower(strings.ReplaceAll(tag, "_", "-")), "-")
+	if len(parts) > 1 && len(parts[1]) == 4 {
+		if rtlScripts[parts[1]] {
+			return "rtl"
+		}
+		return "ltr"
+	}
+	if rtlLanguages[parts[0]] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// NegotiateLocale picks the best of the supported language tags for the
+// Accept-Language header of r, honouring quality values ("fr;q=0.8").
+// A supported "en" matches a requested "en-GB" and the other way around.
+// When nothing matches, fallback is returned.
+//
+// To render pages per locale, Clone a configured Render for every supported
+// locale, set its Locale, and pick the clone with NegotiateLocale.
+func NegotiateLocale(r *http.Request, supported []string, fallback string) string {
+	choices := parseAccept(r.Header.Get("Accept-Language"))
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		if c.q == 0 {
+			continue
+		}
+		if c.value == "*" && len(supported) > 0 {
+			return supported[0]
+		}
+		for _, s := range supported {
+			if strings.EqualFold(s, c.value) {
+				return s
+			}
+		}
+		// No exact match: compare the primary language only.
+		base, _, _ := strings.Cut(c.value, "-")
+		for _, s := range supported {
+			sBase, _, _ := strings.Cut(s, "-")
+			if strings.EqualFold(sBase, base) {
+				return s
+			}
+		}
+	}
+	return fallback
+}
+
+// langAttr is the {{langAttr}} template function: the Render's Locale.
+//
+//	<html lang="{{langAttr}}" dir="{{dirAttr}}">
+func (ren *Render) langAttr() string {
+	return ren.Locale
+}
+
+// dirAttr is the {{dirAttr}} template function: "rtl" or "ltr" for the
+// Render's Locale.
+func (ren *Render) dirAttr() string {
+	return TextDirection(ren.Locale)
+}
+
+var (
+	htmlTagRegex  = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+	langAttrRegex = regexp.MustCompile(`(?i)\s(lang|dir)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// setHTMLLang rewrites the lang and dir attributes of the root <html> element
+// in out to match locale. Output without an <html> element is returned as is.
+func setHTMLLang(out []byte, locale string) []byte {
+	loc := htmlTagRegex.FindIndex(out)
+	if loc == nil {
+		return out
+	}
+	tag := langAttrRegex.ReplaceAll(out[loc[0]:loc[1]], nil)
+	attrs := ` lang="` + template.HTMLEscapeString(locale) + `" dir="` + TextDirection(locale) + `"`
+	// Insert the attributes right after "<html".
+	tag = append(tag[:5:5], append([]byte(attrs), tag[5:]...)...)
+
+	result := make([]byte, 0, len(out)+len(attrs))
+	result = append(result, out[:loc[0]]...)
+	result = append(result, tag...)
+	result = append(result, out[loc[1]:]...)
+	return result
+}
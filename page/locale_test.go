@@ -0,0 +1,129 @@
+package page
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextDirection(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{"ar", "rtl"},
+		{"ar-EG", "rtl"},
+		{"he_IL", "rtl"},
+		{"FA", "rtl"},
+		{"az-Arab", "rtl"},
+		{"ku-Latn", "ltr"},
+		{"en", "ltr"},
+		{"en-GB", "ltr"},
+		{"", "ltr"},
+	}
+	for _, tt := range tests {
+		if got := TextDirection(tt.tag); got != tt.want {
+			t.Errorf("TextDirection(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateLocale(t *testing.T) {
+	supported := []string{"en", "ar", "fr-CA"}
+	tests := []struct {
+		accept, want string
+	}{
+		{"", "en"},
+		{"ar", "ar"},
+		{"ar-EG,en;q=0.5", "ar"},
+		{"en;q=0.5, ar;q=0.9", "ar"},
+		{"fr", "fr-CA"},
+		{"de, *;q=0.1", "en"},
+		{"ar;q=0, fr", "fr-CA"},
+		{"de", "en"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tt.accept)
+		if got := NegotiateLocale(r, supported, "en"); got != tt.want {
+			t.Errorf("NegotiateLocale(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestSetHTMLLang(t *testing.T) {
+	tests := []struct {
+		in, locale, want string
+	}{
+		{`<html><body>`, "ar", `<html lang="ar" dir="rtl"><body>`},
+		{`<!doctype html><HTML lang="en" class="x" DIR='ltr'>`, "he", `<!doctype html><HTML lang="he" dir="rtl" class="x">`},
+		{`<html lang=en>`, "fr", `<html lang="fr" dir="ltr">`},
+		{`<p>no root element</p>`, "ar", `<p>no root element</p>`},
+		{`<htmlx>`, "ar", `<htmlx>`},
+	}
+	for _, tt := range tests {
+		if got := string(setHTMLLang([]byte(tt.in), tt.locale)); got != tt.want {
+			t.Errorf("setHTMLLang(%q, %q) = %q, want %q", tt.in, tt.locale, got, tt.want)
+		}
+	}
+}
+
+// A site with a Clone per locale, picked with NegotiateLocale, renders
+// Arabic pages right-to-left: through {{langAttr}} and {{dirAttr}}, and with
+// SetHTMLLang for a template that hardcodes its <html> element.
+func TestRTLEndToEnd(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"helpers.page.tmpl":   `<html lang="{{langAttr}}" dir="{{dirAttr}}"><body>{{.}}</body></html>`,
+		"hardcoded.page.tmpl": `<html lang="en"><body>{{.}}</body></html>`,
+	})
+	ren := newTestRender(t, dir)
+	ren.UseCache = true
+	ren.SetHTMLLang = true
+	ren.Locale = "en"
+	locales := map[string]*Render{"en": ren}
+	for _, tag := range []string{"ar", "he"} {
+		clone := ren.Clone()
+		clone.Locale = tag
+		locales[tag] = clone
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := NegotiateLocale(r, []string{"en", "ar", "he"}, "en")
+		if err := locales[tag].ShowRequest(w, r, strings.TrimPrefix(r.URL.Path, "/"), "hi"); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		page, accept, want string
+	}{
+		{"helpers", "ar-EG,en;q=0.5", `<html lang="ar" dir="rtl">`},
+		{"hardcoded", "ar-EG,en;q=0.5", `<html lang="ar" dir="rtl">`},
+		{"helpers", "he", `<html lang="he" dir="rtl">`},
+		{"helpers", "en-US", `<html lang="en" dir="ltr">`},
+		{"hardcoded", "", `<html lang="en" dir="ltr">`},
+		// The English site is rendered after the clones: they didn't
+		// change it.
+		{"hardcoded", "en", `<html lang="en" dir="ltr">`},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/"+tt.page, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Language", tt.accept)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want + "<body>hi</body></html>"; string(body) != want {
+			t.Errorf("%s with Accept-Language %q: got %q, want %q", tt.page, tt.accept, body, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package page
+
+import (
+	"container/list"
+	"log"
+	"sync"
+)
+
+// templateLRU is the order in which the cached sets were last used, for
+// MaxCachedTemplates. It has its own lock, so a cache hit records its use
+// while holding only the read lock of ren.mu. It may hold names of sets no
+// longer cached (the cache was cleared); those are dropped when reached.
+type templateLRU struct {
+	mu      sync.Mutex
+	order   *list.List               // Page names, least recently used first.
+	entries map[string]*list.Element // The elements of order, by page name.
+	evicted []string                 // Pages evicted and not yet passed to OnEvict.
+}
+
+// touch makes t the most recently used page.
+func (l *templateLRU) touch(t string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[t]; ok {
+		l.order.MoveToBack(e)
+		return
+	}
+	if l.order == nil {
+		l.order = list.New()
+		l.entries = make(map[string]*list.Element)
+	}
+	l.entries[t] = l.order.PushBack(t)
+}
+
+// popOldest removes the least recently used page and returns it.
+func (l *templateLRU) popOldest() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.order == nil || l.order.Len() == 0 {
+		return "", false
+	}
+	t := l.order.Remove(l.order.Front()).(string)
+	delete(l.entries, t)
+	return t, true
+}
+
+// usedSet records a use of the cached set of t, when the cache is bounded.
+func (ren *Render) usedSet(t string) {
+	if ren.MaxCachedTemplates > 0 {
+		ren.lru.touch(t)
+	}
+}
+
+// evictLocked drops the least recently used sets until the cache holds at
+// most MaxCachedTemplates. The caller must hold ren.mu, and call
+// notifyEvicted after releasing it.
+func (ren *Render) evictLocked() {
+	max := ren.MaxCachedTemplates
+	if max <= 0 {
+		return
+	}
+	for len(ren.cache) > max {
+		t, ok := ren.lru.popOldest()
+		if !ok {
+			return
+		}
+		if _, cached := ren.cache[t]; !cached {
+			continue
+		}
+		delete(ren.cache, t)
+		ren.snapshot.Store(nil)
+		delete(ren.fingerprints, t)
+		delete(ren.modTimes, t)
+		delete(ren.partialsKeys, t)
+		delete(ren.sourceMaps, t)
+		delete(ren.protos, t)
+		delete(ren.calls, t)
+		delete(ren.keyed, t)
+		delete(ren.deprecatedUses, t)
+		ren.stats.evicted.Add(1)
+		if ren.Debug {
+			log.Println("Evicted template", t, "from the cache")
+		}
+		if ren.OnEvict != nil {
+			ren.lru.mu.Lock()
+			ren.lru.evicted = append(ren.lru.evicted, t)
+			ren.lru.mu.Unlock()
+		}
+	}
+}
+
+// notifyEvicted passes the pages evicted since the last call to OnEvict, in
+// the order they were evicted. It is called without ren.mu held, so OnEvict
+// may use ren.
+func (ren *Render) notifyEvicted() {
+	ren.lru.mu.Lock()
+	evicted := ren.lru.evicted
+	ren.lru.evicted = nil
+	ren.lru.mu.Unlock()
+	for _, t := range evicted {
+		ren.OnEvict(t)
+	}
+}
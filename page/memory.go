@@ -0,0 +1,95 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// RenderMemory is what the renders of one template held in memory, as
+// reported in Stats.Memory.
+//
+// It counts the bytes this package holds for a render: the output buffer
+// (its capacity, which includes what the pool sized it to) and the copy of
+// the output handed to the caller. Memory the template data, the template
+// functions or text/template itself allocate is not counted: Go can't
+// attribute heap allocations to a goroutine. A render holding far more than
+// its output is not seen either, but the pathological cases (a range
+// writing gigabytes) show up here and are stopped by MaxRenderBytes.
+type RenderMemory struct {
+	PeakBuffer int64 // Largest buffer capacity of a render.
+	PeakOutput int64 // Largest output of a render.
+	LastOutput int64 // Output of the latest render.
+	Aborted    int64 // Renders stopped by MaxRenderBytes.
+}
+
+// RenderSizeError is the error of a render stopped because its output
+// exceeded MaxRenderBytes.
+type RenderSizeError struct {
+	Template string
+	Limit    int64
+}
+
+func (e *RenderSizeError) Error() string {
+	return fmt.Sprintf("output of %s exceeds MaxRenderBytes (%d bytes)", e.Template, e.Limit)
+}
+
+// renderMemory holds the RenderMemory of every template rendered.
+type renderMemory struct {
+	mu        sync.Mutex
+	templates map[string]*RenderMemory
+}
+
+// record adds a render of name that used a buffer of capacity buffer and
+// produced output bytes, or was aborted.
+func (m *renderMemory) record(name string, buffer, output int, aborted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.templates == nil {
+		m.templates = make(map[string]*RenderMemory)
+	}
+	rm := m.templates[name]
+	if rm == nil {
+		rm = &RenderMemory{}
+		m.templates[name] = rm
+	}
+	rm.PeakBuffer = max(rm.PeakBuffer, int64(buffer))
+	if aborted {
+		rm.Aborted++
+		return
+	}
+	rm.PeakOutput = max(rm.PeakOutput, int64(output))
+	rm.LastOutput = int64(output)
+}
+
+// snapshot returns a copy of the figures per template, or nil when nothing
+// was rendered.
+func (m *renderMemory) snapshot() map[string]RenderMemory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.templates) == 0 {
+		return nil
+	}
+	templates := make(map[string]RenderMemory, len(m.templates))
+	for name, rm := range m.templates {
+		templates[name] = *rm
+	}
+	return templates
+}
+
+// limitWriter is the output buffer of a render with MaxRenderBytes: a write
+// that would take it over the limit fails, which stops the execution.
+type limitWriter struct {
+	*bytes.Buffer
+	name  string
+	limit int64
+	err   error
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if int64(w.Len()+len(p)) > w.limit {
+		w.err = &RenderSizeError{Template: w.name, Limit: w.limit}
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
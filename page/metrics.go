@@ -0,0 +1,44 @@
+package page
+
+import "time"
+
+// Metrics receives the timings of a Render, for exporting them to a metrics
+// system (Prometheus histograms, StatsD timers) without this package
+// depending on one; see Render.Metrics. Its methods are called on the
+// goroutine of the render, so they should only record and return.
+type Metrics interface {
+	// ObserveRender is called after every render by Show, ShowRequest,
+	// String and Render with the page name, e.g. "home.page.tmpl", the time
+	// the render took and its error. Names that aren't a page are not
+	// observed.
+	ObserveRender(name string, d time.Duration, err error)
+	// ObserveBuild is called every time a render gets the set of the page
+	// name, with the time that took and whether the set came from the cache.
+	// A build that fails is observed as a miss.
+	ObserveBuild(name string, d time.Duration, cacheHit bool)
+}
+
+// NopMetrics is a Metrics that discards everything, e.g. to embed in a
+// Metrics that only implements some of the methods.
+type NopMetrics struct{}
+
+// ObserveRender does nothing.
+func (NopMetrics) ObserveRender(name string, d time.Duration, err error) {}
+
+// ObserveBuild does nothing.
+func (NopMetrics) ObserveBuild(name string, d time.Duration, cacheHit bool) {}
+
+// observeRender passes a render of the page t that began at start, and its
+// error, to Metrics. It is deferred with *err, so it sees what the render
+// returns.
+func (ren *Render) observeRender(t string, start time.Time, err *error) {
+	ren.Metrics.ObserveRender(t, time.Since(start), *err)
+}
+
+// observeBuild passes getting the set of t, begun at start, to Metrics,
+// when it is set.
+func (ren *Render) observeBuild(t string, start time.Time, cacheHit bool) {
+	if ren.Metrics != nil {
+		ren.Metrics.ObserveBuild(t, time.Since(start), cacheHit)
+	}
+}
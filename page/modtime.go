@@ -0,0 +1,65 @@
+package page
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"time"
+)
+
+// modTimesOf returns the modification times of files, leaving out the files
+// that can't be stat'ed.
+func (ren *Render) modTimesOf(files []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := ren.statTemplate(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// setChanged reports whether a file of tmpl, the cached set of page t,
+// changed or was removed since the set was built; see CheckModTime. The set
+// is dropped from the cache when it did, so the render builds it again.
+func (ren *Render) setChanged(t string, tmpl *template.Template) bool {
+	ren.mu.RLock()
+	modTimes := ren.modTimes[t]
+	ren.mu.RUnlock()
+
+	changed := ""
+	for file, modTime := range modTimes {
+		info, err := ren.statTemplate(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			changed = file
+			break
+		}
+		if err != nil {
+			if ren.Debug {
+				log.Println("Can't check", file, "for changes, using the cached", t+":", err)
+			}
+			continue
+		}
+		if !info.ModTime().Equal(modTime) {
+			changed = file
+			break
+		}
+	}
+	if changed == "" {
+		return false
+	}
+
+	ren.mu.Lock()
+	if ren.cache[t] == tmpl {
+		delete(ren.cache, t)
+		ren.snapshot.Store(nil)
+	}
+	ren.mu.Unlock()
+	// The changed file may be a partial, parsed once into the base.
+	ren.dropBase()
+	if ren.Debug {
+		log.Println(changed, "changed, building", t, "again")
+	}
+	return true
+}
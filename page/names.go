@@ -0,0 +1,160 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// nameKinds are the kinds of template GenerateNames declares constants for,
+// by the dotted part before the extension, with the prefix of their
+// constants. Other template files get the prefix "Template".
+var nameKinds = map[string]string{
+	"page":    "Page",
+	"partial": "Partial",
+	"layout":  "Layout",
+}
+
+// generatedName is one constant written by GenerateNames.
+type generatedName struct {
+	ident, value, file string
+}
+
+// GenerateNames writes the Go file outFile, in package pkg, declaring a
+// constant for every template file in dir (see DefaultExtensions), so code names templates with
+// identifiers the compiler checks instead of strings:
+//
+//	PageHome       = "home.page.tmpl"
+//	PageAdminUsers = "admin/users.page.tmpl"
+//	PartialNav     = "nav.partial.tmpl"
+//	LayoutBase     = "base.layout.tmpl"
+//
+// The value is the name the template is rendered or called by, its path
+// below dir, and the identifier holds the directories too; environment
+// variants have no constant of their own. The file also
+// declares TemplateNames, the list of all the values, for
+// Render.GeneratedNames so Validate reports constants whose template is gone.
+// Two files giving the same identifier are an error.
+//
+// It is meant to be called from a go:generate directive running a small
+// program, e.g. with "//go:generate go run ./cmd/gennames" next to a main
+// calling page.GenerateNames("templates", "tmplnames", "tmplnames/names.go").
+func GenerateNames(dir, pkg, outFile string) error {
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid package name %q", pkg)
+	}
+	ren := New()
+	ren.TemplateDir = dir
+	files, err := ren.find(dir)
+	if err != nil {
+		return err
+	}
+	inList := make(map[string]bool, len(files))
+	for _, f := range files {
+		inList[f] = true
+	}
+	exists := func(f string) bool { return inList[f] }
+
+	var names []generatedName
+	byIdent := make(map[string]string)
+	for _, f := range files {
+		if _, _, ok := variantOf(f, exists); ok {
+			continue
+		}
+		value := ren.templateName(f)
+		ident := nameIdent(value)
+		if other, ok := byIdent[ident]; ok {
+			return fmt.Errorf("%s and %s both give the constant %s", other, f, ident)
+		}
+		byIdent[ident] = f
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			rel = f
+		}
+		names = append(names, generatedName{ident: ident, value: value, file: filepath.ToSlash(rel)})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].ident < names[j].ident })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by page.GenerateNames from %s; DO NOT EDIT.\n\n", filepath.ToSlash(dir))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	buf.WriteString("// Names of the templates, see page.GenerateNames.\nconst (\n")
+	for _, n := range names {
+		if n.file != n.value {
+			fmt.Fprintf(&buf, "%s = %q // %s\n", n.ident, n.value, n.file)
+		} else {
+			fmt.Fprintf(&buf, "%s = %q\n", n.ident, n.value)
+		}
+	}
+	buf.WriteString(")\n\n")
+	buf.WriteString("// TemplateNames lists the names above, for Render.GeneratedNames.\nvar TemplateNames = []string{\n")
+	for _, n := range names {
+		fmt.Fprintf(&buf, "%s,\n", n.ident)
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, src, 0o644)
+}
+
+// nameIdent returns the identifier of the constant for the template name:
+// the prefix of its kind, then the rest of the name, directories included,
+// in camel case; "user-profile.page.tmpl" gives "PageUserProfile" and
+// "admin/users.page.tmpl" "PageAdminUsers".
+func nameIdent(name string) string {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	prefix := "Template"
+	if i := strings.LastIndex(stem, "."); i >= 0 {
+		if p, ok := nameKinds[stem[i+1:]]; ok {
+			prefix, stem = p, stem[:i]
+		}
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	upper := true
+	for _, r := range stem {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lintGeneratedNames reports the names in GeneratedNames no template file in
+// TemplateDir has, with rule "stale-name": constants written by
+// GenerateNames for templates that were renamed or removed since.
+func (ren *Render) lintGeneratedNames() ([]Finding, error) {
+	if len(ren.GeneratedNames) == 0 {
+		return nil, nil
+	}
+	files, err := ren.findTemplates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[ren.templateName(f)] = true
+	}
+	var findings []Finding
+	for _, name := range ren.GeneratedNames {
+		if !names[name] {
+			findings = append(findings, Finding{Template: name, Rule: "stale-name", Message: fmt.Sprintf("no template %s in %s; generate the names again", name, strings.Join(ren.templateDirs(), ", "))})
+		}
+	}
+	return findings, nil
+}
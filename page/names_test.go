@@ -0,0 +1,69 @@
+package page
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateNames(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"home.page.tmpl":         `home`,
+		"admin/users.page.tmpl":  `admin users`,
+		"public/users.page.tmpl": `public users`,
+		"nav.partial.tmpl":       `{{define "nav"}}nav{{end}}`,
+	})
+	out := filepath.Join(t.TempDir(), "names.go")
+	if err := GenerateNames(dir, "tmplnames", out); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`PageAdminUsers  = "admin/users.page.tmpl"`,
+		`PagePublicUsers = "public/users.page.tmpl"`,
+		`PageHome        = "home.page.tmpl"`,
+		`PartialNav      = "nav.partial.tmpl"`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("missing %s in\n%s", want, src)
+		}
+	}
+
+	// The values are the names the pages render by, and Validate finds none
+	// of them stale.
+	ren := newTestRender(t, dir)
+	for page, want := range map[string]string{"admin/users.page.tmpl": "admin users", "public/users.page.tmpl": "public users"} {
+		if got, err := ren.String(page, nil); err != nil || got != want {
+			t.Errorf("%s: got %q, %v", page, got, err)
+		}
+	}
+	ren.GeneratedNames = []string{"home.page.tmpl", "admin/users.page.tmpl", "public/users.page.tmpl", "nav.partial.tmpl", "gone.page.tmpl"}
+	findings, err := ren.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stale []string
+	for _, f := range findings {
+		if f.Rule == "stale-name" {
+			stale = append(stale, f.Template)
+		}
+	}
+	if len(stale) != 1 || stale[0] != "gone.page.tmpl" {
+		t.Errorf("stale names: got %v, want [gone.page.tmpl]", stale)
+	}
+}
+
+func TestGenerateNamesDuplicate(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"admin-users.page.tmpl": `a`,
+		"admin/users.page.tmpl": `b`,
+	})
+	err := GenerateNames(dir, "tmplnames", filepath.Join(t.TempDir(), "names.go"))
+	if err == nil || !strings.Contains(err.Error(), "both give the constant PageAdminUsers") {
+		t.Errorf("got error %v", err)
+	}
+}
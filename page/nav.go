@@ -0,0 +1,168 @@
+package page
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NavItem is a page in the navigation tree returned by NavTree.
+type NavItem struct {
+	Page     string     // The page, e.g. "about.page.tmpl".
+	Title    string     // Front matter "title"; defaults to the page's short name.
+	URL      string     // Front matter "url"; defaults to "/" + short name ("/" for home and index).
+	Order    int        // Front matter "nav-order"; 0 by default.
+	Children []*NavItem // Pages whose "nav-parent" is this page.
+}
+
+// SitemapEntry is a page in the list returned by SitemapEntries.
+type SitemapEntry struct {
+	Page       string  // The page, e.g. "about.page.tmpl".
+	URL        string  // As NavItem.URL.
+	Priority   float64 // Front matter "sitemap-priority"; 0.5 by default.
+	ChangeFreq string  // Front matter "changefreq", e.g. "weekly"; "" by default.
+}
+
+// siteIndex is the metadata of all pages, assembled once per page list.
+type siteIndex struct {
+	nav     []*NavItem
+	sitemap []SitemapEntry
+}
+
+// NavTree returns the navigation tree of the pages in TemplateDir, built
+// from their front matter: pages with a "nav-parent" (a page name, with or
+// without extension) are children of that page, the others are roots.
+// Siblings are ordered by nav-order, then by page name. Pages with
+// "hidden: true" are left out, and so are their children.
+//
+// The result is cached until the partials change or WarmReload runs; it is
+// shared, so don't change it.
+func (ren *Render) NavTree() ([]*NavItem, error) {
+	index, err := ren.siteIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index.nav, nil
+}
+
+// SitemapEntries returns an entry for every page in TemplateDir without
+// "hidden: true" in its front matter, ordered by page name. Like NavTree,
+// the result is cached and shared.
+func (ren *Render) SitemapEntries() ([]SitemapEntry, error) {
+	index, err := ren.siteIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index.sitemap, nil
+}
+
+// siteIndex returns the cached siteIndex, assembling it when needed.
+func (ren *Render) siteIndex() (*siteIndex, error) {
+	ren.mu.RLock()
+	index := ren.site
+	ren.mu.RUnlock()
+	if index != nil {
+		return index, nil
+	}
+
+	pages, err := ren.pageNames()
+	if err != nil {
+		return nil, err
+	}
+	index = &siteIndex{}
+	items := make(map[string]*NavItem, len(pages))
+	parents := make(map[string]string, len(pages))
+	for _, t := range pages {
+		meta, err := ren.PageMeta(t)
+		if err != nil {
+			return nil, err
+		}
+		if hidden, _ := strconv.ParseBool(meta["hidden"]); hidden {
+			continue
+		}
+		short := shortName(t)
+		url := meta["url"]
+		if url == "" {
+			url = "/" + short
+			if short == "home" || short == "index" {
+				url = "/"
+			}
+		}
+		title := meta["title"]
+		if title == "" {
+			title = short
+		}
+		order, _ := strconv.Atoi(meta["nav-order"])
+		priority, err := strconv.ParseFloat(meta["sitemap-priority"], 64)
+		if err != nil {
+			priority = 0.5
+		}
+
+		items[t] = &NavItem{Page: t, Title: title, URL: url, Order: order}
+		parents[t] = meta["nav-parent"]
+		index.sitemap = append(index.sitemap, SitemapEntry{Page: t, URL: url, Priority: priority, ChangeFreq: meta["changefreq"]})
+	}
+
+	// Link children to their parents; a missing parent makes a page a root.
+	// pages is sorted, so of pages sharing a short name the last one always
+	// wins, whatever the order of items.
+	byShort := make(map[string]string, len(items))
+	for _, t := range pages {
+		if _, ok := items[t]; ok {
+			byShort[shortName(t)] = t
+		}
+	}
+	for _, t := range pages {
+		item, ok := items[t]
+		if !ok {
+			continue
+		}
+		parent := parents[t]
+		if p, ok := byShort[parent]; ok {
+			parent = p
+		}
+		if p, ok := items[parent]; ok && p != item {
+			p.Children = append(p.Children, item)
+		} else if parent == "" || !hiddenPage(pages, parent, items) {
+			index.nav = append(index.nav, item)
+		}
+	}
+	sortNav(index.nav)
+
+	ren.mu.Lock()
+	ren.site = index
+	ren.mu.Unlock()
+	return index, nil
+}
+
+// hiddenPage reports whether parent names a page that exists but was left
+// out of the index (so its children are left out too).
+func hiddenPage(pages []string, parent string, items map[string]*NavItem) bool {
+	for _, t := range pages {
+		if t == parent || shortName(t) == parent {
+			_, listed := items[t]
+			return !listed
+		}
+	}
+	return false
+}
+
+// sortNav orders items and their children by Order, then by page name.
+func sortNav(items []*NavItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Order != items[j].Order {
+			return items[i].Order < items[j].Order
+		}
+		return items[i].Page < items[j].Page
+	})
+	for _, item := range items {
+		sortNav(item.Children)
+	}
+}
+
+// shortName returns the part of a page name before the first dot:
+// "about.page.tmpl" gives "about".
+func shortName(t string) string {
+	short, _, _ := strings.Cut(t, ".")
+	return short
+}
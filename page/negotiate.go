@@ -0,0 +1,137 @@
+package page
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Negotiate renders t as HTML or td as JSON, depending on what the client
+// prefers according to its Accept header. This keeps endpoints that serve
+// both browsers (HTML) and apps (JSON) to a single call:
+//
+//	err := render.Negotiate(w, r, "product.page.tmpl", &Data{Data: data})
+//
+// HTML is rendered with ShowRequest and wins ties and requests without an
+// Accept header. The JSON body is the data payload: the Data field (or "Data"
+// key) of td when it has one, td itself otherwise. Set JSONMarshaler to
+// control the JSON shape yourself, e.g. to hide internal fields.
+func (ren *Render) Negotiate(w http.ResponseWriter, r *http.Request, t string, td any) error {
+	w.Header().Add("Vary", "Accept")
+	if preferredType(r.Header.Get("Accept"), "text/html", "application/json") != "application/json" {
+		return ren.ShowRequest(w, r, t, td)
+	}
+
+	marshal := ren.JSONMarshaler
+	if marshal == nil {
+		marshal = func(td any) ([]byte, error) {
+			return json.Marshal(unwrapData(td))
+		}
+	}
+	body, err := marshal(td)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error marshaling", err)
+		}
+		ren.renderFailed(w, r, err, err.Error())
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	setContentLength(w, len(body))
+	_, err = w.Write(body)
+	return err
+}
+
+// unwrapData returns the Data field of a struct (or pointer to one), the
+// "Data" entry of a map[string]any, or td itself.
+func unwrapData(td any) any {
+	if m, ok := td.(map[string]any); ok {
+		if data, ok := m["Data"]; ok {
+			return data
+		}
+		return td
+	}
+	v := reflect.ValueOf(td)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Data"); f.IsValid() && f.CanInterface() {
+			return f.Interface()
+		}
+	}
+	return td
+}
+
+// acceptRange is one entry of an Accept-style header: "text/html;q=0.8".
+type acceptRange struct {
+	value string
+	q     float64
+}
+
+// parseAccept splits an Accept, Accept-Encoding or Accept-Language header into
+// its entries with their quality values (1 when not given). Entries with an
+// invalid q are dropped.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					q = -1
+				} else {
+					q = parsed
+				}
+			}
+		}
+		if q >= 0 {
+			ranges = append(ranges, acceptRange{value: value, q: q})
+		}
+	}
+	return ranges
+}
+
+// preferredType returns the offer (a media type like "text/html") the Accept
+// header ranks highest. The most specific matching range decides an offer's
+// quality: "text/html" beats "text/*" beats "*/*". Ties go to the earlier
+// offer, and so does an empty header. When the client accepts none of the
+// offers, "" is returned.
+func preferredType(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, _, _ := strings.Cut(offer, "/")
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.value == offer:
+				s = 2
+			case r.value == typ+"/*":
+				s = 1
+			case r.value == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
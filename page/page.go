@@ -1,96 +1,554 @@
 package page
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
-	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var mapLock sync.Mutex
-
 // Render is the main type for this package. 
 // Create a variable of this type and specify its fields, then you have 
 // access to Show and String functions.
+//
+// Concurrency: set the fields before the first render and don't assign them
+// afterwards. Once configured, these methods are safe to call concurrently
+// with each other and with themselves:
+//   - rendering: Show, ShowRequest, String, Render, RenderGroup, Negotiate,
+//     RenderTenant
+//   - changing state: SetPartials, AddPartials, AddFunc,
+//     LoadLayoutsAndPartials and WarmReload (these replace the cache; renders
+//     running at the time finish with the sets they started with), and
+//     InvalidateDataVersion
+//   - reading: Stats, GetTemplate, GetSharedTemplate, NavTree,
+//     SitemapEntries, PageMeta, Validate, Analyze
+//
+// Every Render guards its cache and other state with its own lock, so
+// independent Renders never wait for each other; renders of cached pages
+// only take it for reading. A Render must not be copied after first use.
+//
+// Clone is safe too; the clone is independent of ren. Sets returned by
+// GetSharedTemplate must not be changed. pagetest.Hammer checks these
+// guarantees for a given configuration under the race detector.
 type Render struct {
-	TemplateDir string                        // Path to templates.
-	Functions   template.FuncMap              // A map of functions we want to pass to our templates.
-	UseCache    bool                          // If true, use the template cache, stored in TemplateMap.
-	TemplateMap map[string]*template.Template // Our template cache.
-	Partials    []string                      // A list of partials.
-	Debug       bool                          // Prints debugging info when true.
+	TemplateDir string           // Path to templates.
+	TemplateFS  fs.FS            // File system TemplateDir is in, e.g. an embed.FS; nil is the disk.
+	Loader      Loader           // Source of the files in TemplateDir, e.g. remote storage; nil is TemplateFS.
+	LoaderPoll  time.Duration    // How often to check a ChangeLoader for changes; 0 means every second.
+	WatchPoll   time.Duration    // How often Watch scans the template directories; 0 means every 250ms.
+	Functions   template.FuncMap // A map of functions we want to pass to our templates.
+	UseCache    bool             // If true, cache the template set of every page; see CachedTemplates.
+
+	// Partials is the list of layout and partial files parsed into every page.
+	//
+	// Deprecated: assigning Partials directly races with concurrent renders,
+	// and keeps the sets of the old list in the cache until their pages are
+	// rendered again (see partialsKey). Use SetPartials or AddPartials, which
+	// take the lock and clear the cache.
+	Partials []string
+
+	// TemplateMap was the template cache.
+	//
+	// Deprecated: the cache is kept inside the Render, behind its lock, and
+	// this map is no longer read or written; a Render without it works. Use
+	// CachedTemplates to list the cached pages, and ClearCache or Invalidate
+	// to drop them. It will be removed in the next release.
+	TemplateMap map[string]*template.Template
+
+	// Leave out the built-in partials (head, meta, flash and pagination; see
+	// builtinPartials). Without it, a partial file of the same name replaces
+	// the built-in one.
+	DisableBuiltins bool
+
+	Environment string         // E.g. "production": files like home.page.prod.tmpl replace home.page.tmpl.
+	GlobalData  map[string]any // Data available in every template through {{global "key"}}.
+	Locale      string         // Language tag pages are rendered in, e.g. "en" or "ar"; see {{langAttr}}.
+	SetHTMLLang bool           // If true, set lang and dir on <html> from Locale when the template doesn't use {{langAttr}}/{{dirAttr}}.
+	Behavior    Behavior       // Earlier behavior to keep, e.g. CompatV1; the zero value is the current behavior.
+	Watermark   bool           // If true, mark pages with an environment banner, as Environment "staging" does; see postProcess.
+	Debug       bool           // Prints debugging info when true.
+
+	// With UseCache, check the modification times of the files of a cached
+	// set before every render, and build it again when one changed: edits
+	// show up without a restart, at the cost of a stat per file. A file
+	// removed from disk makes the render fail as when the set is built; a
+	// file that can't be stat'ed for another reason keeps the cached set.
+	CheckModTime bool
+	// Let a request with the CacheBypassHeader make ShowRequest build its
+	// page from disk, for telling a stale cache from a template bug on a
+	// server running with UseCache. A debug facility, off by default: with
+	// it on, any client can make the server parse templates on demand.
+	AllowCacheBypass bool
+
+	// Template directories, lowest priority first, e.g. a shared base set
+	// then the overrides of one application; when empty, TemplateDir is the
+	// only one. A file in a later directory replaces the file with the same
+	// path below an earlier one, pages and partials alike. Cached sets are
+	// kept by page name, so call LoadLayoutsAndPartials (or WarmReload) again
+	// after changing the directories or their order.
+	TemplateDirs []string
+
+	// Theme of the templates, e.g. the look of one white-label customer: the
+	// files in TemplateDir/themes/<Theme>/ replace those with the same path
+	// in TemplateDir, pages and partials alike, and everything else comes
+	// from TemplateDir. The files of the other themes are never used. Use
+	// SetTheme to change it while pages are rendered. Not to be confused with
+	// the color scheme of ThemeResolver.
+	Theme string
+
+	// How long a ShowRequest over the Limit of its page waits for its turn
+	// before it fails with ErrRateLimited; 0 rejects it right away.
+	LimitWait time.Duration
+
+	// The type of the template data of pages, by page name, as a value of it:
+	// HomeData{} or (*HomeData)(nil). Names may be short, as for Show. Only
+	// ExportSchemas uses it.
+	Models map[string]any
+
+	// Template names code refers to, as declared by GenerateNames in
+	// TemplateNames; Validate reports those no template has anymore.
+	GeneratedNames []string
+
+	// Render the same bytes for the same templates and data on every run, for
+	// snapshots, signing and reproducible builds: {{now}} returns the time of
+	// Clock (the Unix epoch when nil) instead of the current time. What this
+	// package iterates over for output (surrogate keys, navigation, image
+	// attributes, map ranges in templates) is always in sorted order. Left to
+	// the caller: functions in Functions reading the clock or random data,
+	// maps iterated by those functions, {{remote}} content, and the
+	// Last-Modified time of pages served from DiskCacheDir.
+	Deterministic bool
+	Clock         func() time.Time
+
+	// Extensions of the template files in TemplateDir; New sets it to
+	// DefaultExtensions. Empty means ".tmpl" only.
+	Extensions []string
+
+	// Files and directories the scans of TemplateDir leave out, so they are
+	// neither partials nor pages: path.Match patterns of paths relative to
+	// TemplateDir, in which "**" stands for any number of directories
+	// ("email/**"). A pattern without a slash matches names at any depth
+	// ("*_draft.tmpl").
+	Exclude []string
+
+	// Names of the files and directories the scans skip at any depth, as
+	// path.Match patterns: hidden files, editor leftovers, .git and
+	// node_modules. nil means DefaultIgnore; an empty, non-nil list skips
+	// nothing.
+	Ignore []string
+
+	// Walk into the directories symlinks in TemplateDir point to, e.g. a
+	// directory of shared partials linked into it; the scans don't by
+	// default. Files found there are named by the path of the link, and links
+	// back to a directory being walked are skipped. Only for templates on
+	// disk.
+	FollowSymlinks bool
+
+	// Limits of the scans of TemplateDir, against pointing it at a huge tree
+	// by mistake: the number of files and directories looked at, and how deep
+	// directories may nest. 0 means 100000 and 32.
+	MaxFilesScanned int
+	MaxDepth        int
+
+	// Rewrites of every template source before it is parsed, applied in
+	// order; nil means DefaultSourceTransforms. Add to those to keep them:
+	// append(page.DefaultSourceTransforms, stripLicense).
+	SourceTransforms []SourceTransform
+
+	// Images for the {{img}} template function.
+	AssetDir       string                                // Directory holding the images, e.g. "./static/img".
+	AssetURL       string                                // URL prefix for images, e.g. "/static/img".
+	ImageDensities []int                                 // Pixel densities for srcset variants, e.g. []int{2, 3}.
+	ImageVariant   func(name string, density int) string // Variant file name; nil means "hero@2x.jpg".
+	imageSizes     map[string]imageSize                  // Dimensions cache, see LoadImageSizes.
+	imageSizesGen  uint64                                // cacheGen imageSizes belongs to.
+
+	// Rendered pages cached on disk, see ShowRequest. The key of a cached
+	// page is its name, the fingerprint of its files and its data version,
+	// not the template data: list only pages that are the same for every
+	// visitor, never one showing a user's data.
+	DiskCacheDir      string            // Directory for rendered pages; empty means no disk cache.
+	DiskCachePages    []string          // Pages (names or path.Match globs) cached in DiskCacheDir; none unless listed.
+	DiskCacheMaxBytes int64             // Total size kept in DiskCacheDir; 0 means unlimited.
+	DiskCacheTTL      time.Duration     // Age after which a cached page is rendered again; 0 means never.
+	DiskCacheGrace    time.Duration     // How long past DiskCacheTTL a page is served while refreshed in the background.
+	refreshing        map[string]bool   // Cache files being refreshed in the background.
+	dataVersions      map[string]uint64 // Data version per page, see InvalidateDataVersion.
+
+	// Headers templates may set with {{header}} in ShowRequest; nil means DefaultTemplateHeaders.
+	TemplateHeaders []string
+	// Builds the JSON body for Negotiate; nil marshals the Data payload of td.
+	JSONMarshaler func(td any) ([]byte, error)
+	// Records which templates are executed, for tests; nil (the default) instruments nothing.
+	Coverage *Coverage
+
+	// Compress pages in ShowRequest for clients that accept it, so handlers
+	// don't need a gzip middleware.
+	EnableCompression bool
+	// The encodings ShowRequest compresses with, in the order the server
+	// prefers them, e.g. a brotli Encoder before GzipEncoder; the client's
+	// Accept-Encoding picks among them. nil uses gzip at CompressionLevel.
+	Encoders []Encoder
+	// The gzip level when Encoders is nil, from gzip.HuffmanOnly to
+	// gzip.BestCompression; 0 uses gzip.DefaultCompression.
+	CompressionLevel int
+	// Pages smaller than this many bytes are sent uncompressed: gzip saves
+	// little on them and costs a writer. 0 uses 1KB.
+	CompressMinSize int
+	// Pages (names or path.Match globs) ShowRequest never compresses.
+	// Compressing a page that reflects a secret (a CSRF token, a session
+	// value) next to attacker-influenced content lets an attacker recover
+	// the secret from the compressed sizes (BREACH). Pages whose data carries
+	// a CSRFToken are excluded as well; WithCompression overrides both.
+	NeverCompress []string
+	// Pages (names or path.Match globs) whose concurrent renders with the
+	// same data share one execution, e.g. a busy home page for anonymous
+	// users; Stats.Coalesced counts the renders that joined another. Only
+	// list pure pages: their output may depend on nothing but the template
+	// data as encoded by encoding/json (unexported fields and methods of the
+	// data are not compared), and data that can't be encoded is rendered on
+	// its own. Joined renders get the bytes of the execution they joined
+	// without running anything themselves: no failure capture, deprecation
+	// count or block trace is recorded for them. Pages rendered with
+	// per-request functions ({{status}}, {{header}}, {{theme}} in ShowRequest)
+	// are never coalesced.
+	Coalesce []string
+
+	// Execution quotas per tenant, for RenderTenant.
+	Quotas map[string]Quota
+	// Picks the tenant of a request for ShowForHost, see AddTenant; nil
+	// means the host of the request, without the port.
+	TenantKey func(r *http.Request) string
+	// Named template data for the endpoints of DebugHandler.
+	DebugFixtures map[string]any
+	// Decides whether the request r may run the DebugHandler action on
+	// target (a template or source name, "" when the action has none).
+	// nil allows the read-only actions only.
+	DebugAuthorize func(r *http.Request, action, target string) bool
+	// Receives every allowed DebugHandler action that changes something.
+	DebugAudit func(DebugAction)
+	// Receives an Artifact for every failed render, for Replay. Capturing needs
+	// Redact too: nothing is captured without it.
+	CaptureFailures func(Artifact)
+	// Returns the template data with secrets and personal data removed before
+	// it is captured; its result must be JSON-encodable.
+	Redact func(td any) (any, error)
+	// Time every template executed in one of TraceBlocks renders, for the
+	// per-block percentiles in Stats.Blocks; 0 (the default) traces nothing.
+	// Set it before the first render: only sets built with it are traced.
+	TraceBlocks int
+	// Count the calls of every function in Functions, and the time they take,
+	// per page, for Stats.Funcs. Off (the default), the functions are bound
+	// as they are. Set it before the first render: only sets built with it
+	// are profiled.
+	ProfileFuncs bool
+	// Largest output buffer kept for reuse; 0 means 1MB. Pages rendering more
+	// still work, with a buffer that is not reused.
+	MaxBufferSize int
+	// Largest output a render may write; a render writing more is stopped
+	// with a *RenderSizeError before it can exhaust memory. 0 means no
+	// limit. See RenderMemory for what is measured.
+	MaxRenderBytes int64
+	// Most template sets kept in the cache; when a new set would exceed it,
+	// the least recently rendered ones are dropped (and built again on their
+	// next render). 0 means no limit.
+	MaxCachedTemplates int
+	// Called with the name of every page evicted for MaxCachedTemplates,
+	// after the cache lock is released; nil means no callback.
+	OnEvict func(name string)
+	// Receives the timings of renders and of getting their template sets,
+	// for exporting them as metrics; nil means none are taken. See Metrics.
+	Metrics Metrics
+	// Called with the name of the page every time a render finds no cached
+	// set for it (every render, without UseCache), before it is built; nil
+	// means no callback. Renders missing the same page at once share one
+	// build, but each calls OnCacheMiss.
+	OnCacheMiss func(name string)
+	// Called after every build of the set of a page, with the files parsed
+	// into it in order (the layouts and partials, then the page file; files
+	// of a registered source as "source:file"), the time the build took and
+	// its error. files is nil when the build failed. nil means no callback.
+	OnBuild func(name string, files []string, d time.Duration, err error)
+	// Surrogate keys of templates, by page or partial name: a page gets the
+	// keys of every template it calls, next to those added with
+	// {{surrogateKey "key"}}. See Result.SurrogateKeys.
+	SurrogateKeys map[string][]string
+	// Response header Show and ShowRequest send the surrogate keys in, for
+	// purging a CDN by key; "" means DefaultSurrogateKeyHeader.
+	SurrogateKeyHeader string
+	// Content-Type of the rendered pages, set on responses whose handler
+	// didn't set one, so net/http doesn't sniff it from the output; ""
+	// means "text/html; charset=utf-8".
+	DefaultContentType string
+	// Answers the request of a page that failed to build or render, once,
+	// e.g. with a branded error page, so handlers don't each repeat it; the
+	// error is still returned. r is the request of ShowRequest and the other
+	// request-aware methods, and nil for Show. Nothing of the page has been
+	// written when it is called; StreamingShow doesn't call it. nil leaves
+	// the answer to the caller.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+	// Auditing of the pages rendered by ShowRequest, by page name or
+	// path.Match pattern, e.g. "statement*.page.tmpl".
+	Audit map[string]AuditPolicy
+	// Picks the theme of a request for {{theme}} in ShowRequest, e.g. "dark"
+	// from a cookie or the Sec-CH-Prefers-Color-Scheme client hint, which
+	// responses then ask for and Vary on; a resolver reading a cookie should
+	// have the handler add "Vary: Cookie". Only names of letters, digits,
+	// '-' and '_' are used. nil (the default) turns themes off.
+	ThemeResolver func(r *http.Request) string
+	// Add the theme as a class to <html> in pages that don't use {{theme}}.
+	ThemeClass bool
+
+	mu sync.RWMutex // Guards the cache, Partials and the fields below that are not safe for concurrent use themselves.
+
+	cache        map[string]*template.Template // The cached template set of each page; nil until the first is stored.
+	fingerprints map[string]string             // Fingerprint of the files behind each cached set.
+	sourceMaps   map[string]sourceMap          // Source files behind each cached set, for RenderError.
+	protos       map[string]*template.Template // Unexecuted copies of sets using response hints.
+	stats        renderStats                   // Counters behind Stats.
+	life         lifecycle                     // What Start left running, for Stop.
+	quotaSlots   quotaSlots                    // Concurrent renders per tenant, for RenderTenant.
+	site         *siteIndex                    // Page metadata for NavTree and SitemapEntries; nil until needed.
+
+	// Modification times of the files behind each cached set, for CheckModTime.
+	modTimes map[string]map[string]time.Time
+	// partialsKey of each cached set, compared with that of Partials and
+	// Theme in the snapshot on a cache hit.
+	partialsKeys map[string]uint64
+	// Copy of the cache that renders read without the lock; nil after a
+	// change under the lock until the next render takes a new one.
+	snapshot atomic.Pointer[cacheSnapshot]
+	// Guards Partials and Theme, which are written holding ren.mu as well,
+	// so renders compare them with the snapshot without ren.mu.
+	partialsMu sync.RWMutex
+	// Sizes of aliases, stringPages, disabled and deprecations.
+	sizes registrySizes
+	// The partials parsed once for the sets of every page, see partialSet;
+	// baseMu guards it and is taken before ren.mu.
+	base   *partialBase
+	baseMu sync.Mutex
+	// The components parsed by this Render, see componentTemplate;
+	// componentMu guards them and is taken before ren.mu.
+	parsedComponents map[string]*parsedComponent
+	componentMu      sync.Mutex
+	// TemplateDir as last set with SetTemplateDir, read without the lock;
+	// nil until it is called.
+	templateDir atomic.Pointer[string]
+
+	calls          map[string][]string      // Templates called by each cached set.
+	deprecations   map[string]*deprecation  // Templates registered with Deprecate.
+	deprecatedUses map[string][]string      // Deprecated templates used by each page.
+	components     map[string]*component    // Components registered with RegisterComponent.
+	sizeHints      sync.Map                 // Output size of the last render of each template.
+	blockTimings   blockTimings             // Timings of traced renders, see TraceBlocks.
+	memory         renderMemory             // Buffer and output sizes, see Stats.Memory.
+	funcProfile    funcProfile              // Function calls, see ProfileFuncs.
+	limits         pageLimits               // See Limit.
+	bundle         fs.FS                    // Templates of LoadBundle; nil without a bundle.
+	bundleFile     string                   // The archive of bundle.
+	partialSets    []*usedPartialSet        // See UsePartialSet.
+	coalescer      coalescer                // Executions in flight, see Coalesce.
+	builds         buildFlights             // Builds from disk in flight, see sharedBuild.
+	cacheGen       uint64                   // Incremented whenever cached sets are dropped, e.g. by ClearCache.
+	lru            templateLRU              // Recency of the cached sets, see MaxCachedTemplates.
+	events         eventHub                 // Subscribers of Subscribe.
+	tenants        map[string]*Render       // Tenants added with AddTenant, by lowercased key.
+	partialTypes   []string                 // File types of the last LoadLayoutsAndPartials.
+	loaderChecked  time.Time                // When the ChangeLoader was last checked, see checkLoader.
+	stringPages    map[string]string        // Sources of AddTemplateString, by page name.
+	stringPartials []stringPartial          // Partials of AddPartialString, in order.
+	pageAliases    map[string]string        // Short page names resolved by pageName.
+	aliases        map[string]string        // Aliases added with Alias, by alias.
+	unreadable     []string                 // Directories the last scan couldn't read.
+	remotes        map[string]*remoteEntry  // Sources registered with RegisterRemote.
+	banner         watermarkBanner          // Banner template for Watermark.
+	registry       map[string]*mergedSource // Sources merged from RegisterSource, by name.
+	sourcePages    map[string]sourcePage    // Pages of the merged sources, by page name.
+	disabled       map[string]*Disabled     // Pages switched off with Disable.
+	keyed          map[string]bool          // Cached sets calling {{surrogateKey}}.
+	auditQueues    map[string]auditQueue    // Queues of the async policies in Audit.
 }
 
 // New returns a Render type populated with sensible defaults.
 func New() *Render {
 	return &Render{
-		Functions:   template.FuncMap{},
-		UseCache:    true,
-		TemplateMap: make(map[string]*template.Template),
-		Partials:    []string{},
-		Debug:       false,
+		Functions:  template.FuncMap{},
+		UseCache:   true,
+		Partials:   []string{},
+		GlobalData: make(map[string]any),
+		Extensions: append([]string(nil), DefaultExtensions...),
+		Debug:      false,
 	}
 }
 
 // Show generates an HTML page from template file(s).
+// The page is rendered completely (see Render) before anything is written to w,
+// so a template that fails halfway doesn't leave half a page on the client,
+// and with its Content-Length, unless the handler set a Transfer-Encoding or
+// a Content-Encoding (a compressing writer wraps w). With StreamingShow in Behavior, the page is written as it executes instead.
+// The status is 200; see ShowWithStatus for another.
+//
+// When the page can't be built or rendered, Show writes nothing and returns
+// the error; the caller owns the response:
+//
+//	if err := ren.Show(w, "home", td); err != nil {
+//		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+//	}
+//
+// ErrorHandler, when set, answers instead, for all handlers at once. Show used to answer with a 500 and
+// the error text itself, so a handler answering too wrote twice; set
+// ErrorResponses in Behavior to keep that.
 // @ t:
-// -	template name: "home.page.tmpl", "about.page.tmpl", etc
+// -	template name: "home.page.tmpl", "about.page.tmpl", etc; or without the
+//	extension ("home.page", "home"), see pageName
 // @ td:
 // -	template data: 
 //			data := make(map[string]any)
 //			data["payload"] = "This is MY passed data."
 func (ren *Render) Show(w http.ResponseWriter, t string, td any) error {
+	return ren.show(w, 0, nil, t, td)
+}
+
+// ShowWithStatus is Show answering with the status code status, e.g.
+// http.StatusNotFound for a "not found" page, instead of 200. The status,
+// the headers and the body are written together once the page rendered; a
+// page that fails to render is answered as by Show, and the status is never
+// written. With StreamingShow, the status is written before the page
+// executes, since its output goes out as it is written. Pages switched off
+// with Disable are answered with 503 still.
+func (ren *Render) ShowWithStatus(w http.ResponseWriter, status int, t string, td any) error {
+	if status < 100 || status > 599 {
+		return fmt.Errorf("invalid status code %d", status)
+	}
+	return ren.show(w, status, nil, t, td)
+}
+
+// ShowWithHeaders is Show adding the headers of header to the response, e.g.
+// http.Header{"Cache-Control": {"max-age=60"}}, except those the handler set
+// already, which keep the handler's values. A Content-Type in header
+// replaces DefaultContentType. The headers are written with the page, and
+// not at all when it fails to render; with StreamingShow, before it executes.
+func (ren *Render) ShowWithHeaders(w http.ResponseWriter, t string, td any, header http.Header) error {
+	return ren.show(w, 0, header, t, td)
+}
+
+// show is Show, answering with status and adding header; a status of 0
+// leaves the status to w, i.e. 200 unless the caller wrote one before.
+func (ren *Render) show(w http.ResponseWriter, status int, header http.Header, t string, td any) (err error) {
+	// t may be a short name like "home"; pageName resolves it to the page.
+	t, err = ren.pageName(t)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		ren.renderFailed(w, nil, err, "")
+		return err
+	}
+	if ren.Metrics != nil {
+		defer ren.observeRender(t, time.Now(), &err)
+	}
+	// A page switched off with Disable is answered without building it.
+	if fallback, disabled := ren.disabledFallback(t); disabled {
+		return ren.showDisabled(w, fallback, td)
+	}
+	if ren.Behavior&StreamingShow != 0 {
+		return ren.showStreaming(w, status, header, t, td)
+	}
+	start := time.Now()
 	// Call buildTemplate to get the template, either from the cache or by building it from disk.
 	tmpl, err := ren.buildTemplate(t)
 	if err != nil {
-		log.Println("error building", err)
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		ren.renderFailed(w, nil, err, "")
 		return err
 	}
-	// Execute template.
-	if err := tmpl.ExecuteTemplate(w, t, td); err != nil {
-		log.Println("error executing", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Execute template into a Result first; nothing of the page is written
+	// when this fails.
+	result, err := ren.renderTemplate(tmpl, t, td, start)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error executing", err)
+		}
+		ren.renderFailed(w, nil, err, err.Error())
 		return err
 	}
-	return nil
+	addHeaders(w, header)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", result.ContentType)
+	}
+	ren.setEnvironmentHeader(w)
+	ren.setSurrogateKeys(w, result.SurrogateKeys)
+	setContentLength(w, len(result.Body))
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+	_, err = w.Write(result.Body)
+	return err
 }
 
 // String renders a template and returns it as a string.
 func (ren *Render) String(t string, td any) (string, error) {
-	// Call buildTemplate to get the template, either from the cache or by building it
-	// from disk.
-	tmpl, err := ren.buildTemplate(t)
+	t, err := ren.pageName(t)
 	if err != nil {
 		return "", err
 	}
-	// Execute the template, storing the result in a bytes.Buffer variable.
-	var tpl bytes.Buffer
-	if err := tmpl.Execute(&tpl, td); err != nil {
+	if ren.Behavior&ExecuteString != 0 {
+		return ren.executeString(t, td)
+	}
+	// Render builds the template (from the cache or from disk) and executes it,
+	// storing the result in a Result.
+	result, err := ren.Render(t, td)
+	if err != nil {
 		return "", err
 	}
-	// Return a string from the bytes.Buffer.
-	result := tpl.String()
-	return result, nil
+	// Return a string from the Result's Body.
+	return string(result.Body), nil
+}
+
+// GetTemplate returns the template set of page t as a new copy that is not
+// shared with the cache or with any render, so the caller may change it, e.g.
+// with Funcs. Changing a cached set while another goroutine executes it is a
+// data race, which is why the cached set itself is only available through
+// GetSharedTemplate.
+//
+// For functions that differ per request, don't change a set: clone the
+// Render and AddFunc (see Clone), or use the functions bound per request by
+// ShowRequest ({{status}}, {{header}}).
+func (ren *Render) GetTemplate(t string) (*template.Template, error) {
+	t, err := ren.pageName(t)
+	if err != nil {
+		return nil, err
+	}
+	// parseSet builds the set from disk without storing it in the cache.
+	set, err := ren.parseSet(t, ren.partials())
+	if err != nil {
+		return nil, err
+	}
+	return set.tmpl, nil
 }
 
-// GetTemplate attempts to get a template from cache -
-//	builds it if it does not find it - and returns it.
-//  FUNCTION NOT USED
-// func (ren *Render) GetTemplate(t string) (*template.Template, error) {
-// 	// Call buildTemplate to get the template, either from the cache or by building it
-// 	// from disk.
-// 	tmpl, err := ren.buildTemplate(t)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return tmpl, nil
-// }
+// GetSharedTemplate returns the cached template set of page t, building it
+// when it is not cached. The set is shared by every render of t: it may be
+// executed and inspected (Lookup, DefinedTemplates, Templates), but must never
+// be changed (Funcs, Parse, New, AddParseTree, Delims, Option). Use
+// GetTemplate for a copy that can be changed.
+func (ren *Render) GetSharedTemplate(t string) (*template.Template, error) {
+	t, err := ren.pageName(t)
+	if err != nil {
+		return nil, err
+	}
+	return ren.buildTemplate(t)
+}
 
 // buildTemplate a utility function that creates a template, 
 //	either from cache, or from disk. 
@@ -103,28 +561,63 @@ func (ren *Render) buildTemplate(t string) (*template.Template, error) {
 	// tmpl is the variable that will hold our template set
 	var tmpl *template.Template
 
+	var start time.Time
+	if ren.Metrics != nil {
+		start = time.Now()
+	}
+
+	// Templates of a ChangeLoader may have been edited since they were cached.
+	ren.checkLoader()
+
+	// An alias shares the cached set of its page.
+	if name, ok := ren.aliasOf(t); ok {
+		t = name
+	}
+
 	// If we are using the cache, get try to get the pre-compiled template from our
 	// map templateMap, stored in the receiver.
+	// The map is read through a snapshot without any lock, so renders of
+	// cached pages don't wait for each other or for writers: SetPartials and
+	// AddFunc replace it, and renders of pages not yet cached add to it,
+	// under the write lock, and drop the snapshot; see cachedSet.
 	if ren.UseCache {
-		if templateFromMap, ok := ren.TemplateMap[t]; ok {
+		templateFromMap, ok := ren.cachedSet(t)
+		if ok && ren.CheckModTime && ren.setChanged(t, templateFromMap) {
+			ok = false
+		}
+		if ok {
+			ren.stats.cacheHits.Add(1)
+			ren.usedSet(t)
 			if ren.Debug {
 				log.Println("114 - page-Reading template", t, "from cache")
 			}
 			tmpl = templateFromMap
+		} else {
+			ren.stats.cacheMisses.Add(1)
 		}
 	}
 
 	// At this point, tmpl will be nil if we do not have a value in the map (our template
 	// cache). In this case, we build the template from disk.
+	// Renders missing the same page at once share one build; see sharedBuild.
+	hit := tmpl != nil
 	if tmpl == nil {
 		log.Println("t", t)
-		newTemplate, err := ren.buildTemplateFromDisk(t)
+		// No lock is held, so the callback may use ren.
+		if ren.OnCacheMiss != nil {
+			ren.OnCacheMiss(t)
+		}
+		newTemplate, err := ren.sharedBuild(t)
 		if err != nil {
-			log.Println("Error building from disk")
-			return nil, err
+			if ren.Debug {
+				log.Println("Error building from disk")
+			}
+			ren.observeBuild(t, start, false)
+			return nil, ren.compatError(err)
 		}
 		tmpl = newTemplate
 	}
+	ren.observeBuild(t, start, hit)
 
 	return tmpl, nil
 }
@@ -138,36 +631,56 @@ func (ren *Render) buildTemplateFromDisk(t string) (*template.Template, error) {
 	// 't' becomes the name of the (future) template set.
 	// the key in map[string]*.template.Template
 
-	// templateSlice will hold all templates (names / file names) necessary to 
-	// build a finished template set.
-	var templateSlice []string
-
-	// Read in the partials, if any.
-	// Read any partial associated with this (future) template set.
-	// 'Future' because this is still a bunch of text.
-	templateSlice = append(templateSlice, ren.Partials...)
-
-	// Append the template name we want to render to the slice. 
-	// Use path.Join to make it os agnostic.
-	templateSlice = append(templateSlice, path.Join(ren.TemplateDir, t))
-
-	// Create a new template set by parsing all files in the slice.
-	tmpl, err := template.New(t).Funcs(ren.Functions).ParseFiles(templateSlice...)
+	// partials() returns a copy taken under the lock, so a concurrent
+	// SetPartials can't hand us a half-updated slice.
+	ren.mu.RLock()
+	gen := ren.cacheGen
+	ren.mu.RUnlock()
+	ren.stats.setsBuilt.Add(1)
+	start := time.Now()
+	var set builtSet
+	var err error
+	for {
+		// A set built while SetTemplateDir switched directories may hold
+		// files of both; it is built again from the new one.
+		dir := ren.templateDir.Load()
+		set, err = ren.parseSet(t, ren.partials())
+		if ren.templateDir.Load() == dir {
+			break
+		}
+	}
+	d := time.Since(start)
+	ren.stats.parseTime.Add(int64(d))
+	if err != nil {
+		ren.stats.buildErrors.Add(1)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// The error of the file system names the file that is missing.
+		err = fmt.Errorf("%w: %s: %w", ErrTemplateNotFound, t, err)
+	}
 	if err != nil {
+		if ren.OnBuild != nil {
+			ren.OnBuild(t, nil, d, err)
+		}
 		return nil, err
 	}
 
-	// Add the template set to the template map stored in our receiver.
-	// Note that this(?) is ignored in development, but does not hurt anything.
-	// Well, I trust it's not ignored. Otherwise there would be no template set
-	// in the map.
-	// So here is the template set 'tmpl' added: map["home.page.tmpl"] = tmpl
-	mapLock.Lock()
-	ren.TemplateMap[t] = tmpl
-	mapLock.Unlock()
+	// The files may have changed since they were read when ClearCache,
+	// Invalidate or Reload was called meanwhile; the set is used, but not
+	// cached.
+	ren.mu.Lock()
+	if ren.cacheGen == gen {
+		ren.storeSetLocked(t, set)
+	}
+	ren.mu.Unlock()
+	ren.notifyEvicted()
+	// Called after the lock is released, so the callback may use ren.
+	if ren.OnBuild != nil {
+		ren.OnBuild(t, set.files, d, nil)
+	}
 
-	// show the contents of map["home.page.tmpl"]
-	tpl := ren.TemplateMap["home.page.tmpl"]
+	// show the contents of map[t], e.g. map["home.page.tmpl"]
+	tpl := set.tmpl
 	fmt.Println("174 - page-tpl.DefinedTemplates(): ", tpl.DefinedTemplates())
 	// 139 - page-buildTemplateFromDisk.t:  home.page.tmpl
 	// 174 - page-tpl.DefinedTemplates():  ; 
@@ -187,7 +700,227 @@ func (ren *Render) buildTemplateFromDisk(t string) (*template.Template, error) {
 		log.Println("Reading template", t, "from disk")
 	}
 
-	return tmpl, nil
+	return set.tmpl, nil
+}
+
+// builtSet is a template set parsed from disk with what is cached next to it.
+type builtSet struct {
+	tmpl        *template.Template // The executable set.
+	fingerprint string             // Fingerprint of the files it was built from.
+	proto       *template.Template // Unexecuted copy when it uses response hints; nil otherwise.
+	sources     sourceMap          // Source files behind the set.
+	folded      int                // Number of static template calls folded into text.
+	calls       []string           // Templates called with {{template}}, before folding.
+	keyed       bool               // Whether the set calls {{surrogateKey}}.
+
+	modTimes    map[string]time.Time // Modification times of its files, with CheckModTime.
+	partialsKey uint64               // partialsKey of the partials and theme it was built with.
+	files       []string             // The files parsed into it, in order, for OnBuild.
+}
+
+// parseSet parses the page t together with partialFiles into a new set.
+// It doesn't touch the cache; see storeSetLocked.
+// @ t:
+// -	template name: home.page.tmpl
+// @ partialFiles:
+// -	the layouts and partials to parse into the set, e.g. ren.partials()
+func (ren *Render) parseSet(t string, partialFiles []string) (builtSet, error) {
+	theme := ren.currentTheme()
+	set, err := ren.parseThemedSet(t, partialFiles, theme, false)
+	set.partialsKey = partialsKey(partialFiles, theme)
+	return set, err
+}
+
+// parseFreshSet is parseSet reading the partials from disk too, rather than
+// cloning the base parsed before, which is left to the other sets. It is
+// for comparing the cache with the files, as /diff does.
+func (ren *Render) parseFreshSet(t string, partialFiles []string) (builtSet, error) {
+	theme := ren.currentTheme()
+	set, err := ren.parseThemedSet(t, partialFiles, theme, true)
+	set.partialsKey = partialsKey(partialFiles, theme)
+	return set, err
+}
+
+// parseThemedSet is parseSet for the theme theme; fresh is that of partialSet.
+func (ren *Render) parseThemedSet(t string, partialFiles []string, theme string, fresh bool) (builtSet, error) {
+	// Partials of the current Theme replace those of TemplateDir, and every
+	// name is used once; see ResolvedPartials for the order and priority.
+	partialFiles = ren.resolvePartialFiles(partialFiles, theme)
+
+	// Pages of AddTemplateString have no file.
+	if src, ok := ren.stringPage(t); ok {
+		return ren.parseStringSet(t, src, partialFiles, fresh)
+	}
+	// Pages of a source registered with RegisterSource are read from its FS.
+	if page, ok := ren.sourcePage(t); ok {
+		return ren.parseSourceSet(t, page, partialFiles, fresh)
+	}
+
+	// templateSlice will hold all templates (names / file names) necessary to 
+	// build a finished template set.
+	var templateSlice []string
+
+	// Read in the partials, if any.
+	// Read any partial associated with this (future) template set.
+	// 'Future' because this is still a bunch of text.
+	templateSlice = append(templateSlice, partialFiles...)
+
+	// Append the template name we want to render to the slice. 
+	// resolvePage joins it with TemplateDir and picks the page's variant for
+	// the current Environment (home.page.prod.tmpl) when there is one.
+	pageFile := ren.resolvePage(t, theme)
+	if ren.excludedFile(pageFile) {
+		return builtSet{}, fmt.Errorf("page %s is excluded from %s (see Exclude)", t, ren.currentTemplateDir())
+	}
+	templateSlice = append(templateSlice, pageFile)
+
+	// Create a new template set by parsing all partials in the slice.
+	// templateFuncs merges the built-in functions with ren.Functions, so every
+	// set (and every Clone) gets its own, current function map; setFuncs
+	// wraps them for ProfileFuncs.
+	// sources maps the names in error positions back to these files.
+	// partialSet parses the partials, or clones them parsed once before.
+	partials := templateSlice[:len(templateSlice)-1]
+	sources := ren.newSourceMap(t, pageFile, partials)
+	tmpl, stringPartials, base, err := ren.partialSet(t, partials, sources, fresh)
+	if err != nil {
+		return builtSet{}, err
+	}
+
+	// Parse the page itself into the root template, named t. ParseFiles would
+	// name it after the file, which isn't t for an environment variant.
+	// The transforms cut off front matter (metadata, not markup), and the
+	// source map shifts line numbers back to those of the file.
+	src, err := ren.readTemplate(pageFile)
+	if err != nil {
+		return builtSet{}, err
+	}
+	src, skipped, err := ren.transformSource(pageFile, src)
+	if err != nil {
+		return builtSet{}, err
+	}
+	sources[t] = sourceFile{Path: pageFile, LineOffset: skipped}
+	if _, err := tmpl.Parse(string(src)); err != nil {
+		return builtSet{}, renderError(t, sources, err)
+	}
+	// The partials of UsePartialSet come last, so a page defining one of
+	// their names is caught.
+	if err := ren.addPartialSets(tmpl); err != nil {
+		return builtSet{}, err
+	}
+
+	// Fingerprint the files the set was built from, so output cached on disk
+	// can tell when the templates behind it changed.
+	fingerprint, err := ren.fingerprintAfter(base, partials, pageFile)
+	if err != nil {
+		return builtSet{}, err
+	}
+	return ren.finishSet(tmpl, sources, fingerprintStrings(fingerprint, stringPartials), templateSlice)
+}
+
+// finishSet prepares the freshly parsed set tmpl for execution and returns
+// it with what is cached next to it. files are the template files on disk
+// it was parsed from, for CheckModTime.
+func (ren *Render) finishSet(tmpl *template.Template, sources sourceMap, fingerprint string, files []string) (builtSet, error) {
+	// Add the template set to the template map stored in our receiver.
+	// Note that this(?) is ignored in development, but does not hurt anything.
+	// Well, I trust it's not ignored. Otherwise there would be no template set
+	// in the map.
+	// So here is the template set 'tmpl' added: map["home.page.tmpl"] = tmpl
+	// Replace calls of partials without any actions by their text, so
+	// static markup isn't executed again on every render.
+	// With Coverage set, templates get coverage markers instead; folded
+	// partials would never show up as executed.
+	// Note the templates called before folding removes calls; Deprecate
+	// needs them.
+	calls := calledTemplates(tmpl)
+	var folded int
+	if ren.Coverage != nil {
+		if err := ren.Coverage.instrument(tmpl); err != nil {
+			return builtSet{}, err
+		}
+	} else {
+		folded = foldStaticTemplates(tmpl)
+	}
+	// With TraceBlocks set, every template gets markers to time it.
+	if ren.TraceBlocks > 0 {
+		if err := instrumentBlocks(tmpl); err != nil {
+			return builtSet{}, err
+		}
+	}
+
+	// A set using {{status}} or {{header}} keeps an unexecuted copy:
+	// html/template can't Clone a set after it has been executed, and
+	// ShowRequest needs a clone to bind the functions of each request.
+	// Traced renders bind their tracer, and renders of sets calling
+	// {{surrogateKey}} their key collector, the same way.
+	keyed := usesFunc(tmpl, "surrogateKey")
+	var proto *template.Template
+	if usesFunc(tmpl, hintFuncs...) || ren.TraceBlocks > 0 || keyed {
+		var err error
+		proto, err = tmpl.Clone()
+		if err != nil {
+			return builtSet{}, err
+		}
+	}
+	var modTimes map[string]time.Time
+	if ren.CheckModTime {
+		modTimes = ren.modTimesOf(files)
+	}
+	return builtSet{tmpl: tmpl, fingerprint: fingerprint, proto: proto, sources: sources, folded: folded, calls: calls, keyed: keyed, modTimes: modTimes, files: files}, nil
+}
+
+// storeSetLocked records set as the set of page t. It is the only place a
+// set is added to the cache, and it is added only with UseCache, evicting
+// others for MaxCachedTemplates; without it, the map stays empty and only
+// what renders look up next to the set (one entry per page) is kept. The
+// caller must hold ren.mu, and call notifyEvicted after releasing it.
+func (ren *Render) storeSetLocked(t string, set builtSet) {
+	ren.stats.foldedIncludes.Add(int64(set.folded))
+	// The snapshot holds what is kept next to a cached set as well.
+	ren.snapshot.Store(nil)
+	if ren.fingerprints == nil {
+		ren.fingerprints = make(map[string]string)
+	}
+	ren.fingerprints[t] = set.fingerprint
+	if ren.sourceMaps == nil {
+		ren.sourceMaps = make(map[string]sourceMap)
+	}
+	ren.sourceMaps[t] = set.sources
+	if ren.protos == nil {
+		ren.protos = make(map[string]*template.Template)
+	}
+	ren.protos[t] = set.proto
+	if ren.calls == nil {
+		ren.calls = make(map[string][]string)
+	}
+	ren.calls[t] = set.calls
+	if ren.keyed == nil {
+		ren.keyed = make(map[string]bool)
+	}
+	ren.keyed[t] = set.keyed
+	delete(ren.deprecatedUses, t)
+	if set.modTimes != nil {
+		if ren.modTimes == nil {
+			ren.modTimes = make(map[string]map[string]time.Time)
+		}
+		ren.modTimes[t] = set.modTimes
+	} else {
+		delete(ren.modTimes, t)
+	}
+	if !ren.UseCache {
+		return
+	}
+	if ren.cache == nil {
+		ren.cache = make(map[string]*template.Template)
+	}
+	ren.cache[t] = set.tmpl
+	if ren.partialsKeys == nil {
+		ren.partialsKeys = make(map[string]uint64)
+	}
+	ren.partialsKeys[t] = set.partialsKey
+	ren.usedSet(t)
+	ren.evictLocked()
 }
 
 /*
@@ -208,52 +941,81 @@ both templates are read from cache:
 //
 // Files anywhere in TemplateDir will be added the the Partials field of the Render type.
 //
+// A TemplateDir that doesn't exist gives ErrTemplateDirNotFound, and one
+// without any template file ErrNoTemplatesFound, both with the absolute path.
+//
 // Function returns:
 //  [templates/base.layout.tmpl templates/css.partial.tmpl templates/footer.partial.tmpl]
 func (ren *Render) LoadLayoutsAndPartials(fileTypes []string) error {
+	return ren.LoadLayoutsAndPartialsContext(context.Background(), fileTypes)
+}
+
+// LoadLayoutsAndPartialsContext is LoadLayoutsAndPartials, stopping the scan
+// of TemplateDir when ctx is done. See findContext for the limits of the scan.
+func (ren *Render) LoadLayoutsAndPartialsContext(ctx context.Context, fileTypes []string) error {
+	// A ChangeLoader is asked for the changes after this discovery.
+	ren.mu.Lock()
+	ren.loaderChecked = time.Now()
+	ren.mu.Unlock()
 	fmt.Println("159 - page-LoadLayoutsAndPartials: ", fileTypes)
 	// 159 - page-LoadLayoutsAndPartials:  [.layout .partial]
-	var templates []string
-	for _, t := range fileTypes {
-		files, err := addTemplate(ren.TemplateDir, t)
-		if err != nil {
+	templates, err := ren.discoverPartials(ctx, fileTypes)
+	if err != nil {
+		return err
+	}
+	ren.SetPartials(templates)
+	fmt.Println("171 - page-LoadLayoutsAndPartials: ", ren.partials())
+	// 171 - page-LoadLayoutsAndPartials:  [templates/base.layout.tmpl templates/css.partial.tmpl templates/footer.partial.tmpl]
+	// Templates defined in two files are kept by parse order, silently; in
+	// Debug, fail here instead.
+	if ren.Debug {
+		if err := ren.CheckDuplicates(); err != nil {
+			log.Println(err)
 			return err
 		}
-		templates = append(templates, files...)
 	}
-	ren.Partials = templates
-	fmt.Println("171 - page-LoadLayoutsAndPartials: ", ren.Partials)
-	// 171 - page-LoadLayoutsAndPartials:  [templates/base.layout.tmpl templates/css.partial.tmpl templates/footer.partial.tmpl]
-	return nil
+	// The tenants of AddTenant share the layouts, so they are rescanned too.
+	return ren.loadTenantPartials(ctx, fileTypes)
 }
 
-func addTemplate(path, fileType string) ([]string, error) {
-	files, err := find(path, ".tmpl")
+// discoverPartials returns the files of the given types in TemplateDir, with
+// the variants for the current Environment used and those for others skipped.
+// TemplateDir is scanned once; the files are listed type by type. With
+// several TemplateDirs, later ones override files of earlier ones; see
+// findTemplates.
+func (ren *Render) discoverPartials(ctx context.Context, fileTypes []string) ([]string, error) {
+	files, err := ren.findTemplates(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var templates []string
-	for _, x := range files {
-		if strings.Contains(x, fileType) {
-			templates = append(templates, x)
+	// An empty tree is most likely the wrong directory, or templates with
+	// other extensions; say so now rather than on every render.
+	if len(files) == 0 {
+		dirs := make([]string, 0, len(ren.templateDirs()))
+		for _, dir := range ren.templateDirs() {
+			dirs = append(dirs, ren.displayDir(dir))
 		}
+		return nil, fmt.Errorf("%w in %s (files ending in %s)", ErrNoTemplatesFound, strings.Join(dirs, ", "), strings.Join(ren.extensions(), ", "))
+	}
+	var templates []string
+	for _, t := range fileTypes {
+		templates = append(templates, addTemplate(files, t)...)
 	}
-	return templates, nil
+	return ren.selectVariants(templates), nil
 }
 
-func find(root, ext string) ([]string, error) {
-	var files []string
-	err := filepath.WalkDir(root, func(s string, d fs.DirEntry, e error) error {
-		if e != nil {
-			return e
-		}
-		if filepath.Ext(d.Name()) == ext {
-			files = append(files, s)
+// addTemplate returns the files of files of the type fileType, e.g. ".layout":
+// those with the marker as a dotted part of the file name, as in
+// "base.layout.tmpl" or "base.layout.prod.tmpl". Directory names don't
+// count, nor does the marker as part of a longer one, as in
+// "checkout.layout-preview.page.tmpl".
+func addTemplate(files []string, fileType string) []string {
+	marker := "." + strings.TrimPrefix(fileType, ".") + "."
+	var templates []string
+	for _, x := range files {
+		if strings.Contains(filepath.Base(x), marker) {
+			templates = append(templates, x)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	return files, nil
+	return templates
 }
@@ -0,0 +1,95 @@
+package page
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeTemplates writes files, named by their path below dir, into a new
+// temporary directory and returns it.
+func writeTemplates(tb testing.TB, files map[string]string) string {
+	tb.Helper()
+	dir := tb.TempDir()
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// newTestRender returns a Render for the templates in dir with the layouts
+// and partials loaded.
+func newTestRender(tb testing.TB, dir string) *Render {
+	tb.Helper()
+	ren := New()
+	ren.TemplateDir = dir
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		tb.Fatal(err)
+	}
+	return ren
+}
+
+// waitFor calls f until it returns true, failing t after a few seconds.
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAddTemplate(t *testing.T) {
+	tests := []struct {
+		file, fileType string
+		want           bool
+	}{
+		{"templates/base.layout.tmpl", ".layout", true},
+		{"templates/footer.partial.tmpl", ".partial", true},
+		{"templates/footer.partial.gohtml", "partial", true},
+		{"templates/footer.partial.prod.tmpl", ".partial", true},
+		{"templates/admin/base.layout.tmpl", ".layout", true},
+
+		{"templates/checkout.layout-preview.page.tmpl", ".layout", false},
+		{"templates/overlay.outline.tmpl", ".layout", false},
+		{"templates/partials-old/home.page.tmpl", ".partial", false},
+		{"templates/x.layout/home.page.tmpl", ".layout", false},
+		{"templates/mylayout.tmpl", ".layout", false},
+		{"templates/base.layouts.tmpl", ".layout", false},
+		{"templates/footer.partial.tmpl", ".layout", false},
+	}
+	for _, tt := range tests {
+		got := len(addTemplate([]string{tt.file}, tt.fileType)) == 1
+		if got != tt.want {
+			t.Errorf("addTemplate(%q, %q) matched %v, want %v", tt.file, tt.fileType, got, tt.want)
+		}
+	}
+}
+
+// Files only looking like layouts or partials are pages, and are not parsed
+// into the other pages.
+func TestLoadLayoutsAndPartialsMarkers(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"base.layout.tmpl":                  `{{define "base"}}[{{block "content" .}}{{end}}]{{end}}`,
+		"footer.partial.tmpl":               `{{define "footer"}}footer{{end}}`,
+		"checkout.layout-preview.page.tmpl": `{{define "base"}}preview{{end}}`,
+		"partials-old/old.page.tmpl":        `{{define "footer"}}old{{end}}`,
+		"home.page.tmpl":                    `{{template "base" .}}{{define "content"}}{{template "footer"}}{{end}}`,
+	}))
+	if got, want := partialNames(ren), []string{"base.layout.tmpl", "footer.partial.tmpl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Partials = %q, want %q", got, want)
+	}
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[footer]" {
+		t.Errorf("home: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,67 @@
+package page
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pageName returns the name of the page t stands for, which is the name the
+// page is cached and executed under. An alias (see Alias) stands for its
+// page. A name with a template file extension (see Extensions) is the name
+// of the page, and so is the name of a page of AddTemplateString. Other names
+// are resolved among the pages of TemplateDir and of the registered sources:
+// "home" and "home.page" both stand for "home.page.gohtml", and "admin/users"
+// and "users" both stand for "admin/users.page.tmpl" when no other page is
+// named users. A name matching no page, or more than one, is an error; the
+// error lists the candidates. Resolved names are remembered until the
+// partials or the cache are replaced.
+func (ren *Render) pageName(t string) (string, error) {
+	if name, ok := ren.aliasOf(t); ok {
+		return name, nil
+	}
+	if _, ok := ren.stringPage(t); ok || ren.isTemplateFile(t) {
+		return t, nil
+	}
+	ren.mu.RLock()
+	name, ok := ren.pageAliases[t]
+	ren.mu.RUnlock()
+	if ok {
+		return name, nil
+	}
+
+	pages, err := ren.pageNames()
+	if err != nil {
+		return "", err
+	}
+	// A page in a subdirectory is matched by its path ("admin/users") and,
+	// when no page matches that way, by its base name ("users").
+	var candidates, inSubdirs []string
+	for _, p := range append(pages, ren.sourcePageNames()...) {
+		stem := strings.TrimSuffix(p, filepath.Ext(p))
+		if stem == t || stem == t+".page" {
+			candidates = append(candidates, p)
+		} else if base := path.Base(stem); base == t || base == t+".page" {
+			inSubdirs = append(inSubdirs, p)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = inSubdirs
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no page %q in %s", t, strings.Join(ren.templateDirs(), ", "))
+	case 1:
+	default:
+		return "", fmt.Errorf("page name %q is ambiguous: it matches %s", t, strings.Join(candidates, ", "))
+	}
+
+	ren.mu.Lock()
+	if ren.pageAliases == nil {
+		ren.pageAliases = make(map[string]string)
+	}
+	ren.pageAliases[t] = candidates[0]
+	ren.mu.Unlock()
+	return candidates[0], nil
+}
@@ -0,0 +1,86 @@
+package page
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageName(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"home.page.gohtml":      `home`,
+		"admin/users.page.tmpl": `admin users`,
+		"admin/index.page.tmpl": `admin index`,
+		"index.page.tmpl":       `index`,
+		"shop/cart.page.tmpl":   `shop cart`,
+		"cart/cart.page.tmpl":   `cart cart`,
+	}))
+	if err := ren.Alias("start", "home.page.gohtml"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, want string
+		wantErr    []string // Parts of the error; nil for none.
+	}{
+		{"home", "home.page.gohtml", nil},
+		{"home.page", "home.page.gohtml", nil},
+		{"home.page.gohtml", "home.page.gohtml", nil},
+		{"start", "home.page.gohtml", nil},
+		{"admin/users", "admin/users.page.tmpl", nil},
+		{"users", "admin/users.page.tmpl", nil},
+		// A page at the top wins over one in a subdirectory.
+		{"index", "index.page.tmpl", nil},
+		{"admin/index", "admin/index.page.tmpl", nil},
+		{"cart", "", []string{`"cart" is ambiguous`, "cart/cart.page.tmpl", "shop/cart.page.tmpl"}},
+		{"missing", "", []string{`no page "missing"`}},
+	}
+	for _, tt := range tests {
+		got, err := ren.pageName(tt.name)
+		if tt.wantErr == nil {
+			if err != nil || got != tt.want {
+				t.Errorf("pageName(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("pageName(%q) = %q, want an error", tt.name, got)
+			continue
+		}
+		for _, part := range tt.wantErr {
+			if !strings.Contains(err.Error(), part) {
+				t.Errorf("pageName(%q): error %q doesn't contain %q", tt.name, err, part)
+			}
+		}
+	}
+}
+
+// A short name and the file name of a page share one cached set, and an
+// ambiguous or missing name fails the render.
+func TestShortNameCache(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"home.page.gohtml":   `home`,
+		"a/cart.page.tmpl":   `a`,
+		"b/cart.page.gohtml": `b`,
+	}))
+	ren.UseCache = true
+	for _, name := range []string{"home", "home.page", "home.page.gohtml"} {
+		if got, err := ren.String(name, nil); err != nil || got != "home" {
+			t.Fatalf("%s: got %q, %v", name, got, err)
+		}
+	}
+	if got, want := ren.CachedTemplates(), []string{"home.page.gohtml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CachedTemplates = %q, want %q", got, want)
+	}
+	if s := ren.Stats(); s.SetsBuilt != 1 {
+		t.Errorf("SetsBuilt = %d, want 1", s.SetsBuilt)
+	}
+
+	for _, name := range []string{"cart", "nothing"} {
+		if _, err := ren.String(name, nil); err == nil {
+			t.Errorf("%s rendered", name)
+		}
+	}
+	if _, err := ren.GetTemplate("cart"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("GetTemplate(cart): error %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Package pagetest contains helpers for testing code that uses package page.
+package pagetest
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/examples/page-use/page"
+)
+
+// VerifyIsolation checks that two clones of ren do not leak template functions
+// into each other or into ren.
+// @ ren:
+// -	the configured (parent) Render, usually the one shared by all tenants
+// @ name, td:
+// -	the page to render and its data; the page must call {{funcName}}
+// @ funcName, a, b:
+//   - a function name and two conflicting implementations of it,
+//     e.g. "tenant", func() string { return "a" }, func() string { return "b" }
+//
+// The page is rendered through a clone using a and a clone using b. The test
+// fails when both outputs are the same, when rendering through the first clone
+// again gives a different output than before (the second clone leaked into it),
+// or when the parent's functions or cache were changed by the clones.
+func VerifyIsolation(t testing.TB, ren *page.Render, name string, td any, funcName string, a, b any) {
+	t.Helper()
+
+	parentFunc, parentHasFunc := ren.Functions[funcName]
+	parentCached := len(ren.CachedTemplates())
+
+	cloneA := ren.Clone()
+	cloneA.AddFunc(funcName, a)
+	cloneB := ren.Clone()
+	cloneB.AddFunc(funcName, b)
+
+	outA, err := cloneA.String(name, td)
+	if err != nil {
+		t.Fatalf("rendering %s through the first clone: %v", name, err)
+	}
+	outB, err := cloneB.String(name, td)
+	if err != nil {
+		t.Fatalf("rendering %s through the second clone: %v", name, err)
+	}
+	if outA == outB {
+		t.Errorf("rendering %s through clones with different %q functions gave the same output", name, funcName)
+	}
+
+	again, err := cloneA.String(name, td)
+	if err != nil {
+		t.Fatalf("rendering %s through the first clone again: %v", name, err)
+	}
+	if again != outA {
+		t.Errorf("output of the first clone changed after rendering through the second clone")
+	}
+
+	fn, hasFunc := ren.Functions[funcName]
+	if hasFunc != parentHasFunc || fmt.Sprintf("%p", fn) != fmt.Sprintf("%p", parentFunc) {
+		t.Errorf("function %q of the parent Render was changed by a clone", funcName)
+	}
+	if cached := len(ren.CachedTemplates()); cached != parentCached {
+		t.Errorf("parent cache changed from %d to %d entries while rendering through clones", parentCached, cached)
+	}
+}
+
+// VerifyConcurrentFuncs checks that the page can be rendered concurrently with
+// different implementations of one template function. Run it with the race
+// detector (go test -race): the guarantee it checks is the absence of races.
+// @ ren:
+// -	the configured (parent) Render
+// @ name, td:
+// -	the page to render and its data; the page must call {{funcName}}
+// @ funcName, n, fns:
+// -	a function name, the number of concurrent renders and at least two implementations
+//
+// Every implementation gets its own clone of ren (the supported pattern, see
+// page.Render.Clone). The page is rendered once through each clone, then
+// n times concurrently through all of them, while other goroutines change and
+// execute copies returned by GetTemplate with another implementation.
+// The test fails when a render fails or gives another output than the first
+// render through the same clone.
+func VerifyConcurrentFuncs(t testing.TB, ren *page.Render, name string, td any, funcName string, n int, fns ...any) {
+	t.Helper()
+
+	clones := make([]*page.Render, len(fns))
+	want := make([]string, len(fns))
+	for i, fn := range fns {
+		clones[i] = ren.Clone()
+		clones[i].AddFunc(funcName, fn)
+		out, err := clones[i].String(name, td)
+		if err != nil {
+			t.Fatalf("rendering %s through clone %d: %v", name, i, err)
+		}
+		want[i] = out
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for k := 0; k < n; k++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			out, err := clones[i].String(name, td)
+			if err != nil {
+				errs <- fmt.Errorf("rendering %s through clone %d: %w", name, i, err)
+			} else if out != want[i] {
+				errs <- fmt.Errorf("rendering %s through clone %d concurrently gave another output", name, i)
+			}
+		}(k % len(fns))
+		go func(i int) {
+			defer wg.Done()
+			tmpl, err := clones[i].GetTemplate(name)
+			if err != nil {
+				errs <- fmt.Errorf("getting a copy of %s: %w", name, err)
+				return
+			}
+			if err := tmpl.Funcs(template.FuncMap{funcName: fns[(i+1)%len(fns)]}).ExecuteTemplate(io.Discard, name, td); err != nil {
+				errs <- fmt.Errorf("executing a changed copy of %s: %w", name, err)
+			}
+		}(k % len(fns))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// Hammer renders pages through ren from many goroutines for the duration d,
+// while other goroutines do what a running application does concurrently:
+// clearing the cache (SetPartials with the current list), rendering through
+// ShowRequest and reading Stats. It fails the test on any render error.
+// Run it with the race detector (go test -race) against your own configuration
+// (functions, GlobalData, partials) to check it keeps the guarantees listed
+// in the documentation of page.Render.
+// @ pages:
+// -	the pages to render with their data, e.g. {"home.page.tmpl": data}
+func Hammer(t testing.TB, ren *page.Render, pages map[string]any, d time.Duration) {
+	t.Helper()
+
+	partials := append([]string(nil), ren.Partials...)
+	stop := time.Now().Add(d)
+	workers := 4 * runtime.GOMAXPROCS(0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; time.Now().Before(stop); i++ {
+				var err error
+				for name, td := range pages {
+					switch (w + i) % 4 {
+					case 0:
+						_, err = ren.String(name, td)
+					case 1:
+						_, err = ren.Render(name, td)
+					case 2:
+						rec := httptest.NewRecorder()
+						err = ren.ShowRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil), name, td)
+					case 3:
+						if w == 0 {
+							ren.SetPartials(partials)
+						}
+						ren.Stats()
+					}
+					if err != nil {
+						errs <- fmt.Errorf("rendering %s: %w", name, err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// VerifyColdCache renders the page name with n goroutines at once right after
+// the cache of ren was cleared, so they all find it missing and build it at
+// the same time, as the first requests after a deploy do. Run it with the race
+// detector (go test -race), e.g. with n = 50. The test fails when a render
+// fails, when two renders give different outputs, or when the page was built
+// more than once with UseCache set (see page.Stats.SetsBuilt).
+func VerifyColdCache(t testing.TB, ren *page.Render, name string, td any, n int) {
+	t.Helper()
+
+	ren.SetPartials(append([]string(nil), ren.Partials...))
+	built := ren.Stats().SetsBuilt
+	start := make(chan struct{})
+	outs := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			outs[i], errs[i] = ren.String(name, td)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("rendering %s on a cold cache (goroutine %d): %v", name, i, err)
+		}
+		if outs[i] != outs[0] {
+			t.Errorf("rendering %s on a cold cache gave different outputs in goroutines 0 and %d", name, i)
+		}
+	}
+	if n := ren.Stats().SetsBuilt - built; ren.UseCache && n != 1 {
+		t.Errorf("%s was built %d times by concurrent renders on a cold cache, want once", name, n)
+	}
+}
+
+// RenderObservation is a call of page.Metrics.ObserveRender.
+type RenderObservation struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// BuildObservation is a call of page.Metrics.ObserveBuild.
+type BuildObservation struct {
+	Name     string
+	Duration time.Duration
+	CacheHit bool
+}
+
+// Metrics is a page.Metrics that records every observation, for testing
+// the metrics of a handler:
+//
+//	m := &pagetest.Metrics{}
+//	ren.Metrics = m
+//	// ... serve a request ...
+//	if r := m.Renders(); len(r) != 1 || r[0].Name != "home.page.tmpl" { ... }
+//
+// It is safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	renders []RenderObservation
+	builds  []BuildObservation
+}
+
+// ObserveRender records a render.
+func (m *Metrics) ObserveRender(name string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renders = append(m.renders, RenderObservation{Name: name, Duration: d, Err: err})
+}
+
+// ObserveBuild records getting a template set.
+func (m *Metrics) ObserveBuild(name string, d time.Duration, cacheHit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builds = append(m.builds, BuildObservation{Name: name, Duration: d, CacheHit: cacheHit})
+}
+
+// Renders returns the renders observed so far, in order.
+func (m *Metrics) Renders() []RenderObservation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RenderObservation(nil), m.renders...)
+}
+
+// Builds returns the template sets got so far, in order.
+func (m *Metrics) Builds() []BuildObservation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]BuildObservation(nil), m.builds...)
+}
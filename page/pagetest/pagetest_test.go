@@ -0,0 +1,94 @@
+package pagetest
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/examples/page-use/page"
+)
+
+// newRender returns a Render for a layout and pages in a new temporary
+// directory. The page tenant.page.tmpl calls the function tenant, which the
+// Render doesn't have.
+func newRender(t *testing.T) *page.Render {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.layout.tmpl": `{{define "base"}}[{{block "content" .}}{{end}}]{{end}}`,
+		"home.page.tmpl":   `{{template "base" .}}{{define "content"}}home {{.}}{{end}}`,
+		"tenant.page.tmpl": `{{template "base" .}}{{define "content"}}{{tenant}} {{.}}{{end}}`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ren := page.New()
+	ren.TemplateDir = dir
+	if err := ren.LoadLayoutsAndPartials([]string{".layout"}); err != nil {
+		t.Fatal(err)
+	}
+	return ren
+}
+
+// Run with go test -race: renders of a cold page, and of a Render and its
+// Clone at once while their caches are cleared, must not race.
+func TestColdCache(t *testing.T) {
+	for _, useCache := range []bool{false, true} {
+		ren := newRender(t)
+		ren.UseCache = useCache
+		VerifyColdCache(t, ren, "home.page.tmpl", "x", 50)
+	}
+}
+
+func TestHammerWithClone(t *testing.T) {
+	ren := newRender(t)
+	ren.UseCache = true
+	clone := ren.Clone()
+	pages := map[string]any{"home.page.tmpl": "x"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Hammer(t, clone, pages, 200*time.Millisecond)
+	}()
+	Hammer(t, ren, pages, 200*time.Millisecond)
+	wg.Wait()
+}
+
+func TestVerifyIsolation(t *testing.T) {
+	for _, useCache := range []bool{false, true} {
+		ren := newRender(t)
+		ren.UseCache = useCache
+		VerifyIsolation(t, ren, "tenant.page.tmpl", "x", "tenant",
+			func() string { return "a" }, func() string { return "b" })
+
+		// The parent has its own function and a cached set of the page.
+		ren = newRender(t)
+		ren.UseCache = useCache
+		ren.AddFunc("tenant", func() string { return "parent" })
+		if got, err := ren.String("tenant.page.tmpl", "x"); err != nil || got != "[parent x]" {
+			t.Fatalf("parent: got %q, %v", got, err)
+		}
+		VerifyIsolation(t, ren, "tenant.page.tmpl", "x", "tenant",
+			func() string { return "a" }, func() string { return "b" })
+		if got, err := ren.String("tenant.page.tmpl", "x"); err != nil || got != "[parent x]" {
+			t.Errorf("parent after the clones: got %q, %v", got, err)
+		}
+	}
+}
+
+// Run with go test -race: clones with different implementations of a
+// function render one page at once, while copies of GetTemplate are changed.
+func TestVerifyConcurrentFuncs(t *testing.T) {
+	for _, useCache := range []bool{false, true} {
+		ren := newRender(t)
+		ren.UseCache = useCache
+		VerifyConcurrentFuncs(t, ren, "tenant.page.tmpl", "x", "tenant", 200,
+			func() string { return "a" }, func() string { return "b" }, func() string { return "c" })
+	}
+}
@@ -0,0 +1,195 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"sort"
+)
+
+// SetPartials replaces the list of layout and partial files parsed into every
+// page. Duplicates are dropped (the first occurrence keeps its position) and
+// the template cache is cleared, so every page is rebuilt with the new list on
+// its next render. It is safe to call while pages are being rendered.
+func (ren *Render) SetPartials(partials []string) {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	ren.setPartialsLocked(dedupe(nil, partials))
+}
+
+// AddPartials adds files to the list of layout and partial files parsed into
+// every page. Files already in the list are ignored. Like SetPartials, it
+// clears the template cache and is safe to call while pages are rendered.
+func (ren *Render) AddPartials(partials ...string) {
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	ren.setPartialsLocked(dedupe(ren.Partials, partials))
+}
+
+// setPartialsLocked stores partials and replaces the cache. Builds running at
+// the time, with the old partials, are not cached. The caller must hold
+// ren.mu.
+func (ren *Render) setPartialsLocked(partials []string) {
+	old, pages := ren.Partials, ren.cachedPagesLocked()
+	ren.partialsMu.Lock()
+	ren.Partials = partials
+	ren.partialsMu.Unlock()
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	ren.pageAliases = nil
+	if ren.Debug {
+		log.Println("Partials changed to", partials, "- template cache cleared")
+	}
+	evs := fileEvents(old, partials, pages)
+	if len(pages) > 0 {
+		evs = append(evs, TemplateEvent{Type: TemplateInvalidated, Pages: pages})
+	}
+	ren.publish(evs...)
+}
+
+// partials returns a copy of the Partials list, taken under the lock.
+// Code in this package reads the list through partials only.
+func (ren *Render) partials() []string {
+	ren.partialsMu.RLock()
+	defer ren.partialsMu.RUnlock()
+	return append([]string(nil), ren.Partials...)
+}
+
+// dedupe returns a new slice holding list followed by the entries of add,
+// without duplicates.
+func dedupe(list, add []string) []string {
+	seen := make(map[string]bool, len(list)+len(add))
+	result := make([]string, 0, len(list)+len(add))
+	for _, l := range [][]string{list, add} {
+		for _, p := range l {
+			if !seen[p] {
+				seen[p] = true
+				result = append(result, p)
+			}
+		}
+	}
+	return result
+}
+
+// ResolvedPartial is a partial parsed into every page, see ResolvedPartials.
+type ResolvedPartial struct {
+	Name string // Name it is called by, e.g. "components/card.partial.tmpl".
+	File string // Where it comes from: its file, "builtin:<name>" or "string:<name>".
+}
+
+// ResolvedPartials returns the partials the pages of the current Theme are
+// parsed with, one per name, in the order they are parsed: the built-in
+// ones, the partial files, then those of AddPartialString. The files come
+// in the order of the file types of the last LoadLayoutsAndPartials, e.g.
+// the layouts before the partials, so a partial defining a template
+// overrides the {{block}} default of a layout; files of the same type are
+// sorted by name.
+// When several sources have a partial of the same name, the one used is, by
+// priority: a partial of AddPartialString, a file of the Theme, a file of a
+// later TemplateDirs entry, a file of an earlier one, a built-in partial.
+// With Debug, every partial left out for another is logged when sets are
+// built.
+func (ren *Render) ResolvedPartials() ([]ResolvedPartial, error) {
+	files := ren.resolvePartialFiles(ren.partials(), ren.currentTheme())
+	builtins, err := ren.builtinsFor(files)
+	if err != nil {
+		return nil, err
+	}
+	var result []ResolvedPartial
+	for _, name := range builtins {
+		result = append(result, ResolvedPartial{Name: name, File: "builtin:" + name})
+	}
+	for _, f := range files {
+		result = append(result, ResolvedPartial{Name: ren.templateName(f), File: f})
+	}
+	for _, p := range ren.stringPartialList() {
+		result = append(result, ResolvedPartial{Name: p.name, File: stringPath(p.name)})
+	}
+	return result, nil
+}
+
+// resolvePartialFiles returns the partial files of files a set of theme is
+// parsed with: one file per templateName, in the order of ResolvedPartials,
+// so neither the order of a directory scan nor that of the Partials list
+// changes what a page renders. Of the files with the same name, the one of highest
+// partialRank is used, the first of them on a tie; a file with the name of a
+// partial of AddPartialString is left out.
+func (ren *Render) resolvePartialFiles(files []string, theme string) []string {
+	files = ren.themedFiles(files, theme)
+	inStrings := make(map[string]bool)
+	for _, p := range ren.stringPartialList() {
+		inStrings[p.name] = true
+	}
+	byName := make(map[string]string, len(files))
+	for _, f := range files {
+		name := ren.templateName(f)
+		if inStrings[name] {
+			if ren.Debug {
+				log.Println("Partial", f, "is shadowed by", stringPath(name))
+			}
+			continue
+		}
+		other, ok := byName[name]
+		if !ok {
+			byName[name] = f
+			continue
+		}
+		used, shadowed := other, f
+		if ren.partialRank(f) > ren.partialRank(other) {
+			used, shadowed = f, other
+		}
+		byName[name] = used
+		if ren.Debug {
+			log.Println("Partial", shadowed, "is shadowed by", used)
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	ranks := make(map[string]int, len(names))
+	for _, name := range names {
+		ranks[name] = ren.typeRank(byName[name])
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ranks[names[i]] != ranks[names[j]] {
+			return ranks[names[i]] < ranks[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, byName[name])
+	}
+	return result
+}
+
+// typeRank returns the index of the first file type of the last
+// LoadLayoutsAndPartials file is of, or the number of those types when it is
+// of none of them: layouts, listed first, are parsed before partials.
+func (ren *Render) typeRank(file string) int {
+	ren.mu.RLock()
+	fileTypes := ren.partialTypes
+	ren.mu.RUnlock()
+	for i, fileType := range fileTypes {
+		if len(addTemplate([]string{file}, fileType)) > 0 {
+			return i
+		}
+	}
+	return len(fileTypes)
+}
+
+// partialRank returns the priority of the partial file file among files of
+// the same name: a file of a theme comes first, then the files of the
+// template directories, later ones before earlier ones, then files outside
+// of them.
+func (ren *Render) partialRank(file string) int {
+	if _, _, ok := ren.themeOf(file); ok {
+		return len(ren.templateDirs()) + 1
+	}
+	if i, _, ok := ren.dirOf(file); ok {
+		return i + 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package page
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartialOverridesBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+	}{
+		{"layout sorted before the partial", "a.layout.tmpl"},
+		{"layout sorted after the partial", "z.layout.tmpl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTemplates(t, map[string]string{
+				tt.layout:          `{{define "base"}}<{{block "css" .}}default{{end}}>{{end}}`,
+				"css.partial.tmpl": `{{define "css"}}override{{end}}`,
+				"home.page.tmpl":   `{{template "base" .}}`,
+			})
+			ren := newTestRender(t, dir)
+			// With UseCache, the set is built on the partial base.
+			for _, useCache := range []bool{false, true} {
+				ren.UseCache = useCache
+				got, err := ren.String("home.page.tmpl", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != "<override>" {
+					t.Errorf("UseCache %v: got %q, want %q", useCache, got, "<override>")
+				}
+			}
+
+			resolved, err := ren.ResolvedPartials()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, p := range resolved {
+				if p.File != "builtin:"+p.Name {
+					names = append(names, p.Name)
+				}
+			}
+			if want := []string{tt.layout, "css.partial.tmpl"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("ResolvedPartials = %q, want %q", names, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// PartialSet is a package of partials shared by several applications, e.g.
+// the templates of a design system published as a Go module with an embedded
+// FS, used with Render.UsePartialSet.
+//
+// The templates the set defines (and its files, by base name) are called
+// with the Namespace in front: {{define "button"}} in the set is
+// {{template "ds/button" .}} in the pages of the host, while the partials of
+// the set keep calling each other by their own names.
+type PartialSet struct {
+	Name      string   // Module or package of the set, for errors, e.g. "example.com/design".
+	FS        fs.FS    // The partials: every template file in FS, see Render.Extensions.
+	Namespace string   // Prefix of the templates of the set, e.g. "ds"; letters, digits, '-' and '_'.
+	Funcs     []string // Functions the partials call that the host has to provide in Functions.
+}
+
+// usedPartialSet is a PartialSet in use: its templates, parsed and renamed
+// into its namespace.
+type usedPartialSet struct {
+	set   PartialSet
+	trees map[string]*parse.Tree
+}
+
+// UsePartialSet adds the partials of set to every page ren builds. It checks
+// that the host provides the functions the set declares in Funcs, that the
+// namespace is valid and not used by another set, and that the partials
+// parse; the error lists every problem found. Call it at startup, before the
+// first render: pages built before don't get the set. A page defining a
+// template of the namespace itself fails to build.
+func (ren *Render) UsePartialSet(set PartialSet) error {
+	var errs []error
+	if set.Namespace == "" || strings.IndexFunc(set.Namespace, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+	}) >= 0 {
+		errs = append(errs, fmt.Errorf("partial set %s: invalid namespace %q", set.Name, set.Namespace))
+	}
+	funcs := ren.templateFuncs()
+	for _, name := range set.Funcs {
+		if funcs[name] == nil {
+			errs = append(errs, fmt.Errorf("partial set %s needs the function %q, which Functions doesn't have", set.Name, name))
+		}
+	}
+	ren.mu.RLock()
+	for _, used := range ren.partialSets {
+		if used.set.Namespace == set.Namespace {
+			errs = append(errs, fmt.Errorf("partial sets %s and %s both use the namespace %q", used.set.Name, set.Name, set.Namespace))
+		}
+	}
+	ren.mu.RUnlock()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	trees, err := ren.parsePartialSet(set, funcs)
+	if err != nil {
+		return fmt.Errorf("partial set %s: %w", set.Name, err)
+	}
+	ren.mu.Lock()
+	ren.partialSets = append(ren.partialSets, &usedPartialSet{set: set, trees: trees})
+	ren.mu.Unlock()
+	return nil
+}
+
+// parsePartialSet parses the files of set and returns its templates by their
+// name in the namespace, with the calls between them renamed to match.
+func (ren *Render) parsePartialSet(set PartialSet, funcs template.FuncMap) (map[string]*parse.Tree, error) {
+	var files []string
+	err := fs.WalkDir(set.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && ren.isTemplateFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	tmpl := template.New(set.Namespace).Funcs(funcs)
+	for _, file := range files {
+		src, err := fs.ReadFile(set.FS, file)
+		if err != nil {
+			return nil, err
+		}
+		src, _, err = ren.transformSource(set.Name+":"+file, src)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.Lookup(path.Base(file)) != nil {
+			return nil, fmt.Errorf("two files named %s", path.Base(file))
+		}
+		if _, err := tmpl.New(path.Base(file)).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+
+	defined := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			defined[t.Name()] = true
+		}
+	}
+	trees := make(map[string]*parse.Tree, len(defined))
+	for name := range defined {
+		tree := tmpl.Lookup(name).Tree.Copy()
+		walkTree(tree.Root, func(n parse.Node) {
+			if call, ok := n.(*parse.TemplateNode); ok && defined[call.Name] {
+				call.Name = set.Namespace + "/" + call.Name
+			}
+		})
+		tree.Name = set.Namespace + "/" + name
+		trees[tree.Name] = tree
+	}
+	return trees, nil
+}
+
+// addPartialSets adds the templates of the partial sets in use to the set
+// tmpl of a page, as copies, since building a set changes its trees. A
+// template the page's own files already define is an error.
+func (ren *Render) addPartialSets(tmpl *template.Template) error {
+	ren.mu.RLock()
+	sets := ren.partialSets
+	ren.mu.RUnlock()
+	for _, used := range sets {
+		names := make([]string, 0, len(used.trees))
+		for name := range used.trees {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if tmpl.Lookup(name) != nil {
+				return fmt.Errorf("template %q of partial set %s is also defined by the page", name, used.set.Name)
+			}
+			if _, err := tmpl.AddParseTree(name, used.trees[name].Copy()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PreloadPages builds every page in the template directories whose name has
+// one of suffixes as a dotted part, as LoadLayoutsAndPartials matches file
+// types (".page" matches "checkout.page.tmpl"); without suffixes, every
+// page. It is meant for startup, after LoadLayoutsAndPartials, to fail at
+// boot instead of on the first request of a broken page: all pages are
+// built, and the errors of those that fail are returned together
+// (errors.Join), each naming its page and file. With UseCache the pages
+// that built are cached, so the cache is warm when nil is returned. With
+// Debug, the number of pages and the time taken are logged.
+func (ren *Render) PreloadPages(suffixes ...string) error {
+	start := time.Now()
+	pages, err := ren.pageNames()
+	if err != nil {
+		return err
+	}
+	if len(suffixes) > 0 {
+		var matching []string
+		for _, suffix := range suffixes {
+			matching = append(matching, addTemplate(pages, suffix)...)
+		}
+		pages = dedupe(nil, matching)
+	}
+
+	var errs []error
+	for _, t := range pages {
+		if _, err := ren.buildTemplateFromDisk(t); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t, err))
+		}
+	}
+	if ren.Debug {
+		log.Println("Preloaded", len(pages)-len(errs), "of", len(pages), "pages in", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
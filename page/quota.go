@@ -0,0 +1,130 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota limits what the templates of one tenant may cost; see RenderTenant.
+// A zero field means no limit.
+type Quota struct {
+	MaxDuration   time.Duration // Wall time of one render.
+	MaxOutput     int64         // Bytes one render may write; a proxy for range iterations over big payloads.
+	MaxConcurrent int           // Renders of the tenant running at the same time.
+}
+
+// QuotaError is returned by RenderTenant when a render exceeds a quota.
+type QuotaError struct {
+	Tenant string // The tenant, as passed to RenderTenant.
+	Quota  string // "duration", "output" or "concurrency".
+	Limit  any    // The limit that was exceeded, e.g. 500ms.
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s exceeded its %s quota (%v)", e.Tenant, e.Quota, e.Limit)
+}
+
+// quotaSlots holds the concurrency semaphores of the tenants.
+type quotaSlots struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// acquire takes a render slot of tenant, or returns false when all n are in
+// use. release must be called when the render is done.
+func (q *quotaSlots) acquire(tenant string, n int) (release func(), ok bool) {
+	q.mu.Lock()
+	if q.slots == nil {
+		q.slots = make(map[string]chan struct{})
+	}
+	slots := q.slots[tenant]
+	if cap(slots) != n {
+		slots = make(chan struct{}, n)
+		q.slots[tenant] = slots
+	}
+	q.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// quotaWriter collects the output of a render and fails the render as soon
+// as it passes its deadline or its maximum size. The template package stops
+// executing at the first failed write.
+type quotaWriter struct {
+	bytes.Buffer
+	tenant   string
+	quota    Quota
+	deadline time.Time
+	err      *QuotaError
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	switch {
+	case w.quota.MaxDuration > 0 && time.Now().After(w.deadline):
+		w.err = &QuotaError{Tenant: w.tenant, Quota: "duration", Limit: w.quota.MaxDuration}
+	case w.quota.MaxOutput > 0 && int64(w.Len()+len(p)) > w.quota.MaxOutput:
+		w.err = &QuotaError{Tenant: w.tenant, Quota: "output", Limit: w.quota.MaxOutput}
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+// RenderTenant is Render for templates authored by tenant, within the quota
+// Quotas[tenant]. A render exceeding it fails with a *QuotaError naming the
+// tenant and the quota; a render over the concurrency quota fails at once.
+//
+// The duration and output quotas are checked whenever the template writes
+// output, so a template looping without writing anything is only stopped at
+// its next write.
+func (ren *Render) RenderTenant(tenant, t string, td any) (Result, error) {
+	t, err := ren.pageName(t)
+	if err != nil {
+		return Result{}, err
+	}
+	start := time.Now()
+	ren.mu.RLock()
+	quota := ren.Quotas[tenant]
+	ren.mu.RUnlock()
+
+	if quota.MaxConcurrent > 0 {
+		release, ok := ren.quotaSlots.acquire(tenant, quota.MaxConcurrent)
+		if !ok {
+			return Result{}, &QuotaError{Tenant: tenant, Quota: "concurrency", Limit: quota.MaxConcurrent}
+		}
+		defer release()
+	}
+
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		return Result{}, err
+	}
+	keys := ren.newSurrogateKeys(t)
+	if keyed := ren.surrogateTemplate(tmpl, t, keys); keyed != nil {
+		tmpl = keyed
+	}
+	w := &quotaWriter{tenant: tenant, quota: quota, deadline: start.Add(quota.MaxDuration)}
+	if err := tmpl.ExecuteTemplate(w, t, td); err != nil {
+		if w.err != nil {
+			return Result{}, w.err
+		}
+		return Result{}, ren.compatError(renderError(t, ren.sources(t), err))
+	}
+	ren.noteDeprecated(t)
+	return Result{
+		Body:        ren.postProcess(tmpl, w.Bytes()),
+		ContentType: ren.contentType(),
+		Fingerprint: ren.fingerprint(t),
+		Duration:    time.Since(start),
+
+		SurrogateKeys: keys.list(),
+	}, nil
+}
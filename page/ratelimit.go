@@ -0,0 +1,228 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is the error of ShowRequest for a page over its Limit,
+// wrapped with the page name; test for it with errors.Is. StatusFor maps it
+// to 429.
+var ErrRateLimited = errors.New("rate limited")
+
+// LimitStats counts the requests of one page that hit its Limit, as reported
+// in Stats.Limited.
+type LimitStats struct {
+	Waited   int64 // Requests that waited for a slot or their turn, and got it.
+	Rejected int64 // Requests turned away with ErrRateLimited.
+}
+
+// StatusFor returns the HTTP status a handler should answer with for err
+// returned by ShowRequest: 429 for ErrRateLimited, 500 for other errors and
+// 200 for nil.
+func StatusFor(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// pageLimit is the Limit of one page: a semaphore of maxConcurrent slots
+// and a token bucket refilled with perSecond tokens a second, holding at
+// most one second worth of them.
+type pageLimit struct {
+	slots     chan struct{} // nil without a concurrency limit.
+	perSecond float64       // 0 without a rate limit.
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// pageLimits holds the limits of the pages and their counts. Counts outlive
+// changes of a limit.
+type pageLimits struct {
+	mu     sync.Mutex
+	limits map[string]*pageLimit
+	counts map[string]*LimitStats
+}
+
+// Limit limits the ShowRequest renders of the page name to maxConcurrent at
+// a time and maxPerSecond a second (bursts of up to one second worth). A 0
+// leaves that side unlimited; Limit(name, 0, 0) removes the limit of name.
+// Requests over the limit wait up to LimitWait for their turn, or until
+// their context is done, and are rejected with ErrRateLimited otherwise.
+// Limit may be called at any time, e.g. during an incident; requests already
+// admitted are not affected. Other pages are never limited by it. name may
+// be a short name like "home", as for ShowRequest; a name matching no page
+// is kept as it is, so it limits a page of that exact name added later.
+func (ren *Render) Limit(name string, maxConcurrent int, maxPerSecond float64) {
+	if resolved, err := ren.pageName(name); err == nil {
+		name = resolved
+	}
+	ren.limits.mu.Lock()
+	defer ren.limits.mu.Unlock()
+	if maxConcurrent <= 0 && maxPerSecond <= 0 {
+		delete(ren.limits.limits, name)
+		return
+	}
+	if ren.limits.limits == nil {
+		ren.limits.limits = make(map[string]*pageLimit)
+	}
+	ren.limits.limits[name] = newPageLimit(maxConcurrent, maxPerSecond)
+}
+
+// newPageLimit returns a pageLimit with all its slots free and a full token
+// bucket.
+func newPageLimit(maxConcurrent int, maxPerSecond float64) *pageLimit {
+	l := &pageLimit{perSecond: max(maxPerSecond, 0), last: time.Now()}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	l.tokens = l.burst()
+	return l
+}
+
+// copyTo gives dst the limits of ls, as newly set: the slots, tokens and
+// counts of ls are not shared or copied.
+func (ls *pageLimits) copyTo(dst *pageLimits) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(ls.limits) == 0 {
+		return
+	}
+	dst.limits = make(map[string]*pageLimit, len(ls.limits))
+	for name, l := range ls.limits {
+		dst.limits[name] = newPageLimit(cap(l.slots), l.perSecond)
+	}
+}
+
+// burst is the size of the token bucket: one second worth of tokens, and at
+// least one.
+func (l *pageLimit) burst() float64 {
+	return math.Max(1, l.perSecond)
+}
+
+// reserve takes a token and returns how long to wait before it may be used.
+func (l *pageLimit) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.burst(), l.tokens+now.Sub(l.last).Seconds()*l.perSecond)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.perSecond * float64(time.Second))
+}
+
+// unreserve gives back a token reserve took for a request that didn't wait
+// for it.
+func (l *pageLimit) unreserve() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// admit waits for the turn of a request of the page t under its Limit. It
+// returns the function to call when the render is done, or an error
+// wrapping ErrRateLimited.
+func (ren *Render) admit(ctx context.Context, t string) (release func(), err error) {
+	ren.limits.mu.Lock()
+	l := ren.limits.limits[t]
+	ren.limits.mu.Unlock()
+	if l == nil {
+		return func() {}, nil
+	}
+
+	deadline := time.Now().Add(ren.LimitWait)
+	waited := false
+	if l.perSecond > 0 {
+		wait := l.reserve(time.Now())
+		if wait > 0 {
+			if time.Now().Add(wait).After(deadline) {
+				l.unreserve()
+				return nil, ren.rejected(t)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				waited = true
+			case <-ctx.Done():
+				timer.Stop()
+				l.unreserve()
+				return nil, ren.rejected(t)
+			}
+		}
+	}
+	release = func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			select {
+			case l.slots <- struct{}{}:
+				waited = true
+			case <-timer.C:
+				return nil, ren.rejected(t)
+			case <-ctx.Done():
+				return nil, ren.rejected(t)
+			}
+		}
+		release = func() { <-l.slots }
+	}
+	if waited {
+		ren.limits.record(t, true)
+	}
+	return release, nil
+}
+
+// rejected counts a rejected request of t and returns its error.
+func (ren *Render) rejected(t string) error {
+	ren.limits.record(t, false)
+	return fmt.Errorf("%s: %w", t, ErrRateLimited)
+}
+
+// record counts a request of t that waited, or was rejected.
+func (p *pageLimits) record(t string, waited bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.counts == nil {
+		p.counts = make(map[string]*LimitStats)
+	}
+	c := p.counts[t]
+	if c == nil {
+		c = &LimitStats{}
+		p.counts[t] = c
+	}
+	if waited {
+		c.Waited++
+	} else {
+		c.Rejected++
+	}
+}
+
+// snapshot returns a copy of the counts, or nil when no request hit a limit.
+func (p *pageLimits) snapshot() map[string]LimitStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.counts) == 0 {
+		return nil
+	}
+	counts := make(map[string]LimitStats, len(p.counts))
+	for t, c := range p.counts {
+		counts[t] = *c
+	}
+	return counts
+}
@@ -0,0 +1,34 @@
+package page
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A limit set by short name throttles the renders of the page, whichever
+// name they use.
+func TestLimitShortName(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{"home.page.tmpl": `home`}))
+	ren.Limit("home", 0, 1)
+	show := func(name string) error {
+		return ren.ShowRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), name, nil)
+	}
+
+	if err := show("home"); err != nil {
+		t.Fatal(err)
+	}
+	// The bucket holds one second worth, one render, and LimitWait is 0.
+	if err := show("home.page.tmpl"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second render: %v, want ErrRateLimited", err)
+	}
+	if got := ren.Stats().Limited["home.page.tmpl"].Rejected; got != 1 {
+		t.Errorf("Rejected = %d, want 1", got)
+	}
+
+	ren.Limit("home", 0, 0)
+	if err := show("home"); err != nil {
+		t.Errorf("after removing the limit: %v", err)
+	}
+}
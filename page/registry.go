@@ -0,0 +1,307 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sourceRegistration is a call of RegisterSource.
+type sourceRegistration struct {
+	name   string
+	fsys   fs.FS
+	prefix string
+}
+
+// registeredSources are the sources registered with RegisterSource, in the
+// order of the calls. They are read under registryLock.
+var registeredSources []sourceRegistration
+
+// registryLock guards registeredSources, which all Renders share.
+var registryLock sync.Mutex
+
+// RegisterSource registers the templates in fsys as the source name, for
+// every Render. It is meant to be called from the init function of a feature
+// package that embeds its own templates:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	func init() {
+//		sub, _ := fs.Sub(templates, "templates")
+//		page.RegisterSource("billing", sub, "billing")
+//	}
+//
+// Start merges the registered sources into the Render; see mergeSources.
+// Every template file in fsys (.tmpl or .gohtml) whose name contains ".page."
+// becomes a page named after its path below prefix, e.g.
+// "billing/invoice.page.gohtml"; the other files are partials of the pages of
+// this source, parsed with the partials of the Render. Environment variants
+// are not resolved for sources.
+//
+// The order of the calls doesn't matter. Registering a name twice, and two
+// sources with a page of the same name, make Start fail with an error naming
+// both.
+func RegisterSource(name string, fsys fs.FS, prefix string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registeredSources = append(registeredSources, sourceRegistration{name: name, fsys: fsys, prefix: prefix})
+}
+
+// mergedSource is a registered source with the template files found in it.
+type mergedSource struct {
+	sourceRegistration
+	pages    []string // Page files in fsys.
+	partials []string // Other template files in fsys.
+}
+
+// sourcePage is a page of a merged source.
+type sourcePage struct {
+	source *mergedSource
+	file   string // The page file in the FS of source.
+}
+
+// mergeSources reads the sources registered with RegisterSource into ren,
+// replacing those merged before, and drops the cached sets of their pages.
+// Sources are merged in the order of their names, so the result and the
+// errors don't depend on the order of the registrations. Nothing is merged
+// when there is an error; all duplicates are reported at once.
+func (ren *Render) mergeSources() error {
+	registryLock.Lock()
+	regs := append([]sourceRegistration(nil), registeredSources...)
+	registryLock.Unlock()
+	sort.SliceStable(regs, func(i, j int) bool { return regs[i].name < regs[j].name })
+
+	var errs []error
+	registry := make(map[string]*mergedSource, len(regs))
+	pages := make(map[string]sourcePage)
+	for i, reg := range regs {
+		if i > 0 && regs[i-1].name == reg.name {
+			if i < 2 || regs[i-2].name != reg.name {
+				errs = append(errs, fmt.Errorf("source %q registered more than once", reg.name))
+			}
+			continue
+		}
+		ms, err := scanSource(reg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		registry[reg.name] = ms
+		errs = append(errs, ren.addSourcePages(pages, ms)...)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	for name := range ren.sourcePages {
+		delete(ren.cache, name)
+	}
+	for name := range pages {
+		delete(ren.cache, name)
+	}
+	ren.snapshot.Store(nil)
+	ren.registry, ren.sourcePages = registry, pages
+	return nil
+}
+
+// ReloadSource reads the source name again and drops the cached sets of its
+// pages; the other sources and their cached pages are left alone. Use it
+// with sources on disk (os.DirFS): an embedded FS never changes.
+func (ren *Render) ReloadSource(name string) error {
+	ren.mu.RLock()
+	old := ren.registry[name]
+	pages := make(map[string]sourcePage, len(ren.sourcePages))
+	for page, sp := range ren.sourcePages {
+		if sp.source.name != name {
+			pages[page] = sp
+		}
+	}
+	ren.mu.RUnlock()
+	if old == nil {
+		return fmt.Errorf("no source %q merged", name)
+	}
+
+	ms, err := scanSource(old.sourceRegistration)
+	if err != nil {
+		return err
+	}
+	if errs := ren.addSourcePages(pages, ms); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	affected := make(map[string]bool)
+	for page, sp := range ren.sourcePages {
+		if sp.source.name == name {
+			delete(ren.cache, page)
+			affected[page] = true
+		}
+	}
+	for page, sp := range pages {
+		if sp.source == ms {
+			delete(ren.cache, page)
+			affected[page] = true
+		}
+	}
+	ren.snapshot.Store(nil)
+	ren.registry[name], ren.sourcePages = ms, pages
+	names := make([]string, 0, len(affected))
+	for page := range affected {
+		names = append(names, page)
+	}
+	sort.Strings(names)
+	ren.publish(TemplateEvent{Type: TemplateReloaded, Path: name, Pages: names})
+	return nil
+}
+
+// scanSource lists the template files of reg.
+func scanSource(reg sourceRegistration) (*mergedSource, error) {
+	ms := &mergedSource{sourceRegistration: reg}
+	err := fs.WalkDir(reg.fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (path.Ext(file) != ".tmpl" && path.Ext(file) != ".gohtml") {
+			return nil
+		}
+		if strings.Contains(path.Base(file), ".page.") {
+			ms.pages = append(ms.pages, file)
+		} else {
+			ms.partials = append(ms.partials, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("source %q: %w", reg.name, err)
+	}
+	return ms, nil
+}
+
+// addSourcePages adds the pages of ms to pages, returning an error for every
+// page name already taken by another source or by a page in TemplateDir.
+func (ren *Render) addSourcePages(pages map[string]sourcePage, ms *mergedSource) []error {
+	var errs []error
+	for _, file := range ms.pages {
+		name := path.Join(ms.prefix, file)
+		if other, taken := pages[name]; taken {
+			errs = append(errs, fmt.Errorf("page %q is in sources %q and %q", name, other.source.name, ms.name))
+			continue
+		}
+		if file := ren.lookupTemplate(filepath.FromSlash(name)); ren.templateExists(file) {
+			errs = append(errs, fmt.Errorf("page %q of source %q is also in %s", name, ms.name, file))
+			continue
+		}
+		pages[name] = sourcePage{source: ms, file: file}
+	}
+	return errs
+}
+
+// sourcePage returns the source page named t, if t is one.
+func (ren *Render) sourcePage(t string) (sourcePage, bool) {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	sp, ok := ren.sourcePages[t]
+	return sp, ok
+}
+
+// sourcePageNames returns the names of the pages of the merged sources, sorted.
+func (ren *Render) sourcePageNames() []string {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	names := make([]string, 0, len(ren.sourcePages))
+	for name := range ren.sourcePages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseSourceSet is parseSet for the source page t: partialFiles from disk,
+// then the partials of its source and the page itself from the source's FS.
+// Files of the source show up in errors as "source:file"; fresh is that of
+// partialSet.
+func (ren *Render) parseSourceSet(t string, sp sourcePage, partialFiles []string, fresh bool) (builtSet, error) {
+	ms := sp.source
+	sources := ren.newSourceMap(t, ms.name+":"+sp.file, partialFiles)
+	tmpl, stringPartials, base, err := ren.partialSet(t, partialFiles, sources, fresh)
+	if err != nil {
+		return builtSet{}, err
+	}
+	for _, p := range ms.partials {
+		src, err := fs.ReadFile(ms.fsys, p)
+		if err != nil {
+			return builtSet{}, err
+		}
+		src, offset, err := ren.transformSource(ms.name+":"+p, src)
+		if err != nil {
+			return builtSet{}, err
+		}
+		sources[path.Base(p)] = sourceFile{Path: ms.name + ":" + p, LineOffset: offset}
+		if _, err := tmpl.New(path.Base(p)).Parse(string(src)); err != nil {
+			return builtSet{}, renderError(t, sources, err)
+		}
+	}
+
+	src, err := fs.ReadFile(ms.fsys, sp.file)
+	if err != nil {
+		return builtSet{}, err
+	}
+	body, skipped, err := ren.transformSource(ms.name+":"+sp.file, src)
+	if err != nil {
+		return builtSet{}, err
+	}
+	sources[t] = sourceFile{Path: ms.name + ":" + sp.file, LineOffset: skipped}
+	if _, err := tmpl.Parse(string(body)); err != nil {
+		return builtSet{}, renderError(t, sources, err)
+	}
+	if err := ren.addPartialSets(tmpl); err != nil {
+		return builtSet{}, err
+	}
+
+	onDisk, err := ren.fingerprintAfter(base, partialFiles)
+	if err != nil {
+		return builtSet{}, err
+	}
+	fingerprint, err := ren.fingerprintSource(onDisk, ms, sp.file)
+	if err != nil {
+		return builtSet{}, err
+	}
+	set, err := ren.finishSet(tmpl, sources, fingerprintStrings(fingerprint, stringPartials), partialFiles)
+	// The files of the source follow those on disk, for OnBuild.
+	set.files = append([]string(nil), partialFiles...)
+	for _, p := range ms.partials {
+		set.files = append(set.files, ms.name+":"+p)
+	}
+	set.files = append(set.files, ms.name+":"+sp.file)
+	return set, err
+}
+
+// fingerprintSource is fingerprintFiles for a source page: the partial files
+// on disk, then the files of the source.
+func (ren *Render) fingerprintSource(onDisk string, ms *mergedSource, page string) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, onDisk)
+	for _, file := range append(append([]string(nil), ms.partials...), page) {
+		src, err := fs.ReadFile(ms.fsys, file)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+		io.WriteString(h, ms.name+":"+file)
+		h.Write([]byte{0})
+		h.Write(src)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
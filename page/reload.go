@@ -0,0 +1,140 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"sort"
+)
+
+// Reload scans the template directories for the layouts and partials of
+// fileTypes again, as LoadLayoutsAndPartials does at startup, so partial
+// files added, removed or edited since are used: the Partials list is
+// replaced in one step and the template cache is cleared, so every page is
+// built again with the new list on its next render. It is safe to call while
+// pages are rendered; renders running at the time finish with the sets they
+// started with, and sets built from the old list are not cached. When the
+// scan fails, the old list stays in effect and the cache is kept. See
+// WarmReload to rebuild the pages before the swap instead.
+func (ren *Render) Reload(fileTypes []string) error {
+	return ren.LoadLayoutsAndPartials(fileTypes)
+}
+
+// WarmReloadOptions configures WarmReload.
+type WarmReloadOptions struct {
+	// Layout and partial types to rescan, as for LoadLayoutsAndPartials.
+	FileTypes []string
+	// Pages to build before the swap, e.g. the most requested ones; nil means
+	// every page in TemplateDir. Other pages are built on their first render.
+	Pages []string
+	// Called after every page is built, with the number built so far and the
+	// number to build. Deploy tooling can use it to wait for readiness.
+	Progress func(warmed, total int)
+}
+
+// WarmReload rescans the layouts and partials and rebuilds the template cache
+// without a cold start: the new sets are built in the background of the
+// current ones, which keep serving every render meanwhile, and replace them
+// in one swap once all are built. The old sets are then released.
+// When a page fails to build, the current cache is kept and the errors are
+// returned. The progress is also in Stats (ReloadWarmed, ReloadTotal).
+func (ren *Render) WarmReload(opts WarmReloadOptions) error {
+	partials, err := ren.discoverPartials(context.Background(), opts.FileTypes)
+	if err != nil {
+		return err
+	}
+	partials = dedupe(nil, partials)
+	// The partial files may have been edited under the same names.
+	ren.dropBase()
+
+	pages := opts.Pages
+	if pages == nil {
+		if pages, err = ren.pageNamesFor(partials); err != nil {
+			return err
+		}
+	}
+
+	ren.stats.reloadTotal.Store(int64(len(pages)))
+	ren.stats.reloadWarmed.Store(0)
+	sets := make(map[string]builtSet, len(pages))
+	var errs []error
+	for i, t := range pages {
+		set, err := ren.parseSet(t, partials)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sets[t] = set
+		ren.stats.reloadWarmed.Store(int64(i + 1))
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(pages))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	ren.mu.Lock()
+	oldPartials, oldFingerprints, cached := ren.Partials, ren.fingerprints, ren.cachedPagesLocked()
+	ren.partialsMu.Lock()
+	ren.Partials = partials
+	ren.partialsMu.Unlock()
+	ren.cache = make(map[string]*template.Template, len(sets))
+	ren.snapshot.Store(nil)
+	// Builds started before the swap read the old partials; they must not
+	// store their sets over the new ones.
+	ren.cacheGen++
+	ren.fingerprints = nil
+	ren.modTimes = nil
+	ren.partialsKeys = nil
+	ren.sourceMaps = nil
+	ren.protos = nil
+	ren.site = nil
+	ren.pageAliases = nil
+	ren.calls = nil
+	ren.keyed = nil
+	ren.deprecatedUses = nil
+	for t, set := range sets {
+		ren.storeSetLocked(t, set)
+	}
+	ren.publish(reloadEvents(oldPartials, partials, cached, oldFingerprints, sets)...)
+	ren.mu.Unlock()
+	ren.notifyEvicted()
+
+	if ren.Debug {
+		log.Println("Reloaded", len(sets), "templates")
+	}
+	return nil
+}
+
+// reloadEvents returns the events of a WarmReload replacing the cached pages
+// cached, with the fingerprints old, by sets, and the partials oldPartials by
+// partials.
+func reloadEvents(oldPartials, partials, cached []string, old map[string]string, sets map[string]builtSet) []TemplateEvent {
+	pages := make([]string, 0, len(sets))
+	for t := range sets {
+		pages = append(pages, t)
+	}
+	sort.Strings(pages)
+	evs := fileEvents(oldPartials, partials, pages)
+	for _, t := range pages {
+		fingerprint, ok := old[t]
+		switch {
+		case !ok:
+			evs = append(evs, TemplateEvent{Type: TemplateAdded, Path: t, Pages: []string{t}, Fingerprint: sets[t].fingerprint})
+		case fingerprint != sets[t].fingerprint:
+			evs = append(evs, TemplateEvent{Type: TemplateChanged, Path: t, Pages: []string{t}, Fingerprint: sets[t].fingerprint})
+		}
+	}
+	var dropped []string
+	for _, t := range cached {
+		if _, ok := sets[t]; !ok {
+			dropped = append(dropped, t)
+		}
+	}
+	if len(dropped) > 0 {
+		evs = append(evs, TemplateEvent{Type: TemplateInvalidated, Pages: dropped})
+	}
+	return append(evs, TemplateEvent{Type: TemplateReloaded, Pages: pages})
+}
@@ -0,0 +1,85 @@
+package page
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A page build that started before a WarmReload swapped in new partials
+// must not store its set, built from the old partials, over the new one.
+func TestWarmReloadDuringBuild(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}{{template "footer" .}}{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}old{{end}}`,
+		"home.page.tmpl":      `{{template "base" .}}`,
+	})
+	ren := newTestRender(t, dir)
+
+	// The transform of the page file runs after the build took its partials
+	// and before it stores the set: edit the partial and reload right then.
+	armed := true
+	ren.SourceTransforms = []SourceTransform{func(name string, src []byte) ([]byte, error) {
+		if armed && strings.HasSuffix(name, "home.page.tmpl") {
+			armed = false
+			if err := os.WriteFile(filepath.Join(dir, "footer.partial.tmpl"), []byte(`{{define "footer"}}new{{end}}`), 0o644); err != nil {
+				return nil, err
+			}
+			if err := ren.WarmReload(WarmReloadOptions{FileTypes: []string{".layout", ".partial"}}); err != nil {
+				return nil, err
+			}
+		}
+		return src, nil
+	}}
+
+	// The render that overlapped the reload still gets the set it built.
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "old" {
+		t.Fatalf("overlapping render: got %q, %v", got, err)
+	}
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "new" {
+		t.Errorf("after the reload: got %q, %v; want the set of WarmReload", got, err)
+	}
+}
+
+// A partial file added after startup is used by the pages rendered after
+// Reload, the cached ones included; a failed rescan keeps the old partials.
+func TestReloadAddedPartial(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"base.layout.tmpl": `{{define "base"}}[{{block "footer" .}}no footer{{end}}]{{end}}`,
+		"home.page.tmpl":   `{{template "base" .}}`,
+	})
+	ren := newTestRender(t, dir)
+	ren.UseCache = true
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[no footer]" {
+		t.Fatalf("before the partial: got %q, %v", got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "footer.partial.tmpl"), []byte(`{{define "footer"}}footer{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Without a rescan, the cached page doesn't see the new file.
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[no footer]" {
+		t.Fatalf("before Reload: got %q, %v", got, err)
+	}
+	if err := ren.Reload([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[footer]" {
+		t.Errorf("after Reload: got %q, %v", got, err)
+	}
+
+	partials := ren.partials()
+	ren.TemplateDir = t.TempDir()
+	if err := ren.Reload([]string{".layout", ".partial"}); err == nil {
+		t.Fatal("Reload of an empty directory succeeded")
+	}
+	if got := ren.partials(); !reflect.DeepEqual(got, partials) {
+		t.Errorf("after a failed Reload, Partials = %q, want %q", got, partials)
+	}
+	ren.TemplateDir = dir
+	if got, err := ren.String("home.page.tmpl", nil); err != nil || got != "[footer]" {
+		t.Errorf("after a failed Reload: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,164 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxRemoteSize is the largest remote content accepted, in bytes.
+const maxRemoteSize = 4 << 20
+
+// RemoteSource is HTML served by another service, included in pages with
+// {{remote "name"}}; see RegisterRemote.
+type RemoteSource struct {
+	URL      string        // Where to GET the HTML.
+	Timeout  time.Duration // Longest a fetch may take; 0 means 2 seconds.
+	TTL      time.Duration // How long a copy is fresh; 0 means 5 minutes.
+	Fallback string        // Template file (relative to TemplateDir) rendered when there is no copy; "" renders nothing.
+	Client   *http.Client  // nil means http.DefaultClient.
+}
+
+// remoteEntry is a registered RemoteSource with its cached copy.
+type remoteEntry struct {
+	src RemoteSource
+
+	mu         sync.Mutex
+	body       template.HTML
+	fetched    time.Time // When body was fetched; zero when there is no copy.
+	refreshing bool
+
+	fallbackOnce sync.Once
+	fallback     *template.Template
+	fallbackErr  error
+}
+
+// RegisterRemote registers src as the remote content name. Pages include it
+// with {{remote "name"}}:
+//   - a fresh copy is served from memory
+//   - a stale copy is served as well, while it is refreshed in the background
+//   - without a copy (the first use, or when every fetch failed so far) it is
+//     fetched, waiting at most Timeout, and the Fallback template is rendered
+//     when that fails
+//
+// A page using it never waits longer than Timeout for the remote service.
+//
+// The HTML is included as is, without escaping: it is trusted because it is
+// configured here, so only register services you trust with your pages.
+// Copies are kept per Render and survive reloads and cache clears.
+func (ren *Render) RegisterRemote(name string, src RemoteSource) {
+	if src.Timeout <= 0 {
+		src.Timeout = 2 * time.Second
+	}
+	if src.TTL <= 0 {
+		src.TTL = 5 * time.Minute
+	}
+	if src.Client == nil {
+		src.Client = http.DefaultClient
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.remotes == nil {
+		ren.remotes = make(map[string]*remoteEntry)
+	}
+	ren.remotes[name] = &remoteEntry{src: src}
+}
+
+// remote is the {{remote "name"}} template function.
+func (ren *Render) remote(name string) (template.HTML, error) {
+	ren.mu.RLock()
+	e := ren.remotes[name]
+	ren.mu.RUnlock()
+	if e == nil {
+		return "", fmt.Errorf("remote: no remote source %q", name)
+	}
+
+	e.mu.Lock()
+	body, fetched := e.body, e.fetched
+	stale := !fetched.IsZero() && time.Since(fetched) > e.src.TTL
+	if stale && !e.refreshing {
+		e.refreshing = true
+		ren.life.background.Add(1)
+		go func() {
+			defer ren.life.background.Done()
+			ren.refreshRemote(name, e)
+		}()
+	}
+	e.mu.Unlock()
+
+	if !fetched.IsZero() {
+		return body, nil
+	}
+	if body, err := ren.refreshRemote(name, e); err == nil {
+		return body, nil
+	}
+	return ren.remoteFallback(e)
+}
+
+// refreshRemote fetches e and stores the copy. Failures are logged and leave
+// the current copy in place.
+func (ren *Render) refreshRemote(name string, e *remoteEntry) (template.HTML, error) {
+	body, err := fetchRemote(e.src)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.refreshing = false
+	if err != nil {
+		log.Println("remote", name, err)
+		return "", err
+	}
+	e.body, e.fetched = body, time.Now()
+	return body, nil
+}
+
+// fetchRemote GETs the content of src within its timeout.
+func fetchRemote(src RemoteSource) (template.HTML, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), src.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := src.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", src.URL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxRemoteSize {
+		return "", fmt.Errorf("GET %s: more than %d bytes", src.URL, maxRemoteSize)
+	}
+	return template.HTML(b), nil
+}
+
+// remoteFallback renders the Fallback template of e, parsed on first use.
+func (ren *Render) remoteFallback(e *remoteEntry) (template.HTML, error) {
+	if e.src.Fallback == "" {
+		return "", nil
+	}
+	e.fallbackOnce.Do(func() {
+		file := ren.lookupTemplate(e.src.Fallback)
+		e.fallback = template.New(filepath.Base(file)).Funcs(ren.templateFuncs())
+		e.fallbackErr = ren.parseFiles(e.fallback, nil, file)
+	})
+	if e.fallbackErr != nil {
+		return "", e.fallbackErr
+	}
+	var buf bytes.Buffer
+	if err := e.fallback.Execute(&buf, nil); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
@@ -0,0 +1,161 @@
+package page
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultContentType is the DefaultContentType used when it is "".
+const defaultContentType = "text/html; charset=utf-8"
+
+// contentType returns DefaultContentType or its default.
+func (ren *Render) contentType() string {
+	if ren.DefaultContentType != "" {
+		return ren.DefaultContentType
+	}
+	return defaultContentType
+}
+
+// setContentType sets the Content-Type of the rendered page on w, unless the
+// handler set one.
+func (ren *Render) setContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ren.contentType())
+	}
+}
+
+// renderFailed answers w for the request r (nil for Show) of a page that
+// failed to build or render with err, when anyone should: ErrorHandler, or
+// with ErrorResponses a 500 with the text text, if it isn't "" (failed
+// builds used to be answered by the caller). Otherwise nothing is written,
+// and the caller answers.
+func (ren *Render) renderFailed(w http.ResponseWriter, r *http.Request, err error, text string) {
+	switch {
+	case ren.ErrorHandler != nil:
+		ren.ErrorHandler(w, r, err)
+	case ren.Behavior&ErrorResponses != 0 && text != "":
+		http.Error(w, text, http.StatusInternalServerError)
+	}
+}
+
+// setContentLength sets the Content-Length of a buffered page of n bytes on
+// w, so proxies can cache it and small pages aren't sent chunked. It is left
+// out when the handler set a Transfer-Encoding, a Content-Length of its own,
+// or a Content-Encoding: a compressing writer wrapping w changes the length.
+func setContentLength(w http.ResponseWriter, n int) {
+	h := w.Header()
+	if h.Get("Transfer-Encoding") != "" || h.Get("Content-Length") != "" || h.Get("Content-Encoding") != "" {
+		return
+	}
+	h.Set("Content-Length", strconv.Itoa(n))
+}
+
+// addHeaders adds the headers of header to w, except those the handler set
+// already, which keep the handler's values.
+func addHeaders(w http.ResponseWriter, header http.Header) {
+	for name, values := range header {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := w.Header()[name]; ok {
+			continue
+		}
+		w.Header()[name] = append([]string(nil), values...)
+	}
+}
+
+// Result is a rendered page, as returned by Render.
+type Result struct {
+	Body        []byte        // The rendered output. It is a copy owned by the caller.
+	ContentType string        // Content-Type of Body, e.g. "text/html; charset=utf-8".
+	Fingerprint string        // Fingerprint of the template files Body was rendered from.
+	Duration    time.Duration // Time spent building (or fetching) the set and executing it.
+
+	// Surrogate keys of the page, sorted: those of SurrogateKeys for the page
+	// and the templates it calls, and those added with {{surrogateKey}}.
+	SurrogateKeys []string
+}
+
+// Render renders the template t with td and returns the result without
+// writing it anywhere. It is what Show and String are built on, and is meant
+// for non-HTTP uses (message queues, HTML snippets in RPC responses) and for
+// tests that want to look at the whole result.
+func (ren *Render) Render(t string, td any) (result Result, err error) {
+	t, err = ren.pageName(t)
+	if err != nil {
+		return Result{}, err
+	}
+	if ren.Metrics != nil {
+		defer ren.observeRender(t, time.Now(), &err)
+	}
+	start := time.Now()
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		return Result{}, err
+	}
+	return ren.renderTemplate(tmpl, t, td, start)
+}
+
+// renderTemplate executes the template t of the set tmpl, applies the
+// post-processing and fills in a Result. start is when rendering began.
+// An execution error is returned as a *RenderError. Renders of pages in
+// Coalesce share an execution; see coalesced.
+func (ren *Render) renderTemplate(tmpl *template.Template, t string, td any, start time.Time) (Result, error) {
+	if key, ok := ren.coalesceKeyFor(tmpl, t, td); ok {
+		return ren.coalesced(key, t, start, func() (Result, error) {
+			return ren.executeResult(tmpl, t, td, start)
+		})
+	}
+	return ren.executeResult(tmpl, t, td, start)
+}
+
+// executeResult is renderTemplate for a render executed on its own.
+func (ren *Render) executeResult(tmpl *template.Template, t string, td any, start time.Time) (Result, error) {
+	if traced := ren.traceTemplate(tmpl, t); traced != nil {
+		tmpl = traced
+	}
+	keys := ren.newSurrogateKeys(t)
+	if keyed := ren.surrogateTemplate(tmpl, t, keys); keyed != nil {
+		tmpl = keyed
+	}
+	body, err := ren.execute(tmpl, t, td)
+	if err != nil {
+		ren.captureFailure(t, td, err)
+		return Result{}, ren.compatError(renderError(t, ren.sources(t), err))
+	}
+	ren.noteDeprecated(t)
+	return Result{
+		Body:        body,
+		ContentType: ren.contentType(),
+		Fingerprint: ren.fingerprint(t),
+		Duration:    time.Since(start),
+
+		SurrogateKeys: keys.list(),
+	}, nil
+}
+
+// execute runs the template name of the set tmpl with td into a buffer and
+// returns the post-processed output. The buffer comes from a pool and is
+// sized after the previous output of name; the output is a copy.
+// With MaxRenderBytes set, a render writing more fails with a
+// *RenderSizeError as soon as it crosses the limit.
+func (ren *Render) execute(tmpl *template.Template, name string, td any) ([]byte, error) {
+	buf := ren.getBuffer(name)
+	defer ren.putBuffer(name, buf)
+	if ren.MaxRenderBytes > 0 {
+		w := &limitWriter{Buffer: buf, name: name, limit: ren.MaxRenderBytes}
+		if err := tmpl.ExecuteTemplate(w, name, td); err != nil {
+			if w.err != nil {
+				ren.memory.record(name, buf.Cap(), 0, true)
+				return nil, w.err
+			}
+			return nil, err
+		}
+	} else if err := tmpl.ExecuteTemplate(buf, name, td); err != nil {
+		return nil, err
+	}
+	out := bytes.Clone(ren.postProcess(tmpl, buf.Bytes()))
+	ren.memory.record(name, buf.Cap(), len(out), false)
+	return out, nil
+}
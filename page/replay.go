@@ -0,0 +1,90 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// replayVersion is the version of the Artifact format written by this
+// package. Replay reads every version up to it.
+const replayVersion = 1
+
+// Artifact is a failed render captured for Replay; see CaptureFailures.
+// It is stored as JSON; Version lets later versions of this package keep
+// reading old captures.
+type Artifact struct {
+	Version           int             `json:"version"`
+	Template          string          `json:"template"`
+	Data              json.RawMessage `json:"data"`               // The template data, after Redact.
+	ConfigFingerprint string          `json:"config_fingerprint"` // See configFingerprint.
+	Error             string          `json:"error"`
+	Time              time.Time       `json:"time"`
+}
+
+// captureFailure builds an Artifact for the failed render of t with td and
+// hands it to CaptureFailures. Nothing is captured without Redact.
+func (ren *Render) captureFailure(t string, td any, renderErr error) {
+	if ren.CaptureFailures == nil || ren.Redact == nil {
+		return
+	}
+	redacted, err := ren.Redact(td)
+	if err != nil {
+		log.Println("not capturing failed render of", t, "- redact:", err)
+		return
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		log.Println("not capturing failed render of", t, "-", err)
+		return
+	}
+	ren.CaptureFailures(Artifact{
+		Version:           replayVersion,
+		Template:          t,
+		Data:              data,
+		ConfigFingerprint: ren.configFingerprint(t),
+		Error:             renderErr.Error(),
+		Time:              time.Now(),
+	})
+}
+
+// configFingerprint identifies what the output of t depends on besides its
+// data: the template files and the Environment and Locale.
+func (ren *Render) configFingerprint(t string) string {
+	sum := sha256.Sum256([]byte(ren.fingerprint(t) + "\x00" + ren.Environment + "\x00" + ren.Locale))
+	return hex.EncodeToString(sum[:])
+}
+
+// Replay renders the captured artifact (its JSON) again with ren and returns
+// the output, or the error the render fails with.
+//
+// The data is decoded from JSON, so it reaches the template as maps, slices
+// and plain values: field access ({{.Data.Title}}) works as before, but
+// methods of the original types are gone. When the templates or the
+// configuration differ from those of the capture, this is logged; the
+// page is rendered anyway. Replay on a Render with CaptureFailures set
+// captures the failure again, so replay on a local Render without it.
+func (ren *Render) Replay(artifact []byte) (string, error) {
+	var a Artifact
+	if err := json.Unmarshal(artifact, &a); err != nil {
+		return "", err
+	}
+	if a.Version < 1 || a.Version > replayVersion {
+		return "", fmt.Errorf("replay: unsupported artifact version %d", a.Version)
+	}
+	var td any
+	if len(a.Data) > 0 {
+		if err := json.Unmarshal(a.Data, &td); err != nil {
+			return "", err
+		}
+	}
+
+	// The fingerprint is only known once t is built.
+	if _, err := ren.buildTemplate(a.Template); err == nil && ren.configFingerprint(a.Template) != a.ConfigFingerprint {
+		log.Println("replay:", a.Template, "was captured with other templates or configuration")
+	}
+	return ren.String(a.Template, td)
+}
@@ -0,0 +1,139 @@
+package page
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ShowRequest is Show for handlers that have the *http.Request at hand.
+//
+// Templates rendered by ShowRequest may set the response status and headers
+// themselves, e.g. a removed page can say {{status 410}} and a page can add
+// {{header "X-Robots-Tag" "noindex"}}. Only the headers in TemplateHeaders
+// may be set; a header the handler already set keeps the handler's value.
+// The page is rendered completely before the status, headers and body are
+// written together, with the Content-Length of the page unless it is
+// encoded. Show, String and Render ignore these functions.
+//
+// With EnableCompression set, the page is encoded with the encoding of
+// Encoders (gzip by default) the Accept-Encoding of r prefers, when it has at
+// least CompressMinSize bytes and neither NeverCompress, a CSRF token in td
+// nor WithCompression forbid it. The response then varies on
+// Accept-Encoding.
+//
+// Pages switched off with Disable are answered with their fallback and 503.
+// Pages in Audit are recorded after they rendered, before they are written.
+// Pages with a Limit wait for their turn or fail with ErrRateLimited.
+//
+// With ThemeResolver set, {{theme}} is its theme for r, and with ThemeClass
+// the theme is added as a class to <html> of pages not using {{theme}}.
+//
+// Pages in DiskCachePages are served from the disk cache in DiskCacheDir
+// instead, unless td carries a CSRF token; see showFromDiskCache. Response hints don't apply to disk-cached pages; their
+// surrogate keys (see SurrogateKeys) are sent like those of other pages.
+//
+// Like Show, it writes nothing for a page that fails to build or render and
+// returns the error for the caller to answer; see StatusFor.
+//
+// With AllowCacheBypass, a request with the CacheBypassHeader is rendered
+// from files on disk, past both caches; see bypassSet.
+func (ren *Render) ShowRequest(w http.ResponseWriter, r *http.Request, t string, td any) (err error) {
+	t, err = ren.pageName(t)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		ren.renderFailed(w, r, err, "")
+		return err
+	}
+	if ren.Metrics != nil {
+		defer ren.observeRender(t, time.Now(), &err)
+	}
+	ren.setEnvironmentHeader(w)
+	if fallback, disabled := ren.disabledFallback(t); disabled {
+		return ren.showDisabled(w, fallback, td)
+	}
+	// Nothing is written for a page over its Limit: the caller answers
+	// ErrRateLimited, see StatusFor.
+	release, err := ren.admit(r.Context(), t)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error showing", err)
+		}
+		return err
+	}
+	defer release()
+	bypass := ren.bypassCache(r)
+	if ren.diskCached(t, td) && !bypass {
+		return ren.showFromDiskCache(w, r, t, td)
+	}
+
+	start := time.Now()
+	hints := ren.newResponseHints()
+	hints.theme = ren.theme(r)
+	var tmpl *template.Template
+	if bypass {
+		tmpl, err = ren.bypassSet(t, hints)
+	} else {
+		tmpl, err = ren.cachedRequestSet(t, hints)
+	}
+	if err != nil {
+		if ren.Debug {
+			log.Println("error building", err)
+		}
+		ren.renderFailed(w, r, err, "")
+		return err
+	}
+
+	result, err := ren.renderTemplate(tmpl, t, td, start)
+	if err != nil {
+		if ren.Debug {
+			log.Println("error executing", err)
+		}
+		ren.renderFailed(w, r, err, err.Error())
+		return err
+	}
+	if err := ren.audit(r, t, td); err != nil {
+		ren.renderFailed(w, r, err, http.StatusText(http.StatusInternalServerError))
+		return err
+	}
+	if ren.needsThemeClass(tmpl, hints.theme) {
+		result.Body = addHTMLClass(result.Body, hints.theme)
+	}
+	status := hints.apply(w)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", result.ContentType)
+	}
+	ren.setSurrogateKeys(w, result.SurrogateKeys)
+	if ren.EnableCompression {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	ren.setThemeHeaders(w)
+	if enc := ren.encoderFor(r, t, td, result.Body); enc != nil {
+		return writeEncoded(w, status, result.Body, enc)
+	}
+	setContentLength(w, len(result.Body))
+	w.WriteHeader(status)
+	_, err = w.Write(result.Body)
+	return err
+}
+
+// cachedRequestSet returns the set of the page t for ShowRequest, from the
+// cache. A set using {{status}} or {{header}} is executed as a copy with the
+// functions of hints bound; the cached set itself is never changed.
+func (ren *Render) cachedRequestSet(t string, hints *responseHints) (*template.Template, error) {
+	tmpl, err := ren.buildTemplate(t)
+	if err != nil {
+		return nil, err
+	}
+	hinted, err := ren.hintTemplate(t, hints)
+	if err != nil {
+		return nil, err
+	}
+	if hinted != nil {
+		return hinted, nil
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,242 @@
+package page
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaVersion is the version of the document ExportSchemas writes.
+const schemaVersion = 1
+
+// Schemas is the document written by ExportSchemas.
+type Schemas struct {
+	Version int                   `json:"version"`
+	Pages   map[string]PageSchema `json:"pages"`
+}
+
+// PageSchema describes the template data of one page.
+type PageSchema struct {
+	// "model" when Data is the type registered in Models, "usage" when it
+	// lists what the templates of the page read.
+	Source string            `json:"source"`
+	Data   Schema            `json:"data"`
+	Meta   map[string]string `json:"meta,omitempty"` // Front matter, see PageMeta.
+}
+
+// Schema describes a value of template data.
+//
+// Type is one of "object", "array", "map", "string", "integer", "number",
+// "boolean" or "any". Objects list their Fields sorted by name; arrays and
+// maps describe their elements in Items (map keys are strings in templates
+// and JSON alike). Pointers are described by what they point to. A
+// time.Time is a "string" with Format "date-time" (RFC 3339, as encoded by
+// encoding/json), a []byte a "string" with Format "base64". GoType names
+// named types, e.g. "time.Duration" for an "integer". A type containing
+// itself is described once; the inner occurrence is an object with
+// Recursive set and no fields.
+type Schema struct {
+	Type      string        `json:"type"`
+	GoType    string        `json:"goType,omitempty"`
+	Format    string        `json:"format,omitempty"`
+	Fields    []SchemaField `json:"fields,omitempty"`
+	Items     *Schema       `json:"items,omitempty"`
+	Recursive bool          `json:"recursive,omitempty"`
+}
+
+// SchemaField is a field of an object Schema. Name is the name templates use
+// ({{.Name}}); JSON is the name in the JSON encoding of the model, "-" when
+// it is left out, and empty for observed usage.
+type SchemaField struct {
+	Name string `json:"name"`
+	JSON string `json:"json,omitempty"`
+	Schema
+}
+
+// ExportSchemas writes a JSON document describing the template data of every
+// page, for documentation and front-end tooling: the structure of the type
+// registered for the page in Models, or else the fields the templates of the
+// page read (including those of the partials it calls), plus the front
+// matter of the page. The document is indented and sorted, so exports of the
+// same templates and models are identical and can be diffed.
+func (ren *Render) ExportSchemas(w io.Writer) error {
+	pages, err := ren.pageNames()
+	if err != nil {
+		return err
+	}
+	pages = append(pages, ren.sourcePageNames()...)
+	models, err := ren.resolvedModels()
+	if err != nil {
+		return err
+	}
+	doc := Schemas{Version: schemaVersion, Pages: make(map[string]PageSchema, len(pages))}
+	for _, t := range pages {
+		meta, err := ren.PageMeta(t)
+		if err != nil {
+			return err
+		}
+		ps := PageSchema{Meta: meta}
+		if model, ok := models[t]; ok {
+			ps.Source = "model"
+			ps.Data = typeSchema(reflect.TypeOf(model), map[reflect.Type]bool{})
+		} else {
+			// parseSet builds the set without storing it in the cache.
+			set, err := ren.parseSet(t, ren.partials())
+			if err != nil {
+				return err
+			}
+			ps.Source = "usage"
+			ps.Data = usageSchema(dataUsage(set.tmpl, t))
+		}
+		doc.Pages[t] = ps
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(doc)
+}
+
+// resolvedModels returns Models by the names of their pages (see pageName).
+// A name matching no page or more than one, and two names of one page, are
+// errors.
+func (ren *Render) resolvedModels() (map[string]any, error) {
+	ren.mu.RLock()
+	names := make([]string, 0, len(ren.Models))
+	for name := range ren.Models {
+		names = append(names, name)
+	}
+	byName := maps.Clone(ren.Models)
+	ren.mu.RUnlock()
+	sort.Strings(names)
+
+	models := make(map[string]any, len(names))
+	given := make(map[string]string, len(names))
+	var errs []error
+	for _, name := range names {
+		t, err := ren.pageName(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("models: %w", err))
+			continue
+		}
+		if other, ok := given[t]; ok {
+			errs = append(errs, fmt.Errorf("models: %q and %q are both models of %s", other, name, t))
+			continue
+		}
+		given[t] = name
+		models[t] = byName[name]
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return models, nil
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// typeSchema returns the Schema of values of type t. visiting holds the
+// struct types being described, to stop at recursive types.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) Schema {
+	if t == nil {
+		return Schema{Type: "any"}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := Schema{}
+	if t.Name() != "" && t.PkgPath() != "" {
+		s.GoType = t.String()
+	}
+	switch {
+	case t == timeType:
+		s.Type, s.Format = "string", "date-time"
+		return s
+	case t == bytesType:
+		s.Type, s.Format = "string", "base64"
+		return s
+	}
+	switch t.Kind() {
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Slice, reflect.Array:
+		items := typeSchema(t.Elem(), visiting)
+		s.Type, s.Items = "array", &items
+	case reflect.Map:
+		items := typeSchema(t.Elem(), visiting)
+		s.Type, s.Items = "map", &items
+	case reflect.Struct:
+		s.Type = "object"
+		if visiting[t] {
+			s.Recursive = true
+			return s
+		}
+		visiting[t] = true
+		s.Fields = structFields(t, visiting)
+		delete(visiting, t)
+	default:
+		s.Type = "any"
+	}
+	return s
+}
+
+// structFields returns the exported fields of the struct type t sorted by
+// name, with the fields of embedded structs promoted as templates see them.
+func structFields(t reflect.Type, visiting map[reflect.Type]bool) []SchemaField {
+	var fields []SchemaField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				continue // Its fields are listed themselves.
+			}
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		fields = append(fields, SchemaField{Name: f.Name, JSON: name, Schema: typeSchema(f.Type, visiting)})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// usageSchema returns the Schema of the data used as node describes it:
+// objects for values with fields read, arrays for values ranged over, and
+// "any" for values that are only printed or passed on.
+func usageSchema(node *canaryNode) Schema {
+	s := Schema{Type: "any"}
+	if len(node.fields) > 0 {
+		s.Type = "object"
+		for name, child := range node.fields {
+			s.Fields = append(s.Fields, SchemaField{Name: name, Schema: usageSchema(child)})
+		}
+		sort.Slice(s.Fields, func(i, j int) bool { return s.Fields[i].Name < s.Fields[j].Name })
+	}
+	if node.list {
+		items := s
+		return Schema{Type: "array", Items: &items}
+	}
+	return s
+}
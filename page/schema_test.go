@@ -0,0 +1,138 @@
+package page
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaAuthor struct {
+	Name    string `json:"name"`
+	Born    time.Time
+	Manager *schemaAuthor
+}
+
+type schemaPost struct {
+	Title  string
+	Tags   []string `json:"tags,omitempty"`
+	Author schemaAuthor
+	Views  int64
+	Score  float64
+	Draft  bool
+	Secret string `json:"-"`
+	Body   []byte
+	TTL    time.Duration
+	Extra  map[string]*schemaAuthor
+	hidden int
+}
+
+var schemaTemplates = map[string]string{
+	"post.page.tmpl":       `{{.Title}}`,
+	"list.page.tmpl":       "---\ntitle: All posts\n---\n{{.Heading}}{{range .Posts}}{{.Title}}{{.Author.Name}}{{end}}",
+	"admin/list.page.tmpl": `admin`,
+	"a/feed.page.tmpl":     `a`,
+	"b/feed.page.tmpl":     `b`,
+}
+
+func exportSchemas(t *testing.T, ren *Render) (Schemas, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ren.ExportSchemas(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc Schemas
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc, buf.Bytes()
+}
+
+func TestExportSchemas(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, schemaTemplates))
+	ren.Models = map[string]any{"post": (*schemaPost)(nil)}
+	doc, out := exportSchemas(t, ren)
+
+	str := func(format string) Schema { return Schema{Type: "string", Format: format} }
+	author := Schema{Type: "object", GoType: "page.schemaAuthor", Fields: []SchemaField{
+		{Name: "Born", JSON: "Born", Schema: Schema{Type: "string", GoType: "time.Time", Format: "date-time"}},
+		{Name: "Manager", JSON: "Manager", Schema: Schema{Type: "object", GoType: "page.schemaAuthor", Recursive: true}},
+		{Name: "Name", JSON: "name", Schema: str("")},
+	}}
+	want := Schema{Type: "object", GoType: "page.schemaPost", Fields: []SchemaField{
+		{Name: "Author", JSON: "Author", Schema: author},
+		{Name: "Body", JSON: "Body", Schema: str("base64")},
+		{Name: "Draft", JSON: "Draft", Schema: Schema{Type: "boolean"}},
+		{Name: "Extra", JSON: "Extra", Schema: Schema{Type: "map", Items: &author}},
+		{Name: "Score", JSON: "Score", Schema: Schema{Type: "number"}},
+		{Name: "Secret", JSON: "-", Schema: str("")},
+		{Name: "TTL", JSON: "TTL", Schema: Schema{Type: "integer", GoType: "time.Duration"}},
+		{Name: "Tags", JSON: "tags", Schema: Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		{Name: "Title", JSON: "Title", Schema: str("")},
+		{Name: "Views", JSON: "Views", Schema: Schema{Type: "integer"}},
+	}}
+	post := doc.Pages["post.page.tmpl"]
+	if post.Source != "model" || !reflect.DeepEqual(post.Data, want) {
+		got, _ := json.MarshalIndent(post, "", "  ")
+		t.Errorf("post.page.tmpl:\n%s", got)
+	}
+
+	list := doc.Pages["list.page.tmpl"]
+	wantList := Schema{Type: "object", Fields: []SchemaField{
+		{Name: "Heading", Schema: Schema{Type: "any"}},
+		{Name: "Posts", Schema: Schema{Type: "array", Items: &Schema{Type: "object", Fields: []SchemaField{
+			{Name: "Author", Schema: Schema{Type: "object", Fields: []SchemaField{{Name: "Name", Schema: Schema{Type: "any"}}}}},
+			{Name: "Title", Schema: Schema{Type: "any"}},
+		}}}},
+	}}
+	if list.Source != "usage" || !reflect.DeepEqual(list.Data, wantList) || list.Meta["title"] != "All posts" {
+		got, _ := json.MarshalIndent(list, "", "  ")
+		t.Errorf("list.page.tmpl:\n%s", got)
+	}
+	if len(doc.Pages) != len(schemaTemplates) {
+		t.Errorf("%d pages, want %d", len(doc.Pages), len(schemaTemplates))
+	}
+
+	if _, again := exportSchemas(t, ren); !bytes.Equal(out, again) {
+		t.Error("two exports differ")
+	}
+}
+
+// Models are keyed by page names as Show takes them; names matching no page,
+// more than one, or a page named twice fail the export.
+func TestExportSchemasModelNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		models  map[string]any
+		wantErr string
+	}{
+		{"without extension", map[string]any{"post.page": schemaPost{}}, ""},
+		{"path", map[string]any{"admin/list": schemaPost{}}, ""},
+		{"missing", map[string]any{"missing": schemaPost{}}, `no page "missing"`},
+		{"ambiguous", map[string]any{"feed": schemaPost{}}, `"feed" is ambiguous`},
+		{"twice", map[string]any{"post": schemaPost{}, "post.page.tmpl": schemaPost{}}, `"post" and "post.page.tmpl" are both models of post.page.tmpl`},
+	}
+	for _, tt := range tests {
+		ren := newTestRender(t, writeTemplates(t, schemaTemplates))
+		ren.Models = tt.models
+		if tt.wantErr == "" {
+			models := 0
+			doc, _ := exportSchemas(t, ren)
+			for _, ps := range doc.Pages {
+				if ps.Source == "model" {
+					models++
+				}
+			}
+			if models != 1 {
+				t.Errorf("%s: %d pages described by their model, want 1", tt.name, models)
+			}
+			continue
+		}
+		err := ren.ExportSchemas(new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// sourceFile is the file a parsed source came from. LineOffset is the number
+// of lines removed from the start of the file before it was parsed, and is
+// added to the line numbers the template package reports.
+type sourceFile struct {
+	Path       string
+	LineOffset int
+}
+
+// sourceMap maps the names the template package uses in error positions (the
+// templateName for a partial, the page name for the page) to the source files of
+// one set. It is built with the set and kept next to it in the cache.
+type sourceMap map[string]sourceFile
+
+// newSourceMap returns the source map of the set of page t parsed from pageFile
+// and partials.
+func (ren *Render) newSourceMap(t, pageFile string, partials []string) sourceMap {
+	m := make(sourceMap, len(partials)+1)
+	for _, p := range partials {
+		m[ren.templateName(p)] = sourceFile{Path: p}
+	}
+	m[t] = sourceFile{Path: pageFile}
+	return m
+}
+
+// RenderError is the error returned when a page fails to parse or execute.
+// File and Line are the original source file and line of the failure, also
+// when it is in a partial or an environment variant of the page.
+type RenderError struct {
+	Page   string // The page being rendered, e.g. "home.page.tmpl".
+	File   string // Source file of the failure, e.g. "templates/footer.partial.tmpl"; "" when unknown.
+	Line   int    // Line in File; 0 when unknown.
+	Column int    // Column (in bytes) in Line; 0 when unknown.
+	Err    error  // The error of the template package.
+}
+
+func (e *RenderError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("rendering %s: %v", e.Page, e.Err)
+	}
+	if e.Column > 0 {
+		return fmt.Sprintf("rendering %s: %s:%d:%d: %v", e.Page, e.File, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("rendering %s: %s:%d: %v", e.Page, e.File, e.Line, e.Err)
+}
+
+func (e *RenderError) Unwrap() error { return e.Err }
+
+// errorPosition matches the position in the errors of text/template and
+// html/template: "template: footer.partial.tmpl:4:7: ..." or
+// "html/template:home.page.tmpl:12: ...".
+var errorPosition = regexp.MustCompile(`template: ?([^:\s]+):(\d+)(?::(\d+))?:`)
+
+// renderError wraps err, an error of the set of page t, in a RenderError
+// pointing at the original source position according to sources.
+func renderError(t string, sources sourceMap, err error) error {
+	var re *RenderError
+	if err == nil || errors.As(err, &re) {
+		return err
+	}
+	e := &RenderError{Page: t, Err: err}
+	m := errorPosition.FindStringSubmatch(err.Error())
+	if m == nil {
+		return e
+	}
+	src, ok := sources[m[1]]
+	if !ok {
+		return e
+	}
+	e.File = src.Path
+	e.Line, _ = strconv.Atoi(m[2])
+	e.Line += src.LineOffset
+	e.Column, _ = strconv.Atoi(m[3])
+	return e
+}
+
+// sources returns the source map of the cached set of page t.
+func (ren *Render) sources(t string) sourceMap {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return ren.sourceMaps[t]
+}
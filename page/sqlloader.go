@@ -0,0 +1,87 @@
+package page
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// SQLLoader is the ChangeLoader of the templates in a database table with the
+// columns name (the file name, as for Loader), body and updated_at, e.g.
+// templates edited in the admin interface of a CMS:
+//
+//	CREATE TABLE templates (
+//		name       VARCHAR(255) PRIMARY KEY,
+//		body       TEXT NOT NULL,
+//		updated_at TIMESTAMP NOT NULL
+//	);
+//
+// Keep updated_at current on every change, since it is how edits reach the
+// cache; rows deleted are noticed with the next change. Use it as the Loader
+// of a Render with UseCache set; see ChangeLoader.
+type SQLLoader struct {
+	DB *sql.DB
+	// The table; "templates" when empty. It is put into the queries as is.
+	Table string
+	// The parameter marker of the driver: "?" when empty, "$1" for PostgreSQL.
+	Placeholder string
+}
+
+// query returns the query format, with the table and the parameter marker of
+// l put in for %[1]s and %[2]s.
+func (l SQLLoader) query(format string) string {
+	table, param := l.Table, l.Placeholder
+	if table == "" {
+		table = "templates"
+	}
+	if param == "" {
+		param = "?"
+	}
+	return fmt.Sprintf(format, table, param)
+}
+
+// Load returns the body of the row name.
+func (l SQLLoader) Load(name string) ([]byte, error) {
+	var body string
+	err := l.DB.QueryRow(l.query("SELECT body FROM %[1]s WHERE name = %[2]s"), name).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("template %s: %w", name, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return []byte(body), nil
+}
+
+// List returns the names of all rows.
+func (l SQLLoader) List() ([]string, error) {
+	return l.names(l.query("SELECT name FROM %[1]s ORDER BY name"))
+}
+
+// Changed returns the names of the rows updated after since.
+func (l SQLLoader) Changed(since time.Time) ([]string, error) {
+	return l.names(l.query("SELECT name FROM %[1]s WHERE updated_at > %[2]s ORDER BY name"), since)
+}
+
+// names returns the names query selects.
+func (l SQLLoader) names(query string, args ...any) ([]string, error) {
+	rows, err := l.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("templates: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,225 @@
+package page
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTemplates is a database/sql driver serving the queries of SQLLoader
+// from a map, and recording them.
+type fakeTemplates struct {
+	mu      sync.Mutex
+	rows    map[string]fakeRow
+	queries []string
+	err     error // Returned by every query when set.
+}
+
+type fakeRow struct {
+	body      string
+	updatedAt time.Time
+}
+
+// newFakeTemplates returns a *sql.DB of the rows name -> body, all updated at
+// updated, and its driver.
+func newFakeTemplates(t *testing.T, updated time.Time, bodies map[string]string) (*sql.DB, *fakeTemplates) {
+	f := &fakeTemplates{rows: make(map[string]fakeRow)}
+	for name, body := range bodies {
+		f.rows[name] = fakeRow{body, updated}
+	}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// set updates the row name to body at updated.
+func (f *fakeTemplates) set(name, body string, updated time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rows[name] = fakeRow{body, updated}
+}
+
+// count returns the number of queries containing s.
+func (f *fakeTemplates) count(s string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, q := range f.queries {
+		if strings.Contains(q, s) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeTemplates) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeTemplates) Driver() driver.Driver                        { return nil }
+
+// query answers the queries of SQLLoader.
+func (f *fakeTemplates) query(query string, args []driver.Value) (driver.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, query)
+	if f.err != nil {
+		return nil, f.err
+	}
+	rows := &fakeRows{column: "name"}
+	switch {
+	case strings.HasPrefix(query, "SELECT body"):
+		rows.column = "body"
+		if row, ok := f.rows[args[0].(string)]; ok {
+			rows.values = []string{row.body}
+		}
+	case strings.Contains(query, "updated_at >"):
+		for name, row := range f.rows {
+			if row.updatedAt.After(args[0].(time.Time)) {
+				rows.values = append(rows.values, name)
+			}
+		}
+	default:
+		for name := range f.rows {
+			rows.values = append(rows.values, name)
+		}
+	}
+	if rows.column == "name" {
+		sort.Strings(rows.values)
+	}
+	return rows, nil
+}
+
+type fakeConn struct{ f *fakeTemplates }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.f, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type fakeStmt struct {
+	f     *fakeTemplates
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("read only")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return s.f.query(s.query, args) }
+
+// fakeRows are the rows of a single string column.
+type fakeRows struct {
+	column string
+	values []string
+}
+
+func (r *fakeRows) Columns() []string { return []string{r.column} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestSQLLoader(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	db, f := newFakeTemplates(t, t0, map[string]string{
+		"home.page.tmpl":               "home",
+		"partials/footer.partial.tmpl": "footer",
+	})
+	f.set("about.page.tmpl", "about", t0.Add(time.Hour))
+	l := SQLLoader{DB: db, Table: "cms_templates", Placeholder: "$1"}
+
+	if got, err := l.Load("home.page.tmpl"); err != nil || string(got) != "home" {
+		t.Errorf("Load(home.page.tmpl) = %q, %v", got, err)
+	}
+	if _, err := l.Load("missing.page.tmpl"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load of a missing row: %v, want fs.ErrNotExist", err)
+	}
+	want := []string{"about.page.tmpl", "home.page.tmpl", "partials/footer.partial.tmpl"}
+	if got, err := l.List(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %q, %v; want %q", got, err, want)
+	}
+	if got, err := l.Changed(t0); err != nil || !reflect.DeepEqual(got, []string{"about.page.tmpl"}) {
+		t.Errorf("Changed(t0) = %q, %v", got, err)
+	}
+	if got, err := l.Changed(t0.Add(time.Hour)); err != nil || len(got) != 0 {
+		t.Errorf("Changed(latest) = %q, %v", got, err)
+	}
+	for _, q := range f.queries {
+		if !strings.Contains(q, " cms_templates") {
+			t.Errorf("query %q doesn't use the table", q)
+		}
+		if strings.Contains(q, "WHERE") && !strings.Contains(q, "$1") {
+			t.Errorf("query %q doesn't use the placeholder", q)
+		}
+	}
+
+	f.err = errors.New("connection refused")
+	if _, err := l.Load("home.page.tmpl"); err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Load with a failing database: %v", err)
+	}
+	if _, err := l.List(); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("List with a failing database: %v", err)
+	}
+	if _, err := l.Changed(t0); err == nil {
+		t.Error("Changed with a failing database succeeded")
+	}
+}
+
+// A Render reading its templates from the database lists them once per
+// scan, and serves a row edited after it was cached once LoaderPoll passed.
+func TestSQLLoaderRender(t *testing.T) {
+	t0 := time.Now().Add(-time.Hour)
+	db, f := newFakeTemplates(t, t0, map[string]string{
+		"base.layout.tmpl":             `{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{template "footer" .}}{{end}}`,
+		"partials/footer.partial.tmpl": `{{define "footer"}}<footer>v1</footer>{{end}}`,
+		"home.page.tmpl":               `{{template "base" .}}{{define "content"}}home{{end}}`,
+		"admin/users.page.tmpl":        `{{template "base" .}}{{define "content"}}users{{end}}`,
+		"admin/deep/more/x.page.tmpl":  `x`,
+	})
+	ren := New()
+	ren.TemplateDir = "templates"
+	ren.Loader = SQLLoader{DB: db}
+	ren.UseCache = true
+	ren.LoaderPoll = time.Millisecond
+
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.count("SELECT name FROM templates ORDER BY name"); n != 1 {
+		t.Errorf("the scan listed the table %d times, want once", n)
+	}
+	for page, want := range map[string]string{
+		"home":        "<main>home</main><footer>v1</footer>",
+		"admin/users": "<main>users</main><footer>v1</footer>",
+	} {
+		if got, err := ren.String(page, nil); err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", page, got, err, want)
+		}
+	}
+
+	f.set("partials/footer.partial.tmpl", `{{define "footer"}}<footer>v2</footer>{{end}}`, time.Now())
+	time.Sleep(2 * time.Millisecond)
+	if got, err := ren.String("home", nil); err != nil || got != "<main>home</main><footer>v2</footer>" {
+		t.Errorf("after editing the footer: got %q, %v", got, err)
+	}
+
+	// A failing database fails the scan.
+	f.mu.Lock()
+	f.err = errors.New("connection refused")
+	f.mu.Unlock()
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("LoadLayoutsAndPartials with a failing database: %v", err)
+	}
+}
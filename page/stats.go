@@ -0,0 +1,93 @@
+package page
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds counters about the work a Render has done; see Render.Stats.
+type Stats struct {
+	FoldedIncludes int64 // {{template}} calls replaced by static text while building sets.
+	ReloadWarmed   int64 // Pages built so far by the last WarmReload.
+	ReloadTotal    int64 // Pages the last WarmReload builds.
+	StaleServed    int64 // Disk cache files served past DiskCacheTTL while refreshed.
+	EventsDropped  int64 // Template events not delivered to a subscriber that was behind, see Render.Subscribe.
+	SetsBuilt      int64 // Template sets built from disk for a render that didn't find them in the cache.
+	BuildsShared   int64 // Renders that waited for another render's build of the same page instead of building it.
+	Evicted        int64 // Template sets dropped from the cache for Render.MaxCachedTemplates.
+
+	// With UseCache, renders served from the cache and renders that found
+	// their page missing; a miss builds the set, or waits for its build.
+	CacheHits   int64
+	CacheMisses int64
+	BuildErrors int64         // Builds of template sets that failed.
+	ParseTime   time.Duration // Time spent building template sets, in total.
+	Cached      int           // Template sets in the cache.
+
+	Deprecated map[string]int64                 // Renders using each template registered with Deprecate.
+	Blocks     map[string]BlockTiming           // Timings per template name, see Render.TraceBlocks.
+	Disabled   map[string]Disabled              // Pages switched off with Render.Disable.
+	Memory     map[string]RenderMemory          // Buffer and output sizes per template.
+	Unreadable []string                         // Directories the last scan of TemplateDir skipped as unreadable.
+	Funcs      map[string]map[string]FuncTiming // Calls per page and function, see Render.ProfileFuncs.
+	Limited    map[string]LimitStats            // Requests per page that hit its Render.Limit.
+	Coalesced  map[string]int64                 // Renders per page that shared another's execution, see Render.Coalesce.
+}
+
+// renderStats holds the live counters behind Stats.
+type renderStats struct {
+	foldedIncludes atomic.Int64
+	reloadWarmed   atomic.Int64
+	reloadTotal    atomic.Int64
+	staleServed    atomic.Int64
+	setsBuilt      atomic.Int64
+	buildsShared   atomic.Int64
+	evicted        atomic.Int64
+
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+	buildErrors atomic.Int64
+	parseTime   atomic.Int64 // Nanoseconds.
+}
+
+// Stats returns a snapshot of the counters of ren. The counters are kept
+// with atomic operations, so renders update them without taking a lock.
+func (ren *Render) Stats() Stats {
+	ren.mu.RLock()
+	cached := len(ren.cache)
+	ren.mu.RUnlock()
+	return Stats{
+		FoldedIncludes: ren.stats.foldedIncludes.Load(),
+		ReloadWarmed:   ren.stats.reloadWarmed.Load(),
+		ReloadTotal:    ren.stats.reloadTotal.Load(),
+		StaleServed:    ren.stats.staleServed.Load(),
+		EventsDropped:  ren.eventsDropped(),
+		SetsBuilt:      ren.stats.setsBuilt.Load(),
+		BuildsShared:   ren.stats.buildsShared.Load(),
+		Evicted:        ren.stats.evicted.Load(),
+		Deprecated:     ren.deprecatedCounts(),
+		Blocks:         ren.blockTimings.snapshot(),
+		Disabled:       ren.disabledPages(),
+		Memory:         ren.memory.snapshot(),
+		Unreadable:     ren.unreadableDirs(),
+		Funcs:          ren.funcProfile.snapshot(),
+		Limited:        ren.limits.snapshot(),
+		Coalesced:      ren.coalescer.snapshot(),
+
+		CacheHits:   ren.stats.cacheHits.Load(),
+		CacheMisses: ren.stats.cacheMisses.Load(),
+		BuildErrors: ren.stats.buildErrors.Load(),
+		ParseTime:   time.Duration(ren.stats.parseTime.Load()),
+		Cached:      cached,
+	}
+}
+
+// ResetStats sets the counters of Stats to zero, e.g. to measure the cache
+// over one load test. The progress of the last WarmReload, the events
+// dropped and the counters per template are kept.
+func (ren *Render) ResetStats() {
+	s := &ren.stats
+	for _, c := range []*atomic.Int64{&s.foldedIncludes, &s.staleServed, &s.setsBuilt, &s.buildsShared, &s.evicted, &s.cacheHits, &s.cacheMisses, &s.buildErrors, &s.parseTime} {
+		c.Store(0)
+	}
+}
@@ -0,0 +1,172 @@
+package page
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+)
+
+// stringPartial is a partial added with AddPartialString.
+type stringPartial struct {
+	name string
+	src  string
+}
+
+// stringPath is the name of the template source name in errors and source
+// maps, as "source:file" is for the files of a registered source.
+func stringPath(name string) string {
+	return "string:" + name
+}
+
+// AddTemplateString adds the page name with the template source src, for
+// pages that don't live in a file: generated ones, or ones kept in a
+// database. The page is parsed with the partials, like a page in
+// TemplateDir, and cached at once, so Show, String and GetTemplate serve it
+// like any other page; it is built again from src whenever the cache is
+// cleared. A parse error is returned right away, as a *RenderError naming
+// the page. Adding name again replaces the page and its cached set in one
+// step.
+func (ren *Render) AddTemplateString(name, src string) error {
+	partials, theme := ren.partials(), ren.currentTheme()
+	set, err := ren.parseStringSet(name, src, ren.resolvePartialFiles(partials, theme), false)
+	if err != nil {
+		return err
+	}
+	set.partialsKey = partialsKey(partials, theme)
+
+	defer ren.notifyEvicted()
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.stringPages == nil {
+		ren.stringPages = make(map[string]string)
+	}
+	typ := TemplateAdded
+	if _, ok := ren.stringPages[name]; ok {
+		typ = TemplateChanged
+	}
+	ren.stringPages[name] = src
+	ren.countRegistriesLocked()
+	ren.storeSetLocked(name, set)
+	ren.pageAliases = nil
+	if ren.Debug {
+		log.Println("Added template", name, "from a string")
+	}
+	ren.publish(TemplateEvent{Type: typ, Path: name, Pages: []string{name}, Fingerprint: set.fingerprint})
+	return nil
+}
+
+// AddPartialString adds the partial name with the template source src, parsed
+// into every page after the partial files. Adding name again replaces the
+// partial in its place. A parse error is returned right away, with the name.
+// Like SetPartials, it clears the template cache.
+func (ren *Render) AddPartialString(name, src string) error {
+	if _, err := template.New(name).Funcs(ren.templateFuncs()).Parse(src); err != nil {
+		return fmt.Errorf("%s: %w", stringPath(name), err)
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	replaced := false
+	for i, p := range ren.stringPartials {
+		if p.name == name {
+			ren.stringPartials[i].src = src
+			replaced = true
+		}
+	}
+	if !replaced {
+		ren.stringPartials = append(ren.stringPartials, stringPartial{name: name, src: src})
+	}
+	pages := ren.cachedPagesLocked()
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	if ren.Debug {
+		log.Println("Added partial", name, "from a string - template cache cleared")
+	}
+	ren.publish(TemplateEvent{Type: TemplateAdded, Path: name, Pages: pages})
+	return nil
+}
+
+// stringPage returns the source of the page t, if it was added with
+// AddTemplateString.
+func (ren *Render) stringPage(t string) (string, bool) {
+	if ren.sizes.stringPages.Load() == 0 {
+		return "", false
+	}
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	src, ok := ren.stringPages[t]
+	return src, ok
+}
+
+// stringPartialList returns a copy of the partials of AddPartialString, taken
+// under the lock.
+func (ren *Render) stringPartialList() []stringPartial {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return append([]stringPartial(nil), ren.stringPartials...)
+}
+
+// addStringPartials parses the partials of AddPartialString into tmpl and
+// adds them to sources. It returns the partials, for fingerprintStrings.
+func (ren *Render) addStringPartials(tmpl *template.Template, sources sourceMap) ([]stringPartial, error) {
+	partials := ren.stringPartialList()
+	for _, p := range partials {
+		sources[p.name] = sourceFile{Path: stringPath(p.name)}
+		if _, err := tmpl.New(p.name).Parse(p.src); err != nil {
+			return nil, renderError(tmpl.Name(), sources, err)
+		}
+	}
+	return partials, nil
+}
+
+// fingerprintStrings returns fingerprint, the fingerprint of the files of a
+// set, combined with the template sources of the set that aren't files. It is
+// fingerprint itself when there are none.
+func fingerprintStrings(fingerprint string, sources []stringPartial) string {
+	if len(sources) == 0 {
+		return fingerprint
+	}
+	h := sha256.New()
+	io.WriteString(h, fingerprint)
+	for _, s := range sources {
+		h.Write([]byte{0})
+		io.WriteString(h, stringPath(s.name))
+		h.Write([]byte{0})
+		io.WriteString(h, s.src)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseStringSet is parseSet for the page t added with AddTemplateString,
+// with the source src; fresh is that of partialSet.
+func (ren *Render) parseStringSet(t, src string, partialFiles []string, fresh bool) (builtSet, error) {
+	sources := ren.newSourceMap(t, stringPath(t), partialFiles)
+	tmpl, partials, base, err := ren.partialSet(t, partialFiles, sources, fresh)
+	if err != nil {
+		return builtSet{}, err
+	}
+
+	body, skipped, err := ren.transformSource(stringPath(t), []byte(src))
+	if err != nil {
+		return builtSet{}, err
+	}
+	sources[t] = sourceFile{Path: stringPath(t), LineOffset: skipped}
+	if _, err := tmpl.Parse(string(body)); err != nil {
+		return builtSet{}, renderError(t, sources, err)
+	}
+	if err := ren.addPartialSets(tmpl); err != nil {
+		return builtSet{}, err
+	}
+
+	fingerprint, err := ren.fingerprintAfter(base, partialFiles)
+	if err != nil {
+		return builtSet{}, err
+	}
+	fingerprint = fingerprintStrings(fingerprint, append(partials, stringPartial{name: t, src: src}))
+	return ren.finishSet(tmpl, sources, fingerprint, partialFiles)
+}
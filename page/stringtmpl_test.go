@@ -0,0 +1,61 @@
+package page
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A page added from a string uses the layout and footer partial on disk,
+// like a page file.
+func TestAddTemplateStringDiskFooter(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{template "footer" .}}{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}<footer>{{.}}</footer>{{end}}`,
+	}))
+	ren.UseCache = true
+	if err := ren.AddTemplateString("generated.page.tmpl", `{{template "base" .}}{{define "content"}}generated{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := ren.String("generated.page.tmpl", "x"); err != nil || got != "<main>generated</main><footer>x</footer>" {
+			t.Errorf("render %d: got %q, %v", i, got, err)
+		}
+	}
+	if s := ren.Stats(); s.SetsBuilt != 0 {
+		t.Errorf("SetsBuilt = %d: the page was built again from disk", s.SetsBuilt)
+	}
+
+	// Adding it again replaces the cached set.
+	if err := ren.AddTemplateString("generated.page.tmpl", `{{template "base" .}}{{define "content"}}replaced{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ren.String("generated.page.tmpl", "x"); err != nil || got != "<main>replaced</main><footer>x</footer>" {
+		t.Errorf("after replacing: got %q, %v", got, err)
+	}
+
+	// A partial added from a string replaces the footer on disk.
+	if err := ren.AddPartialString("footer.partial.tmpl", `{{define "footer"}}<footer>string {{.}}</footer>{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ren.String("generated.page.tmpl", "x"); err != nil || got != "<main>replaced</main><footer>string x</footer>" {
+		t.Errorf("after AddPartialString: got %q, %v", got, err)
+	}
+}
+
+// A parse error is returned at once, naming the page, and keeps the page
+// added before.
+func TestAddTemplateStringParseError(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{"home.page.tmpl": `home`}))
+	if err := ren.AddTemplateString("gen.page.tmpl", `good`); err != nil {
+		t.Fatal(err)
+	}
+	err := ren.AddTemplateString("gen.page.tmpl", `{{if}}`)
+	var re *RenderError
+	if !errors.As(err, &re) || !strings.Contains(err.Error(), "gen.page.tmpl") {
+		t.Fatalf("error %v, want a *RenderError naming the page", err)
+	}
+	if got, err := ren.String("gen.page.tmpl", nil); err != nil || got != "good" {
+		t.Errorf("after the failed add: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,109 @@
+package page
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultSurrogateKeyHeader is the response header carrying the surrogate
+// keys of a page when SurrogateKeyHeader is "".
+const DefaultSurrogateKeyHeader = "Surrogate-Key"
+
+// surrogateKeys collects the surrogate keys of one render.
+type surrogateKeys map[string]bool
+
+// add is the {{surrogateKey "key"}} function of a render collecting keys.
+func (k surrogateKeys) add(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, " \t\r\n,") {
+		return "", fmt.Errorf("surrogateKey: invalid key %q", key)
+	}
+	k[key] = true
+	return "", nil
+}
+
+// list returns the keys sorted, or nil when there are none.
+func (k surrogateKeys) list() []string {
+	if len(k) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(k))
+	for key := range k {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// noSurrogateKey is the {{surrogateKey}} function of the cached sets. Renders
+// execute a copy with surrogateKeys.add bound instead; see surrogateTemplate.
+func noSurrogateKey(key string) string {
+	return ""
+}
+
+// newSurrogateKeys returns the collector for a render of t, holding the keys
+// SurrogateKeys declares for t and for every template it calls. Calls are
+// those of the set before folding, so a partial replaced by its static text
+// still contributes its keys.
+func (ren *Render) newSurrogateKeys(t string) surrogateKeys {
+	keys := make(surrogateKeys)
+	if len(ren.SurrogateKeys) == 0 {
+		return keys
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	for _, name := range append([]string{t}, ren.calls[t]...) {
+		for _, key := range ren.SurrogateKeys[name] {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// surrogateTemplate returns the set to execute for a render of t collecting
+// into keys, or nil when t doesn't call {{surrogateKey}}. Like traceTemplate,
+// it binds to a copy of the prototype when tmpl is the cached set, and to
+// tmpl itself when it already is an unexecuted copy.
+func (ren *Render) surrogateTemplate(tmpl *template.Template, t string, keys surrogateKeys) *template.Template {
+	p, ok := ren.cachedPage(t)
+	if !ok {
+		ren.mu.RLock()
+		p = snapshotPage{set: ren.cache[t], proto: ren.protos[t], keyed: ren.keyed[t]}
+		ren.mu.RUnlock()
+	}
+	cached, proto, keyed := p.set, p.proto, p.keyed
+	if !keyed {
+		return nil
+	}
+	if tmpl == cached {
+		if proto == nil {
+			return nil
+		}
+		clone, err := proto.Clone()
+		if err != nil {
+			return nil
+		}
+		tmpl = clone
+	}
+	return tmpl.Funcs(template.FuncMap{"surrogateKey": keys.add})
+}
+
+// setSurrogateKeys sets the surrogate key header of w to keys. Cache-Tag
+// (Cloudflare) takes a comma-separated list, other headers a space-separated
+// one (Surrogate-Key, as used by Fastly).
+func (ren *Render) setSurrogateKeys(w http.ResponseWriter, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	header := ren.SurrogateKeyHeader
+	if header == "" {
+		header = DefaultSurrogateKeyHeader
+	}
+	sep := " "
+	if http.CanonicalHeaderKey(header) == "Cache-Tag" {
+		sep = ","
+	}
+	w.Header().Set(header, strings.Join(keys, sep))
+}
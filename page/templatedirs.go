@@ -0,0 +1,172 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// templateDirs returns the template directories, lowest priority first:
+// TemplateDirs, or TemplateDir alone when that is empty.
+func (ren *Render) templateDirs() []string {
+	if len(ren.TemplateDirs) > 0 {
+		return ren.TemplateDirs
+	}
+	return []string{ren.currentTemplateDir()}
+}
+
+// currentTemplateDir returns TemplateDir, or the directory of the last
+// SetTemplateDir, which may be switched while pages are rendered.
+func (ren *Render) currentTemplateDir() string {
+	if dir := ren.templateDir.Load(); dir != nil {
+		return *dir
+	}
+	return ren.TemplateDir
+}
+
+// SetTemplateDir switches TemplateDir to dir while pages are rendered, e.g.
+// from templates-v123 to templates-v124 after a deploy. dir is scanned for
+// the layouts and partials of the types of the last LoadLayoutsAndPartials,
+// and they are parsed, first; when dir doesn't exist, holds no templates or
+// a partial fails to parse, the error is returned and the current directory
+// stays in use. Otherwise the directory and the partials are replaced and
+// the template cache is cleared in one step: renders running at the time
+// finish with the sets they have, and later ones build their pages from dir.
+//
+// The TemplateDir field is left as it is, since renders read it without a
+// lock; once SetTemplateDir is used, it is no longer seen, and directories
+// are switched with SetTemplateDir only. It fails with TemplateDirs set, and
+// the tenants of AddTenant keep their directories.
+func (ren *Render) SetTemplateDir(dir string) error {
+	if len(ren.TemplateDirs) > 0 {
+		return errors.New("SetTemplateDir can't be used with TemplateDirs")
+	}
+	// The new directory is checked on a Clone, so nothing of ren changes
+	// before the swap.
+	probe := ren.Clone()
+	probe.TemplateDir = dir
+	ren.mu.RLock()
+	fileTypes := ren.partialTypes
+	ren.mu.RUnlock()
+	partials, err := probe.discoverPartials(context.Background(), fileTypes)
+	if err != nil {
+		return err
+	}
+	partials = dedupe(nil, partials)
+	files := probe.resolvePartialFiles(partials, probe.currentTheme())
+	if _, err := probe.parseBase("", files); err != nil {
+		return fmt.Errorf("template dir %s: %w", probe.displayDir(dir), err)
+	}
+
+	ren.mu.Lock()
+	ren.templateDir.Store(&dir)
+	ren.setPartialsLocked(partials)
+	ren.mu.Unlock()
+	if ren.Debug {
+		log.Println("Template directory changed to", dir)
+	}
+	return nil
+}
+
+// lookupTemplate returns the file of the template name, a path relative to
+// the template directories: name in the last directory that has it, or in
+// the first one when none has it, so errors name the base file.
+func (ren *Render) lookupTemplate(name string) string {
+	dirs := ren.templateDirs()
+	for i := len(dirs) - 1; i > 0; i-- {
+		file := filepath.Join(dirs[i], name)
+		if ren.templateExists(file) {
+			return file
+		}
+	}
+	return filepath.Join(dirs[0], name)
+}
+
+// templateExists reports whether the template file file exists.
+func (ren *Render) templateExists(file string) bool {
+	_, err := ren.statTemplate(file)
+	return err == nil
+}
+
+// relativeTo returns file relative to the template directory it is in,
+// looking at the directories of highest priority first.
+func (ren *Render) relativeTo(file string) (string, bool) {
+	_, rel, ok := ren.dirOf(file)
+	return rel, ok
+}
+
+// dirOf is relativeTo, also returning the index of the directory in
+// templateDirs.
+func (ren *Render) dirOf(file string) (i int, rel string, ok bool) {
+	dirs := ren.templateDirs()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], file)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return i, rel, true
+		}
+	}
+	return 0, "", false
+}
+
+// templateName returns the name of the template file file in a set: its path
+// relative to its template directory, with slashes, so files with the same
+// base name in different subdirectories don't collide:
+// "templates/components/card.partial.tmpl" is "components/card.partial.tmpl".
+// A file of a theme is named as the file it replaces, and a file outside of
+// the template directories by its base name.
+func (ren *Render) templateName(file string) string {
+	if _, rel, ok := ren.themeOf(file); ok {
+		return filepath.ToSlash(rel)
+	}
+	if rel, ok := ren.relativeTo(file); ok {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(file)
+}
+
+// inTemplateDir reports whether file is directly in one of the template
+// directories, not in a directory below one.
+func (ren *Render) inTemplateDir(file string) bool {
+	dir := filepath.Dir(file)
+	for _, d := range ren.templateDirs() {
+		if dir == filepath.Clean(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// findTemplates is findContext over all template directories, merged by the
+// path of the files relative to their directory: a file in a later directory
+// replaces the one with the same path in an earlier directory, in the place
+// that one had, so the order of the base directory is kept.
+func (ren *Render) findTemplates(ctx context.Context) ([]string, error) {
+	dirs := ren.templateDirs()
+	if len(dirs) == 1 {
+		return ren.findContext(ctx, dirs[0])
+	}
+	var files []string
+	index := make(map[string]int)
+	for _, dir := range dirs {
+		found, err := ren.findContext(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			rel, err := filepath.Rel(dir, f)
+			if err != nil {
+				rel = f
+			}
+			if i, ok := index[rel]; ok {
+				files[i] = f
+				continue
+			}
+			index[rel] = len(files)
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,146 @@
+package page
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// versionedTemplates returns a template directory of version v, with a
+// layout, a partial and pages p0 to p9 that render "L<v>G<v>P<v>".
+func versionedTemplates(tb testing.TB, v int) string {
+	tb.Helper()
+	files := map[string]string{
+		"base.layout.tmpl":    fmt.Sprintf(`{{define "base"}}L%d{{template "footer" .}}{{block "content" .}}{{end}}{{end}}`, v),
+		"footer.partial.tmpl": fmt.Sprintf(`{{define "footer"}}G%d{{end}}`, v),
+	}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("p%d.page.tmpl", i)] = fmt.Sprintf(`{{template "base" .}}{{define "content"}}P%d{{end}}`, v)
+	}
+	return writeTemplates(tb, files)
+}
+
+// Renders running while SetTemplateDir flips between two directories get
+// every template of one of them, never a mix.
+func TestSetTemplateDirConcurrent(t *testing.T) {
+	dirs := []string{versionedTemplates(t, 1), versionedTemplates(t, 2)}
+	for _, useCache := range []bool{true, false} {
+		t.Run(fmt.Sprintf("UseCache=%v", useCache), func(t *testing.T) {
+			ren := newTestRender(t, dirs[0])
+			ren.UseCache = useCache
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for g := 0; g < 6; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						page := fmt.Sprintf("p%d.page.tmpl", (g+i)%10)
+						got, err := ren.String(page, nil)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if got != "L1G1P1" && got != "L2G2P2" {
+							t.Errorf("%s: got %q, a mix of the two directories", page, got)
+							return
+						}
+					}
+				}(g)
+			}
+			for i := 0; i < 100; i++ {
+				if err := ren.SetTemplateDir(dirs[(i+1)%2]); err != nil {
+					t.Error(err)
+					break
+				}
+			}
+			close(stop)
+			wg.Wait()
+
+			// The last switch was to the first directory.
+			for i := 0; i < 10; i++ {
+				if got, err := ren.String(fmt.Sprintf("p%d.page.tmpl", i), nil); err != nil || got != "L1G1P1" {
+					t.Errorf("p%d after the switches: got %q, %v", i, got, err)
+				}
+			}
+		})
+	}
+}
+
+// A build that overlaps the switch is built again from the new directory, so
+// it can't mix files of both, and its old set isn't cached.
+func TestSetTemplateDirDuringBuild(t *testing.T) {
+	old, next := versionedTemplates(t, 1), versionedTemplates(t, 2)
+	ren := newTestRender(t, old)
+	ren.UseCache = true
+
+	armed := true
+	ren.SourceTransforms = []SourceTransform{func(name string, src []byte) ([]byte, error) {
+		if armed && strings.HasSuffix(name, "p0.page.tmpl") {
+			armed = false
+			if err := ren.SetTemplateDir(next); err != nil {
+				return nil, err
+			}
+		}
+		return src, nil
+	}}
+	for i := 0; i < 2; i++ {
+		if got, err := ren.String("p0.page.tmpl", nil); err != nil || got != "L2G2P2" {
+			t.Errorf("render %d: got %q, %v", i, got, err)
+		}
+	}
+}
+
+// A directory that is missing, has no templates or has a broken partial is
+// refused, and the current one stays in use.
+func TestSetTemplateDirInvalid(t *testing.T) {
+	old := versionedTemplates(t, 1)
+	broken := versionedTemplates(t, 2)
+	if err := os.WriteFile(filepath.Join(broken, "footer.partial.tmpl"), []byte(`{{define "footer"}}{{.}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, dir string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "templates-v3")},
+		{"empty", t.TempDir()},
+		{"broken partial", broken},
+	}
+	for _, tt := range tests {
+		ren := newTestRender(t, old)
+		ren.UseCache = true
+		if _, err := ren.String("p0.page.tmpl", nil); err != nil {
+			t.Fatal(err)
+		}
+		partials := ren.partials()
+		if err := ren.SetTemplateDir(tt.dir); err == nil {
+			t.Errorf("%s: SetTemplateDir succeeded", tt.name)
+		}
+		if got := ren.currentTemplateDir(); got != old {
+			t.Errorf("%s: template dir %q, want %q", tt.name, got, old)
+		}
+		if got := ren.partials(); strings.Join(got, ",") != strings.Join(partials, ",") {
+			t.Errorf("%s: Partials = %q, want %q", tt.name, got, partials)
+		}
+		for _, page := range []string{"p0.page.tmpl", "p1.page.tmpl"} {
+			if got, err := ren.String(page, nil); err != nil || got != "L1G1P1" {
+				t.Errorf("%s: %s: got %q, %v", tt.name, page, got, err)
+			}
+		}
+	}
+
+	ren := newTestRender(t, old)
+	ren.TemplateDirs = []string{old}
+	if err := ren.SetTemplateDir(broken); err == nil {
+		t.Error("SetTemplateDir with TemplateDirs succeeded")
+	}
+}
@@ -0,0 +1,159 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// templatePath returns the file path file as a path in TemplateFS:
+// "./templates/home.page.tmpl" gives "templates/home.page.tmpl".
+func templatePath(file string) string {
+	return filepath.ToSlash(filepath.Clean(file))
+}
+
+// templateFS returns the file system the template file file is in and its
+// path there: the files of Loader, the bundle of LoadBundle, which holds the
+// contents of TemplateDir, then TemplateFS. It returns a nil fsys for files
+// on disk.
+func (ren *Render) templateFS(file string) (fsys fs.FS, name string, bundled bool) {
+	if ren.Loader != nil {
+		return loaderFS{loader: ren.Loader}, ren.relativePath(file), false
+	}
+	ren.mu.RLock()
+	bundle := ren.bundle
+	ren.mu.RUnlock()
+	if bundle != nil {
+		return bundle, ren.relativePath(file), true
+	}
+	if ren.TemplateFS != nil {
+		return ren.TemplateFS, templatePath(file), false
+	}
+	return nil, file, false
+}
+
+// notInBundle returns err, saying so when it is about a file missing from the
+// bundle.
+func notInBundle(name string, bundled bool, err error) error {
+	if bundled && err != nil && errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s is not in the bundle: %w", name, err)
+	}
+	return err
+}
+
+// readTemplate reads the template file file from the Loader, the bundle or
+// TemplateFS, or from disk when none is set. Files are named by their path on disk
+// (TemplateDir joined with the name) either way, so the names of pages,
+// partials and cached sets don't depend on where the files come from.
+func (ren *Render) readTemplate(file string) ([]byte, error) {
+	fsys, name, bundled := ren.templateFS(file)
+	if fsys == nil {
+		return os.ReadFile(file)
+	}
+	src, err := fs.ReadFile(fsys, name)
+	return src, notInBundle(name, bundled, err)
+}
+
+// openTemplate is readTemplate for reading file as a stream.
+func (ren *Render) openTemplate(file string) (fs.File, error) {
+	fsys, name, bundled := ren.templateFS(file)
+	if fsys == nil {
+		return os.Open(file)
+	}
+	f, err := fsys.Open(name)
+	return f, notInBundle(name, bundled, err)
+}
+
+// statTemplate is os.Stat for the template file file; see readTemplate.
+func (ren *Render) statTemplate(file string) (fs.FileInfo, error) {
+	fsys, name, _ := ren.templateFS(file)
+	if fsys == nil {
+		return os.Stat(file)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// walkTemplates is filepath.WalkDir over root in the Loader, the bundle or
+// TemplateFS, or on disk when none is set. fn gets the same paths from all of
+// them: root itself, then root joined with the path below it.
+func (ren *Render) walkTemplates(root string, fn fs.WalkDirFunc) error {
+	fsys, fsRoot, _ := ren.templateFS(root)
+	if fsys == nil && ren.FollowSymlinks {
+		return walkLinked(root, root, fn, nil)
+	}
+	if fsys == nil {
+		return filepath.WalkDir(root, fn)
+	}
+	if lfs, ok := fsys.(loaderFS); ok {
+		// The directories of the walk are read from one listing.
+		lfs, err := lfs.withList()
+		if err != nil {
+			return fn(root, nil, err)
+		}
+		fsys = lfs
+	}
+	return fs.WalkDir(fsys, fsRoot, func(p string, d fs.DirEntry, err error) error {
+		if p == fsRoot {
+			return fn(root, d, err)
+		}
+		rel := p
+		if fsRoot != "." {
+			rel = strings.TrimPrefix(p, fsRoot+"/")
+		}
+		return fn(filepath.Join(root, filepath.FromSlash(rel)), d, err)
+	})
+}
+
+// linkEntry is the entry of the directory a symlink points to, named after
+// the link.
+type linkEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e linkEntry) Name() string { return e.name }
+
+// walkLinked is filepath.WalkDir over the directory dir, calling fn with the
+// paths below it as if dir were at logical, and walking the directories that
+// symlinks point to in the same way. parents holds the real paths of the
+// directories being walked, to skip links back to one of them.
+func walkLinked(logical, dir string, fn fs.WalkDirFunc, parents map[string]bool) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fn(logical, nil, err)
+	}
+	walking := make(map[string]bool, len(parents)+1)
+	for p := range parents {
+		walking[p] = true
+	}
+	walking[real] = true
+
+	return filepath.WalkDir(real, func(file string, d fs.DirEntry, err error) error {
+		p := logical
+		if rel, relErr := filepath.Rel(real, file); relErr == nil && rel != "." {
+			p = filepath.Join(logical, rel)
+		}
+		if file == real && d != nil {
+			d = linkEntry{DirEntry: d, name: filepath.Base(logical)}
+		}
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return fn(p, d, err)
+		}
+		target, err := filepath.EvalSymlinks(file)
+		if err != nil {
+			return fn(p, d, err)
+		}
+		if info, err := os.Stat(target); err != nil || !info.IsDir() {
+			return fn(p, d, err)
+		}
+		if walking[target] {
+			log.Println("skipping symlink cycle", p, "->", target)
+			return nil
+		}
+		return walkLinked(p, target, fn, walking)
+	})
+}
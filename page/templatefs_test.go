@@ -0,0 +1,68 @@
+package page
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// The pages of the fixture site render the same from disk and from the
+// same files in TemplateFS, and are cached under the same names.
+func TestTemplateFSMatchesDisk(t *testing.T) {
+	disk := newTestRender(t, "../templates")
+	disk.UseCache = true
+
+	files, err := filepath.Glob("../templates/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys["templates/"+filepath.Base(file)] = &fstest.MapFile{Data: src}
+	}
+	embedded := New()
+	embedded.TemplateDir = "./templates"
+	embedded.TemplateFS = fsys
+	embedded.UseCache = true
+	if err := embedded.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := disk.pageNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsPages, err := embedded.pageNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pages, fsPages) {
+		t.Fatalf("pages on disk %q, in TemplateFS %q", pages, fsPages)
+	}
+	td := map[string]any{"Data": map[string]any{"payload": "fixture"}}
+	for _, page := range pages {
+		want, err := disk.String(page, td)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := embedded.String(page, td); err != nil || got != want {
+			t.Errorf("%s from TemplateFS: got %q, %v; want %q", page, got, err, want)
+		}
+	}
+	if got, want := embedded.CachedTemplates(), disk.CachedTemplates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached from TemplateFS %q, from disk %q", got, want)
+	}
+
+	// Nothing is read from disk: a page missing from the FS fails.
+	delete(fsys, "templates/about.page.tmpl")
+	embedded.ClearCache()
+	if _, err := embedded.String("about.page.tmpl", td); err == nil {
+		t.Error("a page missing from TemplateFS rendered")
+	}
+}
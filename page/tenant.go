@@ -0,0 +1,87 @@
+package page
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AddTenant adds the tenant key, usually a host name such as
+// "shop.example.com", with its own templates in dir, and returns the Render
+// serving it, to configure further (AddFunc, GlobalData). The tenant is a
+// Clone of ren with dir added as the last of its template directories: a page
+// or partial in dir replaces the one with the same path in TemplateDir, and
+// everything else, e.g. the shared layouts, comes from TemplateDir.
+//
+// The tenant has its own cache, so the sets of one tenant are never served
+// for another. Its partials are discovered with the file types of the last
+// LoadLayoutsAndPartials (or Start) of ren, and again on every later one.
+// Adding a key twice replaces the tenant.
+func (ren *Render) AddTenant(key, dir string) (*Render, error) {
+	tenant := ren.Clone()
+	tenant.TemplateDirs = append(append([]string(nil), ren.templateDirs()...), dir)
+	ren.mu.RLock()
+	fileTypes := ren.partialTypes
+	ren.mu.RUnlock()
+	if err := tenant.LoadLayoutsAndPartials(fileTypes); err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", key, err)
+	}
+
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if ren.tenants == nil {
+		ren.tenants = make(map[string]*Render)
+	}
+	ren.tenants[strings.ToLower(key)] = tenant
+	return tenant, nil
+}
+
+// Tenant returns the Render of the tenant key added with AddTenant, or ren
+// itself when there is no such tenant.
+func (ren *Render) Tenant(key string) *Render {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	if tenant, ok := ren.tenants[strings.ToLower(key)]; ok {
+		return tenant
+	}
+	return ren
+}
+
+// ShowForHost is ShowRequest with the Render of the tenant of r: the one
+// added with AddTenant for the key TenantKey returns, by default the host of
+// r. Requests for hosts without a tenant are served by ren.
+func (ren *Render) ShowForHost(w http.ResponseWriter, r *http.Request, t string, td any) error {
+	return ren.Tenant(ren.tenantKey(r)).ShowRequest(w, r, t, td)
+}
+
+// tenantKey returns the tenant key of r: TenantKey(r), or the host of r
+// without the port.
+func (ren *Render) tenantKey(r *http.Request) string {
+	if ren.TenantKey != nil {
+		return ren.TenantKey(r)
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
+
+// loadTenantPartials discovers the partials of every tenant again, with
+// fileTypes.
+func (ren *Render) loadTenantPartials(ctx context.Context, fileTypes []string) error {
+	ren.mu.Lock()
+	ren.partialTypes = append([]string(nil), fileTypes...)
+	tenants := make(map[string]*Render, len(ren.tenants))
+	for key, tenant := range ren.tenants {
+		tenants[key] = tenant
+	}
+	ren.mu.Unlock()
+	for key, tenant := range tenants {
+		if err := tenant.LoadLayoutsAndPartialsContext(ctx, fileTypes); err != nil {
+			return fmt.Errorf("tenant %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package page
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Two hosts render the same page names with their own pages and partials,
+// and the shared layout; other hosts get the default templates.
+func TestShowForHost(t *testing.T) {
+	shared := writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}[{{template "content" .}}|{{template "footer" .}}]{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}default footer{{end}}`,
+		"home.page.tmpl":      `{{template "base" .}}{{define "content"}}default home{{end}}`,
+		"about.page.tmpl":     `{{template "base" .}}{{define "content"}}about{{end}}`,
+	})
+	ren := newTestRender(t, shared)
+	ren.UseCache = true
+	if _, err := ren.AddTenant("shop.example.com", writeTemplates(t, map[string]string{
+		"home.page.tmpl":      `{{template "base" .}}{{define "content"}}shop home{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}shop footer{{end}}`,
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ren.AddTenant("Blog.Example.com", writeTemplates(t, map[string]string{
+		"home.page.tmpl": `{{template "base" .}}{{define "content"}}blog home{{end}}`,
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, page, want string
+	}{
+		{"shop.example.com", "home.page.tmpl", "[shop home|shop footer]"},
+		{"blog.example.com:8080", "home.page.tmpl", "[blog home|default footer]"},
+		{"other.example.com", "home.page.tmpl", "[default home|default footer]"},
+		// Pages the tenant doesn't have come from TemplateDir, with the
+		// partials of the tenant.
+		{"shop.example.com", "about", "[about|shop footer]"},
+		{"blog.example.com", "about", "[about|default footer]"},
+		// Rendered again, from the cache of each tenant: the sets of one
+		// host are never served for another.
+		{"shop.example.com", "home", "[shop home|shop footer]"},
+		{"BLOG.example.com", "home", "[blog home|default footer]"},
+		{"other.example.com", "home", "[default home|default footer]"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		if err := ren.ShowForHost(w, r, tt.page, nil); err != nil {
+			t.Fatalf("%s %s: %v", tt.host, tt.page, err)
+		}
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.host, tt.page, got, tt.want)
+		}
+	}
+}
+
+// TenantKey picks the tenant from anything in the request.
+func TestTenantKey(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, map[string]string{"home.page.tmpl": `default`}))
+	ren.TenantKey = func(r *http.Request) string { return r.Header.Get("X-Tenant") }
+	if _, err := ren.AddTenant("acme", writeTemplates(t, map[string]string{"home.page.tmpl": `acme`})); err != nil {
+		t.Fatal(err)
+	}
+	for tenant, want := range map[string]string{"acme": "acme", "": "default", "other": "default"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		if err := ren.ShowForHost(w, r, "home", nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Body.String(); got != want {
+			t.Errorf("X-Tenant %q: got %q, want %q", tenant, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package page
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+)
+
+// colorSchemeHint is the client hint carrying the color scheme the user
+// prefers ("light" or "dark"), sent once a response asked for it.
+const colorSchemeHint = "Sec-CH-Prefers-Color-Scheme"
+
+var (
+	themeRegex     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	classAttrRegex = regexp.MustCompile(`(?i)\sclass\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// theme returns the theme ThemeResolver picks for r, or "" when there is no
+// resolver or its answer is not a usable class name.
+func (ren *Render) theme(r *http.Request) string {
+	if ren.ThemeResolver == nil {
+		return ""
+	}
+	if theme := ren.ThemeResolver(r); themeRegex.MatchString(theme) {
+		return theme
+	}
+	return ""
+}
+
+// setThemeHeaders asks the client for the color scheme hint and marks the
+// response as depending on it, so caches keep a copy per scheme.
+func (ren *Render) setThemeHeaders(w http.ResponseWriter) {
+	if ren.ThemeResolver == nil {
+		return
+	}
+	w.Header().Add("Accept-CH", colorSchemeHint)
+	w.Header().Add("Vary", colorSchemeHint)
+}
+
+// needsThemeClass reports whether ShowRequest adds theme as a class to <html>
+// in the output of tmpl: ThemeClass is set and the templates don't use
+// {{theme}} themselves.
+func (ren *Render) needsThemeClass(tmpl *template.Template, theme string) bool {
+	return theme != "" && ren.ThemeClass && !usesFunc(tmpl, "theme")
+}
+
+// addHTMLClass adds class to the class attribute of the root <html> element
+// in out. Output without an <html> element is returned as is.
+func addHTMLClass(out []byte, class string) []byte {
+	loc := htmlTagRegex.FindIndex(out)
+	if loc == nil {
+		return out
+	}
+	tag := out[loc[0]:loc[1]]
+	var newTag []byte
+	if attr := classAttrRegex.FindSubmatchIndex(tag); attr != nil {
+		// Append to the existing value, keeping its quotes.
+		value := string(tag[attr[2]:attr[3]])
+		if value[0] == '"' || value[0] == '\'' {
+			value = value[:len(value)-1] + " " + class + value[len(value)-1:]
+		} else {
+			value = `"` + value + " " + class + `"`
+		}
+		newTag = append(append(append([]byte(nil), tag[:attr[2]]...), value...), tag[attr[3]:]...)
+	} else {
+		// Insert the attribute right after "<html".
+		newTag = append(append(append([]byte(nil), tag[:5]...), ` class="`+class+`"`...), tag[5:]...)
+	}
+
+	result := make([]byte, 0, len(out)-len(tag)+len(newTag))
+	result = append(result, out[:loc[0]]...)
+	result = append(result, newTag...)
+	result = append(result, out[loc[1]:]...)
+	return result
+}
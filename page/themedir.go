@@ -0,0 +1,99 @@
+package page
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// themesDir is the directory of a template directory holding the themes of
+// Theme, one directory per theme.
+const themesDir = "themes"
+
+// SetTheme switches the template theme to theme (see Theme), or back to the
+// plain templates for "". The cache is cleared, so every page is rebuilt
+// with the templates of the new theme on its next render. It is safe to call
+// while pages are rendered.
+func (ren *Render) SetTheme(theme string) error {
+	if theme != "" && !themeRegex.MatchString(theme) {
+		return fmt.Errorf("invalid theme name %q", theme)
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	if theme == ren.Theme {
+		return nil
+	}
+	pages := ren.cachedPagesLocked()
+	ren.partialsMu.Lock()
+	ren.Theme = theme
+	ren.partialsMu.Unlock()
+	ren.cache = make(map[string]*template.Template)
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	if ren.Debug {
+		log.Println("Theme changed to", theme, "- template cache cleared")
+	}
+	if len(pages) > 0 {
+		ren.publish(TemplateEvent{Type: TemplateInvalidated, Path: theme, Pages: pages})
+	}
+	return nil
+}
+
+// currentTheme returns Theme, read under the lock.
+func (ren *Render) currentTheme() string {
+	ren.partialsMu.RLock()
+	defer ren.partialsMu.RUnlock()
+	return ren.Theme
+}
+
+// themeOf reports whether file is in the directory of a theme, returning the
+// theme and the path of file in it: "templates/themes/acme/nav.partial.tmpl"
+// gives "acme" and "nav.partial.tmpl".
+func (ren *Render) themeOf(file string) (theme, rel string, ok bool) {
+	rel, ok = ren.relativeTo(file)
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.SplitN(rel, string(filepath.Separator), 3)
+	if len(parts) < 3 || parts[0] != themesDir {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// themedFiles returns the template files of files for theme: a file of
+// theme replaces the file with the same path outside of the themes, in the
+// place of that file, and the files of other themes are left out.
+func (ren *Render) themedFiles(files []string, theme string) []string {
+	overrides := make(map[string]string)
+	for _, f := range files {
+		if th, rel, ok := ren.themeOf(f); ok && th == theme {
+			overrides[rel] = f
+		}
+	}
+	result := make([]string, 0, len(files))
+	used := make(map[string]bool, len(overrides))
+	for _, f := range files {
+		if th, _, ok := ren.themeOf(f); ok {
+			if th == theme && !used[f] {
+				used[f] = true
+				result = append(result, f)
+			}
+			continue
+		}
+		if rel, ok := ren.relativeTo(f); ok {
+			if o, ok := overrides[rel]; ok {
+				if !used[o] {
+					used[o] = true
+					result = append(result, o)
+				}
+				continue
+			}
+		}
+		result = append(result, f)
+	}
+	return result
+}
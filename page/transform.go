@@ -0,0 +1,84 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+)
+
+// SourceTransform rewrites the source of the template file name before it is
+// parsed; see Render.SourceTransforms.
+type SourceTransform func(name string, src []byte) ([]byte, error)
+
+// DefaultSourceTransforms are the transforms applied when SourceTransforms
+// is nil.
+var DefaultSourceTransforms = []SourceTransform{StripBOM, StripFrontMatter}
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// StripBOM removes a UTF-8 byte order mark from the start of src, which would
+// otherwise be rendered before the doctype.
+func StripBOM(name string, src []byte) ([]byte, error) {
+	return bytes.TrimPrefix(src, utf8BOM), nil
+}
+
+// StripFrontMatter removes the front matter from the start of src (see
+// PageMeta); the metadata in it is not markup.
+func StripFrontMatter(name string, src []byte) ([]byte, error) {
+	_, body, _ := splitFrontMatter(src)
+	return body, nil
+}
+
+// transformSource runs the source transforms over src of the file name in
+// order, and returns the result with the number of lines the transforms
+// removed from the start of the source. That is the shift the source map
+// applies to line numbers: a transform that only cuts off a prefix (a BOM,
+// front matter, a license header) keeps the line numbers of errors
+// right. Lines a transform changes further down are not accounted for.
+func (ren *Render) transformSource(name string, src []byte) ([]byte, int, error) {
+	transforms := ren.SourceTransforms
+	if transforms == nil {
+		transforms = DefaultSourceTransforms
+	}
+	offset := 0
+	for _, transform := range transforms {
+		out, err := transform(name, src)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", name, err)
+		}
+		if len(out) < len(src) && bytes.HasSuffix(src, out) {
+			offset += bytes.Count(src[:len(src)-len(out)], []byte("\n"))
+		}
+		src = out
+	}
+	return src, offset, nil
+}
+
+// parseFiles is template.ParseFiles with the source transforms applied: each
+// file becomes the template named by its templateName in the set tmpl. The
+// line shift of each file is recorded in sources, when it is not nil.
+func (ren *Render) parseFiles(tmpl *template.Template, sources sourceMap, files ...string) error {
+	for _, file := range files {
+		src, err := ren.readTemplate(file)
+		if err != nil {
+			return err
+		}
+		src, offset, err := ren.transformSource(file, src)
+		if err != nil {
+			return err
+		}
+		name := ren.templateName(file)
+		if sources != nil {
+			sources[name] = sourceFile{Path: file, LineOffset: offset}
+		}
+		t := tmpl
+		if name != tmpl.Name() {
+			t = tmpl.New(name)
+		}
+		if _, err := t.Parse(string(src)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
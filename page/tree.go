@@ -0,0 +1,82 @@
+package page
+
+import (
+	"html/template"
+	"text/template/parse"
+)
+
+// usesFunc reports whether any template defined in the set tmpl calls one of
+// the functions in names. It walks the parse trees, so it only sees calls
+// written in the template source, e.g. {{langAttr}} or {{status 410}}.
+func usesFunc(tmpl *template.Template, names ...string) bool {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		found := false
+		walkTree(t.Tree.Root, func(n parse.Node) {
+			if id, ok := n.(*parse.IdentifierNode); ok {
+				for _, name := range names {
+					if id.Ident == name {
+						found = true
+					}
+				}
+			}
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// walkTree calls fn for node and every node below it.
+func walkTree(node parse.Node, fn func(parse.Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkTree(c, fn)
+		}
+	case *parse.ActionNode:
+		walkTree(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, d := range n.Decl {
+			walkTree(d, fn)
+		}
+		for _, c := range n.Cmds {
+			walkTree(c, fn)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkTree(a, fn)
+		}
+	case *parse.ChainNode:
+		walkTree(n.Node, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkTree(n.Pipe, fn)
+	}
+}
+
+func walkBranch(b *parse.BranchNode, fn func(parse.Node)) {
+	walkTree(b.Pipe, fn)
+	walkTree(b.List, fn)
+	if b.ElseList != nil {
+		walkTree(b.ElseList, fn)
+	}
+}
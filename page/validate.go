@@ -0,0 +1,204 @@
+package page
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Finding is one problem reported by Validate.
+type Finding struct {
+	Template string // The page that was rendered, e.g. "home.page.tmpl"; "" for source findings.
+	File     string // The source file, for findings of a source pass; "" otherwise.
+	Rule     string // Rule id, e.g. "zgotmplz".
+	Line     int    // Approximate line in the rendered output, or in File (0 when unknown).
+	Message  string // What was found, with a snippet of the output.
+}
+
+// String formats the finding as "template:line: [rule] message", with the
+// file instead of the template for source findings.
+func (f Finding) String() string {
+	where := f.Template
+	if f.File != "" {
+		where = f.File
+	}
+	return fmt.Sprintf("%s:%d: [%s] %s", where, f.Line, f.Rule, f.Message)
+}
+
+// lintPass inspects the canary output of the page t and returns its findings.
+type lintPass func(t string, out []byte) []Finding
+
+// lintPasses are run by Validate over the canary output of every page.
+var lintPasses = []lintPass{
+	lintEscaping,
+}
+
+// Validate builds every page in TemplateDir and executes it with synthetic
+// canary data derived from the fields the page uses, then runs the lint passes
+// over the output and the source passes over every page and partial file.
+// It is meant to run at startup or in CI, turning template problems into
+// findings before a user hits them.
+//
+// The returned error joins the errors of pages that failed to build.
+// Pages that build but fail to execute with canary data are reported as a
+// finding with rule "canary-exec", since the synthetic data can't always match
+// what a page expects. Templates defined in more than one file are errors;
+// see CheckDuplicates. Names in GeneratedNames without a template are
+// reported with rule "stale-name".
+func (ren *Render) Validate() ([]Finding, error) {
+	pages, err := ren.pageNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	var errs []error
+
+	// Pages are built for the current Environment only, so parse the
+	// variants for every environment on their own to catch syntax errors.
+	variants, err := ren.environmentVariants()
+	if err != nil {
+		return nil, err
+	}
+	funcs := ren.templateFuncs()
+	for _, files := range variants {
+		for _, file := range files {
+			if err := ren.parseFiles(template.New(ren.templateName(file)).Funcs(funcs), nil, file); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	theme := ren.currentTheme()
+	files := ren.resolvePartialFiles(ren.partials(), theme)
+	for _, t := range pages {
+		files = append(files, ren.resolvePage(t, theme))
+		tmpl, err := ren.buildTemplate(t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t, err))
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, t, canaryData(tmpl, t)); err != nil {
+			findings = append(findings, Finding{Template: t, Rule: "canary-exec", Message: err.Error()})
+			continue
+		}
+		for _, pass := range lintPasses {
+			findings = append(findings, pass(t, buf.Bytes())...)
+		}
+	}
+
+	errs = append(errs, ren.validateComponents()...)
+	if err := ren.CheckDuplicates(); err != nil {
+		errs = append(errs, err)
+	}
+
+	stale, err := ren.lintGeneratedNames()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	findings = append(findings, stale...)
+
+	for _, file := range files {
+		src, err := ren.readTemplate(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, pass := range sourcePasses {
+			findings = append(findings, pass(file, src)...)
+		}
+	}
+	return findings, errors.Join(errs...)
+}
+
+// pageNames returns the names of the pages in TemplateDir: every template
+// file directly in TemplateDir that isn't one of the Partials or an
+// environment variant.
+func (ren *Render) pageNames() ([]string, error) {
+	return ren.pageNamesFor(ren.partials())
+}
+
+// pageNamesFor is pageNames for the list of partials partialFiles.
+func (ren *Render) pageNamesFor(partialFiles []string) ([]string, error) {
+	files, err := ren.findTemplates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	inList := make(map[string]bool, len(files))
+	for _, f := range files {
+		inList[f] = true
+	}
+	exists := func(f string) bool { return inList[f] }
+	// A partial in use may be the variant of a file; that file is a partial too.
+	partials := make(map[string]bool)
+	for _, p := range partialFiles {
+		partials[filepath.Clean(p)] = true
+		if base, _, ok := variantOf(p, exists); ok {
+			partials[filepath.Clean(base)] = true
+		}
+	}
+	var pages []string
+	for _, f := range files {
+		if partials[filepath.Clean(f)] {
+			continue
+		}
+		// Files below a template directory are pages when their name says
+		// so, and are named by their path: "admin/users.page.tmpl".
+		if !ren.inTemplateDir(f) && !strings.Contains(filepath.Base(f), ".page.") {
+			continue
+		}
+		if _, _, themed := ren.themeOf(f); themed {
+			continue
+		}
+		// Environment variants are not pages of their own.
+		if _, _, ok := variantOf(f, exists); ok {
+			continue
+		}
+		pages = append(pages, ren.templateName(f))
+	}
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// lintEscaping reports html/template escaping surprises in canary output:
+//   - "url-neutralized": a URL attribute became "#ZgotmplZ" because the value
+//     was not a safe URL, e.g. a javascript: URL or one built by concatenation
+//   - "zgotmplz": any other ZgotmplZ, e.g. a value used as an attribute name or
+//     in CSS
+//   - "double-escaped": text escaped twice, e.g. a template.HTML value turned
+//     into a string by a function and escaped again ("&amp;lt;")
+func lintEscaping(t string, out []byte) []Finding {
+	var findings []Finding
+	for i, line := range bytes.Split(out, []byte("\n")) {
+		text := string(line)
+		switch {
+		case strings.Contains(text, "#ZgotmplZ"):
+			findings = append(findings, Finding{Template: t, Rule: "url-neutralized", Line: i + 1,
+				Message: "unsafe URL replaced by #ZgotmplZ: " + snippet(text, "#ZgotmplZ")})
+		case strings.Contains(text, "ZgotmplZ"):
+			findings = append(findings, Finding{Template: t, Rule: "zgotmplz", Line: i + 1,
+				Message: "value rejected by the escaper: " + snippet(text, "ZgotmplZ")})
+		}
+		for _, escaped := range []string{"&amp;lt;", "&amp;gt;", "&amp;amp;", "&amp;quot;", "&amp;#"} {
+			if strings.Contains(text, escaped) {
+				findings = append(findings, Finding{Template: t, Rule: "double-escaped", Line: i + 1,
+					Message: "text escaped twice: " + snippet(text, escaped)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// snippet returns up to 40 bytes of text on either side of the first match.
+func snippet(text, match string) string {
+	i := strings.Index(text, match)
+	start, end := max(0, i-40), min(len(text), i+len(match)+40)
+	return strings.TrimSpace(text[start:end])
+}
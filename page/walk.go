@@ -0,0 +1,251 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultIgnore are the names the scans of TemplateDir skip when
+// Render.Ignore is nil: hidden files and directories (.git, .#footer.tmpl),
+// names starting with "_", editor backups, and dependency trees.
+var DefaultIgnore = []string{".*", "_*", "*~", "#*#", "node_modules", "bower_components"}
+
+// DefaultExtensions are the extensions of template files in a Render made
+// with New; see Render.Extensions.
+var DefaultExtensions = []string{".tmpl", ".gohtml", ".html"}
+
+const (
+	// defaultMaxFilesScanned and defaultMaxDepth are the scan limits used
+	// when MaxFilesScanned and MaxDepth are 0. No template tree comes near
+	// them; a tree that does is most likely not a template tree.
+	defaultMaxFilesScanned = 100000
+	defaultMaxDepth        = 32
+	// scanProgressEvery is how many files a scan logs its progress after,
+	// with Debug set.
+	scanProgressEvery = 10000
+)
+
+// Errors about missing templates, wrapped with the directory or page they
+// are about; test for them with errors.Is.
+var (
+	// ErrTemplateDirNotFound is the error of LoadLayoutsAndPartials (and of
+	// every other scan) for a template directory that doesn't exist.
+	ErrTemplateDirNotFound = errors.New("template directory not found")
+	// ErrNoTemplatesFound is the error of LoadLayoutsAndPartials for template
+	// directories without a single template file (see Extensions).
+	ErrNoTemplatesFound = errors.New("no templates found")
+	// ErrTemplateNotFound is the error of rendering a page whose file, or the
+	// file of one of its partials, doesn't exist.
+	ErrTemplateNotFound = errors.New("template not found")
+)
+
+// displayDir returns dir as errors show it: absolute for a directory on
+// disk, as it is for one in TemplateFS, the bundle or the Loader.
+func (ren *Render) displayDir(dir string) string {
+	if fsys, _, _ := ren.templateFS(dir); fsys != nil {
+		return dir
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// extensions returns the extensions of template files; see isTemplateFile.
+func (ren *Render) extensions() []string {
+	if len(ren.Extensions) == 0 {
+		return []string{".tmpl"}
+	}
+	return ren.Extensions
+}
+
+// ScanLimitError is the error of a scan of TemplateDir stopped by
+// MaxFilesScanned or MaxDepth.
+type ScanLimitError struct {
+	Dir   string // The directory scanned.
+	Limit string // "files" or "depth".
+	Max   int    // The limit that was exceeded.
+}
+
+func (e *ScanLimitError) Error() string {
+	if e.Limit == "depth" {
+		return fmt.Sprintf("scanning %s: directories nested deeper than %d (MaxDepth); is it the template directory?", e.Dir, e.Max)
+	}
+	return fmt.Sprintf("scanning %s: more than %d files (MaxFilesScanned); is it the template directory?", e.Dir, e.Max)
+}
+
+// unreadableDirs returns a copy of the directories the last scan skipped.
+func (ren *Render) unreadableDirs() []string {
+	ren.mu.RLock()
+	defer ren.mu.RUnlock()
+	return append([]string(nil), ren.unreadable...)
+}
+
+// isTemplateFile reports whether name has one of the extensions of template
+// files: those in Extensions, or ".tmpl" when it is empty.
+func (ren *Render) isTemplateFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range ren.extensions() {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the slash path rel, relative to a template
+// directory, matches a pattern of Exclude.
+func (ren *Render) excluded(rel string) bool {
+	for _, pattern := range ren.Exclude {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether name, the name of a file or directory, matches a
+// pattern of Ignore.
+func (ren *Render) ignored(name string) bool {
+	patterns := ren.Ignore
+	if patterns == nil {
+		patterns = DefaultIgnore
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedFile reports whether file, in one of the template directories,
+// matches a pattern of Exclude.
+func (ren *Render) excludedFile(file string) bool {
+	rel, ok := ren.relativeTo(file)
+	return ok && ren.excluded(filepath.ToSlash(rel))
+}
+
+// matchGlob reports whether the slash path name matches pattern, a
+// path.Match pattern in which a "**" element matches any number of path
+// elements. A pattern without a slash is matched against the base name.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchElements is matchGlob for the elements of a pattern and a path.
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// skipEntry reports whether the scan of root skips s, with the entry d: its
+// name matches Ignore, or its path below root matches Exclude.
+func (ren *Render) skipEntry(root, s string, d fs.DirEntry) bool {
+	if ren.ignored(d.Name()) {
+		return true
+	}
+	rel, err := filepath.Rel(root, s)
+	return err == nil && ren.excluded(filepath.ToSlash(rel))
+}
+
+// find returns the template files in the tree below root; see
+// isTemplateFile.
+func (ren *Render) find(root string) ([]string, error) {
+	return ren.findContext(context.Background(), root)
+}
+
+// findContext is find, stopping when ctx is done. The scan fails with a
+// *ScanLimitError when the tree holds more than MaxFilesScanned entries or
+// nests deeper than MaxDepth. Directories below root that can't be read are
+// skipped, logged and kept for Stats.Unreadable; only an unreadable root
+// fails the scan. Files and directories matching Ignore or Exclude are
+// skipped without being looked into.
+func (ren *Render) findContext(ctx context.Context, root string) ([]string, error) {
+	maxFiles, maxDepth := ren.MaxFilesScanned, ren.MaxDepth
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFilesScanned
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+
+	var files, unreadable, skipped []string
+	scanned := 0
+	err := ren.walkTemplates(root, func(s string, d fs.DirEntry, e error) error {
+		if e != nil {
+			if s == root && errors.Is(e, fs.ErrNotExist) {
+				return fmt.Errorf("%w: %s", ErrTemplateDirNotFound, ren.displayDir(root))
+			}
+			if s == root || d == nil {
+				return e
+			}
+			log.Println("skipping unreadable", s, e)
+			unreadable = append(unreadable, s)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s != root && ren.skipEntry(root, s, d) {
+			skipped = append(skipped, s)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		scanned++
+		if scanned > maxFiles {
+			return &ScanLimitError{Dir: root, Limit: "files", Max: maxFiles}
+		}
+		if ren.Debug && scanned%scanProgressEvery == 0 {
+			log.Println("Scanned", scanned, "files in", root)
+		}
+		if d.IsDir() && s != root {
+			if rel, err := filepath.Rel(root, s); err == nil && strings.Count(rel, string(filepath.Separator))+1 > maxDepth {
+				return &ScanLimitError{Dir: root, Limit: "depth", Max: maxDepth}
+			}
+		}
+		if !d.IsDir() && ren.isTemplateFile(d.Name()) {
+			files = append(files, s)
+		}
+		return nil
+	})
+
+	ren.mu.Lock()
+	ren.unreadable = unreadable
+	ren.mu.Unlock()
+	if ren.Debug && len(skipped) > 0 {
+		log.Println("Skipped in", root+":", skipped)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,63 @@
+package page
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mixedTemplates have layouts, partials and pages of every default
+// extension, and a file of another type.
+var mixedTemplates = map[string]string{
+	"base.layout.gohtml":    `{{define "base"}}<{{template "header"}}|{{template "content" .}}|{{template "footer"}}>{{end}}`,
+	"header.partial.tmpl":   `{{define "header"}}tmpl header{{end}}`,
+	"footer.partial.gohtml": `{{define "footer"}}gohtml footer{{end}}`,
+	"home.page.gohtml":      `{{template "base" .}}{{define "content"}}gohtml page{{end}}`,
+	"about.page.tmpl":       `{{template "base" .}}{{define "content"}}tmpl page{{end}}`,
+	"notes.partial.txt":     `{{define "header"}}not a template{{end}}`,
+}
+
+// partialNames returns the base names of the Partials of ren.
+func partialNames(ren *Render) []string {
+	var names []string
+	for _, p := range ren.partials() {
+		names = append(names, filepath.Base(p))
+	}
+	return names
+}
+
+// Layouts and partials of both .tmpl and .gohtml are loaded into the pages of
+// both, and files of other types are not.
+func TestMixedExtensions(t *testing.T) {
+	ren := newTestRender(t, writeTemplates(t, mixedTemplates))
+	if got, want := partialNames(ren), []string{"base.layout.gohtml", "footer.partial.gohtml", "header.partial.tmpl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Partials = %q, want %q", got, want)
+	}
+	for page, want := range map[string]string{
+		"home.page.gohtml": "<tmpl header|gohtml page|gohtml footer>",
+		"about.page.tmpl":  "<tmpl header|tmpl page|gohtml footer>",
+		"home":             "<tmpl header|gohtml page|gohtml footer>",
+	} {
+		if got, err := ren.String(page, nil); err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", page, got, err, want)
+		}
+	}
+}
+
+// Without Extensions, only .tmpl files are templates: the .gohtml layout is
+// not loaded, and the pages using it fail.
+func TestEmptyExtensions(t *testing.T) {
+	ren := New()
+	ren.TemplateDir = writeTemplates(t, mixedTemplates)
+	ren.Extensions = nil
+	if err := ren.LoadLayoutsAndPartials([]string{".layout", ".partial"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := partialNames(ren), []string{"header.partial.tmpl"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Partials = %q, want %q", got, want)
+	}
+	if _, err := ren.String("about.page.tmpl", nil); err == nil || !strings.Contains(err.Error(), `"base"`) {
+		t.Errorf("about.page.tmpl without the .gohtml layout: error %v", err)
+	}
+}
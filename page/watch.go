@@ -0,0 +1,202 @@
+package page
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// defaultWatchPoll is how often Watch scans the template directories when
+// WatchPoll is 0.
+const defaultWatchPoll = 250 * time.Millisecond
+
+// watchedFile is what Watch knows of a template file: a write changes at
+// least one of the two.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch keeps the template cache in step with the files of the template
+// directories until ctx is done, for development: a page edited on disk is
+// served from its new file on the next render, with UseCache still set. It
+// scans the directories every WatchPoll (250ms by default). When a layout
+// or partial file (of the types of the last LoadLayoutsAndPartials) is
+// written, added or removed, the partials are discovered again, which
+// clears the cache; when another file changes, the cached sets built from
+// it are dropped. Editors write a file several times per save, so changes
+// are acted on once a scan finds nothing new. With Debug, the dropped pages
+// are logged.
+//
+// Watch polls rather than subscribing to file system events (fsnotify and
+// the like): that would take a dependency outside the standard library, and
+// events are unreliable on the mounts templates are often edited through in
+// development (Docker volumes, network shares, editors replacing files).
+//
+// An edit is acted on up to one WatchPoll after it is written, when a scan
+// finds it, plus the one scan after that which must find nothing new: about
+// 2×WatchPoll, 500ms by default. Each scan lists the template directories
+// and stats every template file, without reading it, so it costs one stat
+// call per file every WatchPoll, e.g. 4000 per second for 1000 files at the
+// default. For large trees, set WatchPoll to scan less often, at the cost of
+// a later reaction to edits.
+//
+// Watch blocks until ctx is done and returns ctx.Err(); run it in a
+// goroutine of its own:
+//
+//	go ren.Watch(ctx)
+//
+// It returns an error at once when the template directories can't be read.
+// Later scans that fail are logged and retried.
+func (ren *Render) Watch(ctx context.Context) error {
+	files, err := ren.scanFiles(ctx)
+	if err != nil {
+		return err
+	}
+	return ren.watch(ctx, files)
+}
+
+// watch is Watch after its first scan, which found files.
+func (ren *Render) watch(ctx context.Context, files map[string]watchedFile) error {
+	if ren.Debug {
+		log.Println("Watching", len(files), "template files")
+	}
+	poll := ren.WatchPoll
+	if poll <= 0 {
+		poll = defaultWatchPoll
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	pending := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			if ren.Debug {
+				log.Println("Stopped watching template files")
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		scanned, err := ren.scanFiles(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("watching templates:", err)
+			}
+			continue
+		}
+		changed := changedFiles(files, scanned)
+		files = scanned
+		for _, file := range changed {
+			pending[file] = true
+		}
+		if len(changed) > 0 || len(pending) == 0 {
+			continue
+		}
+		list := make([]string, 0, len(pending))
+		for file := range pending {
+			list = append(list, file)
+		}
+		sort.Strings(list)
+		pending = make(map[string]bool)
+		ren.filesChanged(list)
+	}
+}
+
+// scanFiles returns the template files of all template directories, with
+// what Watch compares between scans. A file removed while scanning is left
+// out.
+func (ren *Render) scanFiles(ctx context.Context) (map[string]watchedFile, error) {
+	files := make(map[string]watchedFile)
+	for _, dir := range ren.templateDirs() {
+		found, err := ren.findContext(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range found {
+			info, err := ren.statTemplate(file)
+			if err != nil {
+				continue
+			}
+			files[file] = watchedFile{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files, nil
+}
+
+// changedFiles returns the files written, added or removed between the scans
+// old and scanned.
+func changedFiles(old, scanned map[string]watchedFile) []string {
+	var changed []string
+	for file, f := range scanned {
+		if o, ok := old[file]; !ok || !o.modTime.Equal(f.modTime) || o.size != f.size {
+			changed = append(changed, file)
+		}
+	}
+	for file := range old {
+		if _, ok := scanned[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// filesChanged brings the cache in step with changes to the template files
+// files: it discovers the partials again when one of the files is a layout
+// or partial, and otherwise drops the cached sets built from the files, and
+// the set of a page file. Builds running at the time are not cached, as for
+// Invalidate.
+func (ren *Render) filesChanged(files []string) {
+	ren.mu.RLock()
+	fileTypes := ren.partialTypes
+	ren.mu.RUnlock()
+	for _, fileType := range fileTypes {
+		if len(addTemplate(files, fileType)) == 0 {
+			continue
+		}
+		if ren.Debug {
+			log.Println("Template files changed:", files, "- loading the partials again")
+		}
+		if err := ren.LoadLayoutsAndPartials(fileTypes); err != nil {
+			log.Println("reloading changed templates:", err)
+		}
+		return
+	}
+
+	changed, names := make(map[string]bool, len(files)), make(map[string]bool, len(files))
+	for _, file := range files {
+		changed[file] = true
+		names[ren.templateName(file)] = true
+	}
+	ren.mu.Lock()
+	defer ren.mu.Unlock()
+	var pages []string
+	for _, t := range ren.cachedPagesLocked() {
+		if names[t] || ren.builtFromLocked(t, changed) {
+			delete(ren.cache, t)
+			pages = append(pages, t)
+		}
+	}
+	ren.snapshot.Store(nil)
+	ren.cacheGen++
+	ren.site = nil
+	ren.pageAliases = nil
+	if ren.Debug {
+		log.Println("Template files changed:", files, "- invalidated", pages)
+	}
+	if len(pages) > 0 {
+		ren.publish(TemplateEvent{Type: TemplateInvalidated, Pages: pages})
+	}
+}
+
+// builtFromLocked reports whether the cached set of the page t was built from
+// one of the files in files. The caller must hold ren.mu.
+func (ren *Render) builtFromLocked(t string, files map[string]bool) bool {
+	for _, src := range ren.sourceMaps[t] {
+		if files[src.Path] {
+			return true
+		}
+	}
+	return false
+}
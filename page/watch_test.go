@@ -0,0 +1,60 @@
+package page
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"base.layout.tmpl":    `{{define "base"}}[{{template "footer" .}}]{{block "content" .}}{{end}}{{end}}`,
+		"footer.partial.tmpl": `{{define "footer"}}v1{{end}}`,
+		"home.page.tmpl":      `{{template "base" .}}{{define "content"}}home v1{{end}}`,
+	})
+	ren := newTestRender(t, dir)
+	ren.WatchPoll = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ren.Watch(ctx) }()
+
+	render := func(want string) func() bool {
+		return func() bool {
+			got, err := ren.String("home.page.tmpl", nil)
+			return err == nil && got == want
+		}
+	}
+	waitFor(t, "the first render", render("[v1]home v1"))
+
+	// Watch may not have taken its first scan when a file is first written,
+	// so the write is repeated until the render shows it. Modification times
+	// may not change within the resolution of the file system; the size does.
+	edit := func(name, src, want string) {
+		t.Helper()
+		var written time.Time
+		waitFor(t, "the edited "+name, func() bool {
+			if time.Since(written) > 100*time.Millisecond {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				written = time.Now()
+			}
+			return render(want)()
+		})
+	}
+	edit("home.page.tmpl", `{{template "base" .}}{{define "content"}}home v22{{end}}`, "[v1]home v22")
+	edit("footer.partial.tmpl", `{{define "footer"}}v333{{end}}`, "[v333]home v22")
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Watch returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't return after ctx was done")
+	}
+}
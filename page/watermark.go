@@ -0,0 +1,115 @@
+package page
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+
+	"text/template/parse"
+)
+
+// watermarkFile is the file in TemplateDir that replaces the built-in banner.
+const watermarkFile = "watermark.tmpl"
+
+// builtinWatermark is the banner injected when TemplateDir has no
+// watermark.tmpl. It is executed with the Environment as its data.
+//
+//go:embed builtin/watermark.tmpl
+var builtinWatermark string
+
+// watermarkBanner is the parsed banner template, loaded on first use.
+type watermarkBanner struct {
+	once sync.Once
+	tmpl *template.Template
+	err  error
+}
+
+// watermarkActive reports whether pages get the environment banner and the
+// X-Environment header: when Environment is "staging" or Watermark is set.
+// Environment "production" never gets them, whatever the templates say.
+func (ren *Render) watermarkActive() bool {
+	if ren.Environment == "production" {
+		return false
+	}
+	return ren.Environment == "staging" || ren.Watermark
+}
+
+// setEnvironmentHeader sets X-Environment when the watermark is active and
+// Environment is set.
+func (ren *Render) setEnvironmentHeader(w http.ResponseWriter) {
+	if ren.watermarkActive() && ren.Environment != "" {
+		w.Header().Set("X-Environment", ren.Environment)
+	}
+}
+
+// noWatermark is the {{noWatermark}} template function. It renders nothing:
+// a page calling it is only recognised by postProcess, which then leaves it
+// without the banner.
+func noWatermark() string {
+	return ""
+}
+
+// needsWatermark reports whether the output of the set tmpl gets the banner:
+// the watermark is active and the page itself (not one of its partials) does
+// not call {{noWatermark}}.
+func (ren *Render) needsWatermark(tmpl *template.Template) bool {
+	if !ren.watermarkActive() {
+		return false
+	}
+	page := tmpl.Lookup(tmpl.Name())
+	if page == nil || page.Tree == nil {
+		return true
+	}
+	optOut := false
+	walkTree(page.Tree.Root, func(n parse.Node) {
+		if id, ok := n.(*parse.IdentifierNode); ok && id.Ident == "noWatermark" {
+			optOut = true
+		}
+	})
+	return !optOut
+}
+
+// watermark inserts the environment banner before the last </body> of out.
+// Output without </body> (fragments, HTMX partial renders) is left alone.
+func (ren *Render) watermark(out []byte) []byte {
+	i := lastIndexFold(out, []byte("</body>"))
+	if i < 0 {
+		return out
+	}
+	// The banner is read once per Render; a watermark.tmpl in TemplateDir
+	// replaces the built-in one.
+	b := &ren.banner
+	b.once.Do(func() {
+		src := builtinWatermark
+		if custom, err := ren.readTemplate(ren.lookupTemplate(watermarkFile)); err == nil {
+			src = string(custom)
+		}
+		b.tmpl, b.err = template.New(watermarkFile).Parse(src)
+	})
+	if b.err != nil {
+		log.Println("watermark:", b.err)
+		return out
+	}
+	var banner bytes.Buffer
+	if err := b.tmpl.Execute(&banner, ren.Environment); err != nil {
+		log.Println("watermark:", err)
+		return out
+	}
+	result := make([]byte, 0, len(out)+banner.Len())
+	result = append(result, out[:i]...)
+	result = append(result, banner.Bytes()...)
+	return append(result, out[i:]...)
+}
+
+// lastIndexFold is bytes.LastIndex ignoring ASCII case.
+func lastIndexFold(s, sep []byte) int {
+	for i := len(s) - len(sep); i >= 0; i-- {
+		if bytes.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}